@@ -26,6 +26,7 @@ import (
 	"testing"
 
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/recorder"
 	"golang.org/x/oauth2/google"
 	"k8s.io/klog/v2"
 
@@ -42,6 +43,7 @@ var (
 	testFlags = struct {
 		project        string
 		resourcePrefix string
+		record         string
 	}{
 		project:        "",
 		resourcePrefix: "k8scp-",
@@ -54,6 +56,7 @@ func init() {
 
 	flag.StringVar(&testFlags.project, "project", testFlags.project, "GCP project ID")
 	flag.StringVar(&testFlags.resourcePrefix, "resourcePrefix", testFlags.resourcePrefix, "Prefix used to name all resources created in the tests. Any resources with this prefix will be removed during cleanup.")
+	flag.StringVar(&testFlags.record, "record", testFlags.record, "If set, the API requests are recorded to this cassette file (see pkg/cloud/recorder).")
 
 	runID = fmt.Sprintf("%0x", rand.Int63()&0xffff)
 }
@@ -79,6 +82,11 @@ func TestMain(m *testing.M) {
 	if err != nil {
 		log.Fatal(err)
 	}
+	var rec *recorder.Recorder
+	if testFlags.record != "" {
+		rec = recorder.NewRecorder(client.Transport)
+		client.Transport = rec
+	}
 
 	alpha, err := alpha.New(client)
 	if err != nil {
@@ -102,7 +110,13 @@ func TestMain(m *testing.M) {
 	}
 	theCloud = cloud.NewGCE(svc)
 
-	os.Exit(m.Run())
+	code := m.Run()
+	if rec != nil {
+		if err := rec.Save(testFlags.record); err != nil {
+			log.Fatal(err)
+		}
+	}
+	os.Exit(code)
 }
 
 func checkErrCode(t *testing.T, err error, wantCode int, fmtStr string, args ...interface{}) {
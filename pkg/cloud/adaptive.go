@@ -0,0 +1,197 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	cerrors "github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/errors"
+)
+
+const (
+	defaultAdaptiveDecreaseFactor = 0.5
+	defaultAdaptiveCooldown       = time.Second
+)
+
+// AdaptiveRateLimiterConfig configures an AdaptiveRateLimiter. Zero values
+// select the defaults.
+type AdaptiveRateLimiterConfig struct {
+	// QPS is the initial and maximum rate for each project. Required.
+	QPS float64
+	// Burst is the maximum number of calls that can be made at once for a
+	// project. Default: 1.
+	Burst int
+	// MinQPS is the lowest rate the limiter backs off to. Default: QPS/100.
+	MinQPS float64
+	// DecreaseFactor multiplies the rate of a project when a call is
+	// rejected by the API rate limits. Must be in (0, 1). Default: 0.5.
+	DecreaseFactor float64
+	// IncreaseQPS is added to the rate of a project for each successful
+	// call, up to QPS. Default: QPS/100.
+	IncreaseQPS float64
+	// Cooldown is the minimum time between two decreases of the rate of a
+	// project. The calls that were already in flight when the rate was
+	// decreased are likely to be rejected as well; these do not decrease
+	// the rate again. Default: 1s.
+	Cooldown time.Duration
+}
+
+// NewAdaptiveRateLimiter returns an AdaptiveRateLimiter with the given
+// config.
+func NewAdaptiveRateLimiter(cfg AdaptiveRateLimiterConfig) (*AdaptiveRateLimiter, error) {
+	if cfg.QPS <= 0 || math.IsInf(cfg.QPS, 0) || math.IsNaN(cfg.QPS) {
+		return nil, fmt.Errorf("invalid AdaptiveRateLimiterConfig.QPS: %v", cfg.QPS)
+	}
+	if cfg.Burst == 0 {
+		cfg.Burst = 1
+	}
+	if cfg.MinQPS == 0 {
+		cfg.MinQPS = cfg.QPS / 100
+	}
+	if cfg.DecreaseFactor == 0 {
+		cfg.DecreaseFactor = defaultAdaptiveDecreaseFactor
+	}
+	if cfg.IncreaseQPS == 0 {
+		cfg.IncreaseQPS = cfg.QPS / 100
+	}
+	if cfg.Cooldown == 0 {
+		cfg.Cooldown = defaultAdaptiveCooldown
+	}
+	switch {
+	case cfg.Burst < 1:
+		return nil, fmt.Errorf("invalid AdaptiveRateLimiterConfig.Burst: %d", cfg.Burst)
+	case cfg.MinQPS <= 0 || cfg.MinQPS > cfg.QPS:
+		return nil, fmt.Errorf("invalid AdaptiveRateLimiterConfig.MinQPS: %v (must be in (0, %v])", cfg.MinQPS, cfg.QPS)
+	case cfg.DecreaseFactor <= 0 || cfg.DecreaseFactor >= 1:
+		return nil, fmt.Errorf("invalid AdaptiveRateLimiterConfig.DecreaseFactor: %v (must be in (0, 1))", cfg.DecreaseFactor)
+	case cfg.IncreaseQPS < 0:
+		return nil, fmt.Errorf("invalid AdaptiveRateLimiterConfig.IncreaseQPS: %v", cfg.IncreaseQPS)
+	case cfg.Cooldown < 0:
+		return nil, fmt.Errorf("invalid AdaptiveRateLimiterConfig.Cooldown: %v", cfg.Cooldown)
+	}
+	return &AdaptiveRateLimiter{
+		cfg:      cfg,
+		clock:    realClock{},
+		projects: map[string]*adaptiveProject{},
+	}, nil
+}
+
+// AdaptiveRateLimiter is a RateLimiter that adapts the rate of the calls to
+// the API rate limits using additive increase/multiplicative decrease
+// (AIMD). The calls to each project are limited with a token bucket. When
+// Observe() sees a call rejected by the rate limits (HTTP 429, or HTTP 403
+// with the reason "rateLimitExceeded" or "userRateLimitExceeded"), the rate
+// of the project is multiplied by DecreaseFactor; each successful call adds
+// IncreaseQPS to the rate until it is back to QPS. Other errors do not change
+// the rate.
+//
+// The state is kept separately for each project, so that the rate limits of
+// a project do not throttle the calls to the other projects.
+//
+// This object is thread-safe.
+type AdaptiveRateLimiter struct {
+	cfg   AdaptiveRateLimiterConfig
+	clock clock
+
+	lock     sync.Mutex
+	projects map[string]*adaptiveProject
+}
+
+// adaptiveProject is the state of a project.
+type adaptiveProject struct {
+	bucket *tokenBucket
+	// lastDecrease is the time the rate was last decreased.
+	lastDecrease time.Time
+}
+
+// project returns the state for the project of key, creating it if needed.
+// Caller must hold the lock.
+func (rl *AdaptiveRateLimiter) project(key *RateLimitKey) *adaptiveProject {
+	var projectID string
+	if key != nil {
+		projectID = key.ProjectID
+	}
+	p, ok := rl.projects[projectID]
+	if !ok {
+		p = &adaptiveProject{
+			bucket: &tokenBucket{
+				pattern: CallContextKey{ProjectID: projectID},
+				qps:     rl.cfg.QPS,
+				burst:   float64(rl.cfg.Burst),
+				tokens:  float64(rl.cfg.Burst),
+				last:    rl.clock.Now(),
+			},
+		}
+		rl.projects[projectID] = p
+	}
+	return p
+}
+
+// Accept implements RateLimiter.
+func (rl *AdaptiveRateLimiter) Accept(ctx context.Context, key *RateLimitKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	rl.lock.Lock()
+	p := rl.project(key)
+	return waitForToken(ctx, rl.clock, &rl.lock, p.bucket, key)
+}
+
+// Observe implements RateLimiter. It decreases the rate of the project when
+// err is a rate limit error and increases it when err is nil.
+func (rl *AdaptiveRateLimiter) Observe(ctx context.Context, err error, key *RateLimitKey) {
+	rateLimited := cerrors.IsRateLimited(err)
+	if err != nil && !rateLimited {
+		return
+	}
+
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	p := rl.project(key)
+	now := rl.clock.Now()
+	qps := p.bucket.qps
+	if rateLimited {
+		if !p.lastDecrease.IsZero() && now.Sub(p.lastDecrease) < rl.cfg.Cooldown {
+			return
+		}
+		p.lastDecrease = now
+		qps = math.Max(rl.cfg.MinQPS, qps*rl.cfg.DecreaseFactor)
+		klog.V(4).Infof("AdaptiveRateLimiter.Observe(%v, %v, %+v): decreasing QPS %v => %v", ctx, err, key, p.bucket.qps, qps)
+	} else {
+		qps = math.Min(rl.cfg.QPS, qps+rl.cfg.IncreaseQPS)
+	}
+	p.bucket.setQPS(now, qps)
+}
+
+// QPS returns the current rate for the project.
+func (rl *AdaptiveRateLimiter) QPS(projectID string) float64 {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	if p, ok := rl.projects[projectID]; ok {
+		return p.bucket.qps
+	}
+	return rl.cfg.QPS
+}
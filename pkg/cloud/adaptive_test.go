@@ -0,0 +1,200 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+func newTestAdaptiveRateLimiter(t *testing.T, cfg AdaptiveRateLimiterConfig) (*AdaptiveRateLimiter, *fakeClock) {
+	t.Helper()
+	rl, err := NewAdaptiveRateLimiter(cfg)
+	if err != nil {
+		t.Fatalf("NewAdaptiveRateLimiter(%+v) = %v, want nil", cfg, err)
+	}
+	fc := newFakeClock()
+	rl.clock = fc
+	return rl, fc
+}
+
+func TestNewAdaptiveRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name    string
+		cfg     AdaptiveRateLimiterConfig
+		wantErr bool
+	}{
+		{name: "defaults", cfg: AdaptiveRateLimiterConfig{QPS: 10}},
+		{name: "all set", cfg: AdaptiveRateLimiterConfig{QPS: 10, Burst: 5, MinQPS: 1, DecreaseFactor: 0.8, IncreaseQPS: 1, Cooldown: time.Minute}},
+		{name: "no QPS", cfg: AdaptiveRateLimiterConfig{}, wantErr: true},
+		{name: "negative burst", cfg: AdaptiveRateLimiterConfig{QPS: 10, Burst: -1}, wantErr: true},
+		{name: "MinQPS > QPS", cfg: AdaptiveRateLimiterConfig{QPS: 10, MinQPS: 20}, wantErr: true},
+		{name: "negative MinQPS", cfg: AdaptiveRateLimiterConfig{QPS: 10, MinQPS: -1}, wantErr: true},
+		{name: "DecreaseFactor >= 1", cfg: AdaptiveRateLimiterConfig{QPS: 10, DecreaseFactor: 1}, wantErr: true},
+		{name: "negative Cooldown", cfg: AdaptiveRateLimiterConfig{QPS: 10, Cooldown: -time.Second}, wantErr: true},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := NewAdaptiveRateLimiter(tc.cfg)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("NewAdaptiveRateLimiter(%+v) = %v; gotErr = %t, want %t", tc.cfg, err, gotErr, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestAdaptiveRateLimiterObserve(t *testing.T) {
+	t.Parallel()
+
+	errTooMany := &googleapi.Error{Code: http.StatusTooManyRequests}
+	errRateLimit := &googleapi.Error{
+		Code:   http.StatusForbidden,
+		Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}},
+	}
+	errUserRateLimit := &googleapi.Error{
+		Code:   http.StatusForbidden,
+		Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}},
+	}
+	errForbidden := &googleapi.Error{
+		Code:   http.StatusForbidden,
+		Errors: []googleapi.ErrorItem{{Reason: "forbidden"}},
+	}
+	errNotFound := &googleapi.Error{Code: http.StatusNotFound}
+
+	type observation struct {
+		advance time.Duration
+		err     error
+	}
+	for _, tc := range []struct {
+		name string
+		obs  []observation
+		want float64
+	}{
+		{name: "initial", want: 10},
+		{name: "success at max", obs: []observation{{}, {}}, want: 10},
+		{name: "429", obs: []observation{{err: errTooMany}}, want: 5},
+		{name: "403 rateLimitExceeded", obs: []observation{{err: errRateLimit}}, want: 5},
+		{name: "403 userRateLimitExceeded", obs: []observation{{err: errUserRateLimit}}, want: 5},
+		{name: "wrapped", obs: []observation{{err: errors.Join(errors.New("x"), errTooMany)}}, want: 5},
+		{name: "other 403", obs: []observation{{err: errForbidden}}, want: 10},
+		{name: "404", obs: []observation{{err: errNotFound}}, want: 10},
+		{name: "canceled", obs: []observation{{err: context.Canceled}}, want: 10},
+		{
+			name: "cooldown",
+			obs:  []observation{{err: errTooMany}, {advance: 500 * time.Millisecond, err: errTooMany}},
+			want: 5,
+		},
+		{
+			name: "after cooldown",
+			obs:  []observation{{err: errTooMany}, {advance: time.Second, err: errTooMany}},
+			want: 2.5,
+		},
+		{
+			name: "MinQPS",
+			obs: []observation{
+				{err: errTooMany},
+				{advance: time.Second, err: errTooMany},
+				{advance: time.Second, err: errTooMany},
+				{advance: time.Second, err: errTooMany},
+			},
+			want: 2,
+		},
+		{
+			name: "additive increase",
+			obs:  []observation{{err: errTooMany}, {}, {}, {}},
+			want: 8,
+		},
+		{
+			name: "recover to QPS",
+			obs:  []observation{{err: errTooMany}, {}, {}, {}, {}, {}, {}, {}},
+			want: 10,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			rl, fc := newTestAdaptiveRateLimiter(t, AdaptiveRateLimiterConfig{QPS: 10, MinQPS: 2, IncreaseQPS: 1})
+			key := &RateLimitKey{ProjectID: "proj", Operation: "Get", Version: "ga", Service: "Addresses"}
+			for _, o := range tc.obs {
+				fc.Advance(o.advance)
+				rl.Observe(context.Background(), o.err, key)
+			}
+			if got := rl.QPS("proj"); got != tc.want {
+				t.Errorf("QPS() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAdaptiveRateLimiterAccept(t *testing.T) {
+	t.Parallel()
+
+	rl, fc := newTestAdaptiveRateLimiter(t, AdaptiveRateLimiterConfig{QPS: 10})
+	ctx := context.Background()
+	key := &RateLimitKey{ProjectID: "proj"}
+	otherKey := &RateLimitKey{ProjectID: "other"}
+
+	// accept the call for key and returns how long it waited.
+	accept := func(key *RateLimitKey) time.Duration {
+		t.Helper()
+		start := fc.Now()
+		done := make(chan error, 1)
+		go func() { done <- rl.Accept(ctx, key) }()
+		for {
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatalf("Accept(%+v) = %v, want nil", key, err)
+				}
+				return fc.Now().Sub(start)
+			default:
+			}
+			if fc.pendingTimers() > 0 {
+				fc.Advance(10 * time.Millisecond)
+			} else {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+
+	accept(key)
+	if got := accept(key); got != 100*time.Millisecond {
+		t.Errorf("accept() waited %v, want 100ms", got)
+	}
+
+	rl.Observe(ctx, &googleapi.Error{Code: http.StatusTooManyRequests}, key)
+	if got := accept(key); got != 200*time.Millisecond {
+		t.Errorf("accept() after backoff waited %v, want 200ms", got)
+	}
+
+	// The other project is not throttled.
+	if got := rl.QPS("other"); got != 10 {
+		t.Errorf("QPS(other) = %v, want 10", got)
+	}
+	accept(otherKey)
+	if got := accept(otherKey); got != 100*time.Millisecond {
+		t.Errorf("accept(other) waited %v, want 100ms", got)
+	}
+}
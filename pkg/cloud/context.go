@@ -43,4 +43,12 @@ type CallContextKey struct {
 	Version meta.Version
 	// Service is the service being invoked (e.g. "Firewalls", "BackendServices")
 	Service string
+	// Key of the resource targeted by the call. For List calls, only the
+	// location (Zone or Region) is set. Key is the zero value for calls that
+	// do not target a resource or a location, e.g. global List and
+	// AggregatedList.
+	Key meta.Key
+	// Mutation is true if the call modifies the resource, i.e. it starts
+	// an operation.
+	Mutation bool
 }
@@ -35,10 +35,60 @@ limitations under the License.
 //  // Run foo with a mock.
 //  foo(NewMockGCE())
 //
+// Paging
+//
+// List, AggregatedList, ListUsable and the paged additional methods (e.g.
+// ListNetworkEndpoints) return all of the results at once. Each of these also
+// has a "xxxPages" variant that calls a function for each page and a
+// "xxxIterator" variant that returns a PageIterator. Each page is a separate,
+// rate limited call. Return ErrStopPaging from the function to stop early.
+//
+//  err := cloud.Firewalls().ListPages(ctx, filter.None, &ListOptions{MaxResults: 100}, func(page []*ga.Firewall) error {
+//    ...
+//  })
+//
+// Asynchronous operations
+//
+// Insert, Delete and the additional methods that return a long-running
+// operation (e.g. SetTarget) wait for the operation to complete. Each of these
+// also has a "xxxAsync" variant that returns an Operation handle as soon as
+// the operation has been started. Operation.Ref() returns a serializable
+// reference that can be given to Cloud.ResumeOperation() to wait for the
+// operation later, e.g. after a controller restart.
+//
+//  op, err := cloud.Firewalls().InsertAsync(ctx, key, fw)
+//  ...
+//  err = op.Wait(ctx)
+//
+// By default, each operation is polled separately. With many operations in
+// flight, set Service.OperationMode to OperationModeBatch to poll them
+// together with a shared poller. See OperationMode.
+//
 // Rate limiting and routing
 //
 // The generated code allows for custom policies for operation rate limiting
 // and GCE project routing. See RateLimiter and ProjectRouter for more details.
+// TokenBucketRateLimiter limits the calls with a token bucket per key, with
+// the QPS and burst configured per pattern of CallContextKey.
+// AdaptiveRateLimiter backs off the rate for a project when the calls are
+// rejected by the API rate limits and recovers when they succeed.
+//
+// Tracing
+//
+// The generated calls create OpenCensus trace spans, with the trace context
+// taken from the ctx of the call. Each call has a span with child spans for
+// the rate limiter wait and the request; Operation.Wait() has a span with a
+// child span for each poll of the operation, which is a child of the call
+// span for the synchronous methods (e.g. Insert). See SpanRequest for the
+// names of the spans.
+//
+// Observers and interceptors
+//
+// CallObservers (Service.CallObservers and WithCallObserver()) are notified
+// of the start and end of the calls and, optionally, of the rate limiter
+// waits and operation polls. Interceptors (Service.Interceptors) wrap the
+// requests of the calls: they can modify the request object and headers,
+// inspect the result or return a result without making the request.
 //
 // Mocks
 //
@@ -52,6 +102,19 @@ limitations under the License.
 // objects, i.e. an alpha object will be visible with beta and GA methods.
 // Note that translation is done with JSON serialization between the API versions.
 //
+// If no hook is set, the Update, Patch and SetLabels methods replace or merge
+// the stored object and assign a new fingerprint. A request with a stale
+// fingerprint is rejected with 412 Precondition Failed.
+//
+// By default, mutations in the mocks are applied synchronously. Call
+// MockGCE.EnableOperations() to model long-running operations instead (with
+// configurable latency and injected operation errors). See MockOperations.
+// Similarly, MockGCE.EnableReferences() makes the mocks reject deleting objects
+// that are in use and inserting objects with dangling references. See
+// MockReferences. MockGCE.EnableDefaults() populates the server-side defaults
+// and output-only fields (Id, CreationTimestamp, Kind, ...) on Insert. See
+// MockDefaults.
+//
 // Changing service code generation
 //
 // The list of services to generate is contained in "meta/meta.go". To add a
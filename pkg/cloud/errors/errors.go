@@ -0,0 +1,166 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package errors classifies the errors returned by the GCE API. The functions
+// understand the HTTP status code, the reasons in googleapi.Error.Errors,
+// the ErrorInfo reasons in googleapi.Error.Details and the error codes of
+// failed operations (cloud.OperationError), e.g.
+// "RESOURCE_IN_USE_BY_ANOTHER_RESOURCE". Wrapped errors are unwrapped with
+// errors.As(). The mocks in pkg/cloud and pkg/cloud/mock return errors that
+// are classified in the same way as the errors from GCE.
+//
+//	import cerrors "github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/errors"
+//
+//	err := gce.BackendServices().Delete(ctx, key)
+//	switch {
+//	case cerrors.IsNotFound(err):
+//		// Already deleted.
+//	case cerrors.IsInUse(err):
+//		// Delete the users first.
+//	}
+package errors
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+)
+
+// Reasons used in googleapi.ErrorItem.Reason by GCE. Operation error codes
+// are the same reasons in upper snake case, e.g. "QUOTA_EXCEEDED" for
+// ReasonQuotaExceeded; both forms are recognized.
+const (
+	ReasonNotFound              = "notFound"
+	ReasonAlreadyExists         = "alreadyExists"
+	ReasonInUse                 = "resourceInUseByAnotherResource"
+	ReasonConditionNotMet       = "conditionNotMet"
+	ReasonQuotaExceeded         = "quotaExceeded"
+	ReasonRateLimitExceeded     = "rateLimitExceeded"
+	ReasonUserRateLimitExceeded = "userRateLimitExceeded"
+	ReasonResourceNotReady      = "resourceNotReady"
+	ReasonBackendError          = "backendError"
+	ReasonInternalError         = "internalError"
+	ReasonForbidden             = "forbidden"
+)
+
+// IsNotFound returns true if the resource does not exist (HTTP 404).
+func IsNotFound(err error) bool {
+	return is(err, []int{http.StatusNotFound}, ReasonNotFound, "resourceNotFound")
+}
+
+// IsConflict returns true if the resource already exists or the request
+// conflicts with another change (HTTP 409).
+func IsConflict(err error) bool {
+	return is(err, []int{http.StatusConflict}, ReasonAlreadyExists, "resourceAlreadyExists")
+}
+
+// IsInUse returns true if the resource cannot be deleted because it is used
+// by another resource.
+func IsInUse(err error) bool {
+	return is(err, nil, ReasonInUse)
+}
+
+// IsQuotaExceeded returns true if the request failed because a resource
+// quota (e.g. the number of CPUs in a region) was exceeded. This is not the
+// same as IsRateLimited().
+func IsQuotaExceeded(err error) bool {
+	return is(err, nil, ReasonQuotaExceeded)
+}
+
+// IsForbidden returns true if the caller does not have the permission for
+// the request. Rate limit and quota errors also use HTTP 403 and are not
+// forbidden errors, see IsRateLimited() and IsQuotaExceeded().
+func IsForbidden(err error) bool {
+	return is(err, nil, ReasonForbidden)
+}
+
+// IsRateLimited returns true if the request was rejected by API rate limits
+// (HTTP 429 or HTTP 403 with a rate limit reason).
+func IsRateLimited(err error) bool {
+	return is(err, []int{http.StatusTooManyRequests}, ReasonRateLimitExceeded, ReasonUserRateLimitExceeded)
+}
+
+// IsPreconditionFailed returns true if a precondition of the request, such
+// as the fingerprint of the resource, did not match (HTTP 412).
+func IsPreconditionFailed(err error) bool {
+	return is(err, []int{http.StatusPreconditionFailed}, ReasonConditionNotMet)
+}
+
+// IsRetryable returns true if err is transient and the request can be
+// retried as is: rate limits, HTTP 5xx and transient reasons such as
+// "resourceNotReady".
+func IsRetryable(err error) bool {
+	if IsRateLimited(err) {
+		return true
+	}
+	codes := []int{
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+	return is(err, codes, ReasonResourceNotReady, ReasonBackendError, ReasonInternalError)
+}
+
+// is returns true if err is a *googleapi.Error with one of the codes or
+// reasons.
+func is(err error, codes []int, reasons ...string) bool {
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) {
+		return false
+	}
+	for _, c := range codes {
+		if gerr.Code == c {
+			return true
+		}
+	}
+	want := map[string]bool{}
+	for _, r := range reasons {
+		want[normalize(r)] = true
+	}
+	for _, r := range errorReasons(gerr) {
+		if want[normalize(r)] {
+			return true
+		}
+	}
+	return false
+}
+
+// errorReasons returns the reasons in gerr.Errors and the ErrorInfo reasons
+// in gerr.Details.
+func errorReasons(gerr *googleapi.Error) []string {
+	var ret []string
+	for _, item := range gerr.Errors {
+		ret = append(ret, item.Reason)
+	}
+	for _, d := range gerr.Details {
+		if m, ok := d.(map[string]interface{}); ok {
+			if r, ok := m["reason"].(string); ok {
+				ret = append(ret, r)
+			}
+		}
+	}
+	return ret
+}
+
+// normalize the reason so that the camel case reasons (e.g.
+// "resourceNotReady") and the upper snake case operation error codes (e.g.
+// "RESOURCE_NOT_READY") are the same.
+func normalize(reason string) string {
+	return strings.ToLower(strings.ReplaceAll(reason, "_", ""))
+}
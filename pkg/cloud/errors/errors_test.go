@@ -0,0 +1,211 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package errors_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	ga "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	cerrors "github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/errors"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/mock"
+)
+
+// class is the set of helpers that return true for an error.
+type class struct {
+	notFound, conflict, inUse, forbidden, quota, rateLimited, precondition, retryable bool
+}
+
+func classify(err error) class {
+	return class{
+		notFound:     cerrors.IsNotFound(err),
+		conflict:     cerrors.IsConflict(err),
+		inUse:        cerrors.IsInUse(err),
+		forbidden:    cerrors.IsForbidden(err),
+		quota:        cerrors.IsQuotaExceeded(err),
+		rateLimited:  cerrors.IsRateLimited(err),
+		precondition: cerrors.IsPreconditionFailed(err),
+		retryable:    cerrors.IsRetryable(err),
+	}
+}
+
+func reasonErr(code int, reason string) error {
+	return &googleapi.Error{Code: code, Errors: []googleapi.ErrorItem{{Reason: reason}}}
+}
+
+func operationErr(code int, errCode string) error {
+	return &cloud.OperationError{
+		Name:           "op",
+		HTTPStatusCode: code,
+		Errors:         []*ga.OperationErrorErrors{{Code: errCode, Message: "msg"}},
+	}
+}
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		want class
+	}{
+		{name: "nil"},
+		{name: "not an API error", err: errors.New("x")},
+		{name: "400", err: &googleapi.Error{Code: http.StatusBadRequest}},
+		{name: "404", err: &googleapi.Error{Code: http.StatusNotFound}, want: class{notFound: true}},
+		{name: "409", err: &googleapi.Error{Code: http.StatusConflict}, want: class{conflict: true}},
+		{name: "412", err: &googleapi.Error{Code: http.StatusPreconditionFailed}, want: class{precondition: true}},
+		{name: "429", err: &googleapi.Error{Code: http.StatusTooManyRequests}, want: class{rateLimited: true, retryable: true}},
+		{name: "500", err: &googleapi.Error{Code: http.StatusInternalServerError}, want: class{retryable: true}},
+		{name: "503", err: &googleapi.Error{Code: http.StatusServiceUnavailable}, want: class{retryable: true}},
+		{name: "in use", err: reasonErr(http.StatusBadRequest, "resourceInUseByAnotherResource"), want: class{inUse: true}},
+		{name: "quota", err: reasonErr(http.StatusForbidden, "quotaExceeded"), want: class{quota: true}},
+		{name: "rate limit", err: reasonErr(http.StatusForbidden, "rateLimitExceeded"), want: class{rateLimited: true, retryable: true}},
+		{name: "user rate limit", err: reasonErr(http.StatusForbidden, "userRateLimitExceeded"), want: class{rateLimited: true, retryable: true}},
+		{name: "not ready", err: reasonErr(http.StatusBadRequest, "resourceNotReady"), want: class{retryable: true}},
+		{name: "forbidden", err: reasonErr(http.StatusForbidden, "forbidden"), want: class{forbidden: true}},
+		{
+			name: "ErrorInfo detail",
+			err: &googleapi.Error{
+				Code:    http.StatusForbidden,
+				Details: []interface{}{map[string]interface{}{"@type": "type.googleapis.com/google.rpc.ErrorInfo", "reason": "RATE_LIMIT_EXCEEDED"}},
+			},
+			want: class{rateLimited: true, retryable: true},
+		},
+		{name: "operation in use", err: operationErr(http.StatusBadRequest, "RESOURCE_IN_USE_BY_ANOTHER_RESOURCE"), want: class{inUse: true}},
+		{name: "operation quota", err: operationErr(http.StatusForbidden, "QUOTA_EXCEEDED"), want: class{quota: true}},
+		{name: "operation not ready", err: operationErr(http.StatusBadRequest, "RESOURCE_NOT_READY"), want: class{retryable: true}},
+		{name: "operation 404", err: operationErr(http.StatusNotFound, "RESOURCE_NOT_FOUND"), want: class{notFound: true}},
+		{name: "wrapped", err: fmt.Errorf("wrapped: %w", &googleapi.Error{Code: http.StatusNotFound}), want: class{notFound: true}},
+		{name: "wrapped operation", err: fmt.Errorf("wrapped: %w", operationErr(http.StatusConflict, "RESOURCE_ALREADY_EXISTS")), want: class{conflict: true}},
+		{name: "mock InUseError", err: mock.InUseError, want: class{inUse: true}},
+		{name: "mock InternalServerError", err: mock.InternalServerError, want: class{retryable: true}},
+		{name: "mock UnauthorizedErr", err: mock.UnauthorizedErr, want: class{forbidden: true}},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if got := classify(tc.err); got != tc.want {
+				t.Errorf("classify(%v) = %+v, want %+v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestClassifyMockErrors(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	m := cloud.NewMockGCE(&cloud.SingleProjectRouter{ID: "proj"})
+	m.EnableOperations(cloud.NewMockOperations())
+	m.EnableReferences(cloud.NewMockReferences())
+
+	hcKey := meta.GlobalKey("hc")
+	bsKey := meta.GlobalKey("bs")
+	_, err := m.HealthChecks().Get(ctx, hcKey)
+	if !cerrors.IsNotFound(err) {
+		t.Errorf("Get() = %v; IsNotFound() = false, want true", err)
+	}
+
+	if err := m.HealthChecks().Insert(ctx, hcKey, &ga.HealthCheck{}); err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+	err = m.HealthChecks().Insert(ctx, hcKey, &ga.HealthCheck{})
+	if !cerrors.IsConflict(err) {
+		t.Errorf("Insert() = %v; IsConflict() = false, want true", err)
+	}
+
+	bs := &ga.BackendService{HealthChecks: []string{cloud.SelfLink(meta.VersionGA, "proj", "healthChecks", hcKey)}}
+	if err := m.BackendServices().Insert(ctx, bsKey, bs); err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+	err = m.HealthChecks().Delete(ctx, hcKey)
+	if !cerrors.IsInUse(err) {
+		t.Errorf("Delete() = %v; IsInUse() = false, want true", err)
+	}
+
+	err = m.BackendServices().Update(ctx, bsKey, &ga.BackendService{Fingerprint: "stale"})
+	if !cerrors.IsPreconditionFailed(err) {
+		t.Errorf("Update() = %v; IsPreconditionFailed() = false, want true", err)
+	}
+
+	m.Operations.Errors[cloud.MockOperationKey{Service: "BackendServices", Method: "Delete", Key: *bsKey}] = &cloud.MockOperationError{
+		HTTPStatusCode: http.StatusForbidden,
+		Code:           "QUOTA_EXCEEDED",
+		Message:        "quota",
+	}
+	err = m.BackendServices().Delete(ctx, bsKey)
+	if !cerrors.IsQuotaExceeded(err) {
+		t.Errorf("Delete() = %v; IsQuotaExceeded() = false, want true", err)
+	}
+
+	// Errors from hooks are classified by their HTTP status.
+	m.MockAddresses.DeleteHook = mock.DeleteAddressesNotFoundErrHook
+	err = m.Addresses().Delete(ctx, meta.RegionalKey("addr", "us-central1"))
+	if !cerrors.IsNotFound(err) {
+		t.Errorf("Delete() = %v; IsNotFound() = false, want true", err)
+	}
+}
+
+func TestClassifyMockHookErrors(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	m := cloud.NewMockGCE(&cloud.SingleProjectRouter{ID: "proj"})
+	m.MockAddresses.X = mock.AddressAttributes{}
+	m.MockAddresses.InsertHook = mock.InsertAddressHook
+	m.MockFirewalls.InsertHook = mock.InsertFirewallsUnauthorizedErrHook
+	m.MockFirewalls.UpdateHook = mock.UpdateFirewallsUnauthorizedErrHook
+	m.MockFirewalls.DeleteHook = mock.DeleteFirewallsUnauthorizedErrHook
+	m.MockFirewalls.GetHook = mock.GetFirewallsUnauthorizedErrHook
+
+	for _, addrType := range []cloud.LbScheme{cloud.SchemeExternal, cloud.SchemeInternal} {
+		key1 := meta.RegionalKey("addr1-"+string(addrType), "us-central1")
+		key2 := meta.RegionalKey("addr2-"+string(addrType), "us-central1")
+		if err := m.Addresses().Insert(ctx, key1, &ga.Address{Address: "10.0.0.1", AddressType: string(addrType)}); err != nil {
+			t.Fatalf("Insert(%v) = %v, want nil", key1, err)
+		}
+		err := m.Addresses().Insert(ctx, key2, &ga.Address{Address: "10.0.0.1", AddressType: string(addrType)})
+		if !cerrors.IsInUse(err) {
+			t.Errorf("Insert(%v) = %v; IsInUse() = false, want true", key2, err)
+		}
+		delete(m.MockAddresses.Objects, *key1)
+	}
+
+	fwKey := meta.GlobalKey("fw")
+	for _, tc := range []struct {
+		name string
+		f    func() error
+	}{
+		{"Insert", func() error { return m.Firewalls().Insert(ctx, fwKey, &ga.Firewall{}) }},
+		{"Update", func() error { return m.Firewalls().Update(ctx, fwKey, &ga.Firewall{}) }},
+		{"Delete", func() error { return m.Firewalls().Delete(ctx, fwKey) }},
+		{"Get", func() error { _, err := m.Firewalls().Get(ctx, fwKey); return err }},
+	} {
+		err := tc.f()
+		if got, want := classify(err), (class{forbidden: true}); got != want {
+			t.Errorf("%s() = %v; classify() = %+v, want %+v", tc.name, err, got, want)
+		}
+	}
+}
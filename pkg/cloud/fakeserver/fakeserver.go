@@ -0,0 +1,577 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fakeserver implements a local HTTP server for the GCE compute API
+// (v1, alpha and beta) that is backed by a cloud.MockGCE. This allows the real
+// cloud.GCE implementation (rate limiting, operation polling, filter
+// rendering, etc.) to be tested end-to-end without access to GCE.
+//
+//	mock := cloud.NewMockGCE(&cloud.SingleProjectRouter{ID: "my-project"})
+//	srv := fakeserver.New(mock)
+//	defer srv.Close()
+//
+//	svc, err := srv.Service(ctx, &cloud.SingleProjectRouter{ID: "my-project"})
+//	gce := cloud.NewGCE(svc)
+//	gce.Addresses().Insert(ctx, key, &ga.Address{...})
+//
+// Mutations return operations that are tracked by the cloud.MockOperations of
+// the mock (operations will be enabled on the mock if they are not already).
+//
+// The links in the responses (SelfLink, TargetLink, references to other
+// objects, etc.) refer to the Server, i.e. they can be followed with the
+// clients of Service().
+package fakeserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/googleapi"
+	"k8s.io/klog/v2"
+
+	ga "google.golang.org/api/compute/v1"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+)
+
+// pathVersions maps the version in the URL to the API version.
+var pathVersions = map[string]meta.Version{
+	"v1":    meta.VersionGA,
+	"alpha": meta.VersionAlpha,
+	"beta":  meta.VersionBeta,
+}
+
+// Request is a request that was received by the Server.
+type Request struct {
+	Method string
+	// Path of the request, e.g. "/compute/v1/projects/p/global/addresses".
+	Path   string
+	Query  url.Values
+	Header http.Header
+}
+
+// Server is a fake compute API server. Create with New().
+type Server struct {
+	// Mock is the backing store for the objects.
+	Mock *cloud.MockGCE
+
+	ts *httptest.Server
+
+	lock     sync.Mutex
+	requests []Request
+}
+
+// New starts a new Server serving the objects in mock. Close() must be called
+// to shutdown the server.
+func New(mock *cloud.MockGCE) *Server {
+	if mock.Operations == nil {
+		mock.EnableOperations(cloud.NewMockOperations())
+	}
+	s := &Server{Mock: mock}
+	s.ts = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// URL of the server, e.g. "http://127.0.0.1:1234".
+func (s *Server) URL() string { return s.ts.URL }
+
+// Close the server.
+func (s *Server) Close() { s.ts.Close() }
+
+// Requests returns the requests received by the Server so far.
+func (s *Server) Requests() []Request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]Request{}, s.requests...)
+}
+
+// Service returns a cloud.Service with GA, Alpha and Beta clients that send
+// requests to the Server.
+func (s *Server) Service(ctx context.Context, pr cloud.ProjectRouter) (*cloud.Service, error) {
+	return cloud.NewServiceForEndpoint(ctx, s.ts.URL, s.ts.Client(), pr)
+}
+
+// route is the parsed form of a request URL.
+type route struct {
+	version   meta.Version
+	projectID string
+	resource  string
+	// scope of the request (key without the name for collections).
+	key *meta.Key
+	// hasName is true if the URL refers to a specific object.
+	hasName bool
+	// method is the custom method (e.g. "setSecurityPolicy" or "wait").
+	method     string
+	aggregated bool
+}
+
+// parsePath parses URLs of the form
+// "/compute/<ver>/projects/<proj>/<scope>/<resource>[/<name>[/<method>]]".
+func parsePath(path string) (*route, error) {
+	errNotValid := fmt.Errorf("invalid path %q", path)
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 6 || parts[0] != "compute" || parts[2] != "projects" {
+		return nil, errNotValid
+	}
+	r := &route{projectID: parts[3]}
+	var ok bool
+	if r.version, ok = pathVersions[parts[1]]; !ok {
+		return nil, errNotValid
+	}
+
+	rest := parts[4:]
+	switch rest[0] {
+	case "aggregated":
+		if len(rest) != 2 {
+			return nil, errNotValid
+		}
+		r.aggregated = true
+		r.resource = rest[1]
+		return r, nil
+	case "global":
+		r.key = meta.GlobalKey("")
+		rest = rest[1:]
+	case "regions", "zones":
+		if len(rest) < 3 {
+			return nil, errNotValid
+		}
+		if rest[0] == "regions" {
+			r.key = meta.RegionalKey("", rest[1])
+		} else {
+			r.key = meta.ZonalKey("", rest[1])
+		}
+		rest = rest[2:]
+	default:
+		return nil, errNotValid
+	}
+
+	switch len(rest) {
+	case 1:
+		r.resource = rest[0]
+	case 3:
+		r.method = rest[2]
+		fallthrough
+	case 2:
+		r.resource = rest[0]
+		r.key.Name = rest[1]
+		r.hasName = true
+		// Validate the object path with the canonical parser.
+		id, err := cloud.ParseResourceURL(cloud.RelativeResourceName(r.projectID, r.resource, r.key))
+		if err != nil {
+			return nil, err
+		}
+		r.key = id.Key
+	default:
+		return nil, errNotValid
+	}
+	return r, nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	s.lock.Lock()
+	s.requests = append(s.requests, Request{Method: req.Method, Path: req.URL.Path, Query: req.URL.Query(), Header: req.Header.Clone()})
+	s.lock.Unlock()
+
+	resp, err := s.handle(req)
+	klog.V(5).Infof("fakeserver: %s %s = %+v, %v", req.Method, req.URL, resp, err)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	b, err := json.Marshal(resp)
+	if err != nil {
+		klog.Errorf("fakeserver: error encoding response: %v", err)
+		writeError(w, err)
+		return
+	}
+	// The mock generates the links with cloud.SelfLink(), rewrite them to
+	// refer to the Server.
+	b = bytes.ReplaceAll(b, []byte(`"`+apiPrefix()), []byte(`"`+s.ts.URL+"/compute/"))
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(append(b, '\n')); err != nil {
+		klog.Errorf("fakeserver: error writing response: %v", err)
+	}
+}
+
+// apiPrefix returns the prefix of the links generated by cloud.SelfLink(),
+// e.g. "https://www.googleapis.com/compute/" (see cloud.SetAPIDomain()).
+func apiPrefix() string {
+	link := cloud.SelfLink(meta.VersionGA, "p", "r", meta.GlobalKey("n"))
+	return strings.TrimSuffix(link, "v1/projects/p/global/r/n")
+}
+
+func (s *Server) handle(req *http.Request) (any, error) {
+	r, err := parsePath(req.URL.Path)
+	if err != nil {
+		return nil, &googleapi.Error{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	ctx := req.Context()
+
+	if r.resource == "operations" && !r.hasName && req.Method == http.MethodGet && !r.aggregated {
+		fl, err := parseFilter(req)
+		if err != nil {
+			return nil, err
+		}
+		ops, err := s.Mock.Operations.List(ctx, r.projectID, r.key, fl)
+		if err != nil {
+			return nil, err
+		}
+		return paginate(reflect.ValueOf(ops), req)
+	}
+	if r.resource == "operations" && r.hasName {
+		ops := s.Mock.Operations
+		var op *ga.Operation
+		switch {
+		case req.Method == http.MethodGet && r.method == "":
+			op, err = ops.Get(ctx, r.projectID, r.key)
+		case req.Method == http.MethodPost && r.method == "wait":
+			op, err = ops.Wait(ctx, r.projectID, r.key)
+		default:
+			return nil, errNotSupported(req)
+		}
+		return op, err
+	}
+
+	svc, err := s.service(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case r.aggregated && req.Method == http.MethodGet:
+		return s.aggregatedList(ctx, svc, r, req)
+	case !r.hasName && req.Method == http.MethodGet:
+		return s.list(ctx, svc, r, req)
+	case !r.hasName && req.Method == http.MethodPost:
+		return s.insert(ctx, svc, r, req)
+	case r.hasName && r.method == "" && req.Method == http.MethodGet:
+		return call(svc.wrapper, "Get", reflect.ValueOf(ctx), reflect.ValueOf(r.key))
+	case r.hasName && r.method == "" && req.Method == http.MethodDelete:
+		return s.mutate(ctx, svc, r, "Delete", reflect.ValueOf(ctx), reflect.ValueOf(r.key))
+	case r.hasName && r.method != "":
+		return s.customMethod(ctx, svc, r, req)
+	}
+	return nil, errNotSupported(req)
+}
+
+// service is a mock service that corresponds to the request.
+type service struct {
+	info    *meta.ServiceInfo
+	wrapper reflect.Value
+}
+
+// service finds the service corresponding to the route.
+func (s *Server) service(r *route) (*service, error) {
+	for _, si := range meta.AllServices {
+		if si.Version() != r.version || si.Resource != r.resource {
+			continue
+		}
+		if !r.aggregated {
+			switch r.key.Type() {
+			case meta.Global:
+				if !si.KeyIsGlobal() {
+					continue
+				}
+			case meta.Regional:
+				if !si.KeyIsRegional() {
+					continue
+				}
+			case meta.Zonal:
+				if !si.KeyIsZonal() {
+					continue
+				}
+			}
+		} else if !si.AggregatedList() {
+			continue
+		}
+		m := reflect.ValueOf(s.Mock).MethodByName(si.WrapType())
+		if !m.IsValid() {
+			break
+		}
+		return &service{info: si, wrapper: m.Call(nil)[0]}, nil
+	}
+	return nil, &googleapi.Error{
+		Code:    http.StatusNotFound,
+		Message: fmt.Sprintf("fakeserver: no service for %s %q (%v)", r.version, r.resource, r.key),
+	}
+}
+
+func (s *Server) list(ctx context.Context, svc *service, r *route, req *http.Request) (any, error) {
+	fl, err := parseFilter(req)
+	if err != nil {
+		return nil, err
+	}
+	args := []reflect.Value{reflect.ValueOf(ctx)}
+	switch r.key.Type() {
+	case meta.Regional:
+		args = append(args, reflect.ValueOf(r.key.Region))
+	case meta.Zonal:
+		args = append(args, reflect.ValueOf(r.key.Zone))
+	}
+	args = append(args, reflect.ValueOf(fl))
+
+	items, err := call(svc.wrapper, "List", args...)
+	if err != nil {
+		return nil, err
+	}
+	return paginate(reflect.ValueOf(items), req)
+}
+
+// paginate returns the page of items requested with the maxResults and
+// pageToken parameters. Items are sorted by name so that the pages are
+// stable between requests; the page token is the offset of the page.
+func paginate(items reflect.Value, req *http.Request) (any, error) {
+	q := req.URL.Query()
+	if q.Get("maxResults") == "" && q.Get("pageToken") == "" {
+		return map[string]any{"items": items.Interface()}, nil
+	}
+	invalid := func(param string) error {
+		msg := fmt.Sprintf("Invalid value for %s: %q", param, q.Get(param))
+		return &googleapi.Error{Code: http.StatusBadRequest, Message: msg,
+			Errors: []googleapi.ErrorItem{{Reason: "invalid", Message: msg}}}
+	}
+
+	sorted := reflect.MakeSlice(items.Type(), items.Len(), items.Len())
+	reflect.Copy(sorted, items)
+	name := func(i int) string { return sorted.Index(i).Elem().FieldByName("Name").String() }
+	sort.Slice(sorted.Interface(), func(i, j int) bool { return name(i) < name(j) })
+
+	size := sorted.Len()
+	if v := q.Get("maxResults"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, invalid("maxResults")
+		}
+		size = n
+	}
+	var offset int
+	if v := q.Get("pageToken"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n >= sorted.Len() {
+			return nil, invalid("pageToken")
+		}
+		offset = n
+	}
+	end := offset + size
+	if end >= sorted.Len() {
+		return map[string]any{"items": sorted.Slice(offset, sorted.Len()).Interface()}, nil
+	}
+	return map[string]any{
+		"items":         sorted.Slice(offset, end).Interface(),
+		"nextPageToken": strconv.Itoa(end),
+	}, nil
+}
+
+func (s *Server) aggregatedList(ctx context.Context, svc *service, r *route, req *http.Request) (any, error) {
+	fl, err := parseFilter(req)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := call(svc.wrapper, "AggregatedList", reflect.ValueOf(ctx), reflect.ValueOf(fl))
+	if err != nil {
+		return nil, err
+	}
+	field := lowerFirst(svc.info.AggregatedListField())
+	items := map[string]any{}
+	iter := reflect.ValueOf(ret).MapRange()
+	for iter.Next() {
+		items[iter.Key().String()] = map[string]any{field: iter.Value().Interface()}
+	}
+	return map[string]any{"items": items}, nil
+}
+
+func (s *Server) insert(ctx context.Context, svc *service, r *route, req *http.Request) (any, error) {
+	m := svc.wrapper.MethodByName("Insert")
+	if !m.IsValid() {
+		return nil, errNotSupported(req)
+	}
+	obj := reflect.New(m.Type().In(2).Elem())
+	if err := json.NewDecoder(req.Body).Decode(obj.Interface()); err != nil {
+		return nil, &googleapi.Error{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	key := *r.key
+	key.Name = obj.Elem().FieldByName("Name").String()
+	if key.Name == "" {
+		return nil, &googleapi.Error{Code: http.StatusBadRequest, Message: "fakeserver: missing name"}
+	}
+	r.key = &key
+
+	return s.mutate(ctx, svc, r, "Insert", reflect.ValueOf(ctx), reflect.ValueOf(r.key), obj)
+}
+
+// customMethod calls an additional method, e.g.
+// "POST .../backendServices/bs/setSecurityPolicy". Only methods where the
+// additional arguments can be decoded from the body are supported.
+func (s *Server) customMethod(ctx context.Context, svc *service, r *route, req *http.Request) (any, error) {
+	name := upperFirst(r.method)
+	m := svc.wrapper.MethodByName(name)
+	if !m.IsValid() {
+		return nil, errNotSupported(req)
+	}
+	args := []reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(r.key)}
+	// Additional arguments: (ctx, key, [args...], [fl]).
+	for i := 2; i < m.Type().NumIn(); i++ {
+		t := m.Type().In(i)
+		switch {
+		case t == reflect.TypeOf(&filter.F{}):
+			fl, err := parseFilter(req)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, reflect.ValueOf(fl))
+		case t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct && len(args) == 2:
+			obj := reflect.New(t.Elem())
+			if err := json.NewDecoder(req.Body).Decode(obj.Interface()); err != nil {
+				return nil, &googleapi.Error{Code: http.StatusBadRequest, Message: err.Error()}
+			}
+			args = append(args, obj)
+		default:
+			return nil, errNotSupported(req)
+		}
+	}
+
+	if m.Type().NumOut() == 1 {
+		return s.mutate(ctx, svc, r, name, args...)
+	}
+	ret, err := call(svc.wrapper, name, args...)
+	if err != nil {
+		return nil, err
+	}
+	if reflect.ValueOf(ret).Kind() == reflect.Slice {
+		return map[string]any{"items": ret}, nil
+	}
+	return ret, nil
+}
+
+// mutate calls the asynchronous version of the mutating method on the mock
+// (e.g. InsertAsync for "Insert") and returns the operation that was created,
+// which may still be running. Errors that occur before an operation is
+// created (e.g. the object already exists) are returned directly.
+func (s *Server) mutate(ctx context.Context, svc *service, r *route, method string, args ...reflect.Value) (any, error) {
+	ret, err := call(svc.wrapper, method+"Async", args...)
+	if err != nil {
+		return nil, err
+	}
+	ref := ret.(cloud.Operation).Ref()
+	if ref.Key.Name == "" {
+		// The mutation was intercepted by a hook.
+		return nil, fmt.Errorf("fakeserver: no operation for %s %v", method, r.key)
+	}
+	// Errors from the operation are returned in the Operation.
+	return s.Mock.Operations.Get(ctx, ref.ProjectID, &ref.Key)
+}
+
+// call the method on the mock service, returning (result, error).
+func call(wrapper reflect.Value, name string, args ...reflect.Value) (any, error) {
+	m := wrapper.MethodByName(name)
+	if !m.IsValid() {
+		return nil, &googleapi.Error{Code: http.StatusNotFound, Message: fmt.Sprintf("fakeserver: no method %q", name)}
+	}
+	out := m.Call(args)
+	errV := out[len(out)-1]
+	var err error
+	if !errV.IsNil() {
+		err = errV.Interface().(error)
+	}
+	if len(out) == 1 {
+		return nil, err
+	}
+	return out[0].Interface(), err
+}
+
+// parseFilter returns the filter for the request. The filter is evaluated by
+// the mock with F.Match().
+func parseFilter(req *http.Request) (*filter.F, error) {
+	s := req.URL.Query().Get("filter")
+	if s == "" {
+		return filter.None, nil
+	}
+	fl, err := filter.Parse(s)
+	if err != nil {
+		return nil, &googleapi.Error{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+			Errors:  []googleapi.ErrorItem{{Reason: "invalid", Message: err.Error()}},
+		}
+	}
+	return fl, nil
+}
+
+func errNotSupported(req *http.Request) error {
+	return &googleapi.Error{
+		Code:    http.StatusNotImplemented,
+		Message: fmt.Sprintf("fakeserver: %s %s is not supported", req.Method, req.URL.Path),
+	}
+}
+
+// writeError writes the error in the JSON format used by the GCE API, which is
+// parsed by the client library into a googleapi.Error.
+func writeError(w http.ResponseWriter, err error) {
+	gerr := &googleapi.Error{Code: http.StatusInternalServerError, Message: err.Error()}
+	errors.As(err, &gerr)
+
+	type errorItem struct {
+		Reason  string `json:"reason,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	var body struct {
+		Error struct {
+			Code    int         `json:"code"`
+			Message string      `json:"message"`
+			Errors  []errorItem `json:"errors,omitempty"`
+		} `json:"error"`
+	}
+	body.Error.Code = gerr.Code
+	body.Error.Message = gerr.Message
+	for _, item := range gerr.Errors {
+		body.Error.Errors = append(body.Error.Errors, errorItem{Reason: item.Reason, Message: item.Message})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(gerr.Code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		klog.Errorf("fakeserver: error encoding error response: %v", err)
+	}
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
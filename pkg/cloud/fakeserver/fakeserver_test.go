@@ -0,0 +1,969 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fakeserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opencensus.io/trace"
+	alpha "google.golang.org/api/compute/v0.alpha"
+	ga "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/google/go-cmp/cmp"
+)
+
+const project = "proj"
+
+// newTestServer returns a new Server and a GCE that uses it. opts are
+// applied to the cloud.Service before it is used.
+func newTestServer(t *testing.T, opts ...func(*cloud.Service)) (*Server, *cloud.GCE) {
+	t.Helper()
+
+	pr := &cloud.SingleProjectRouter{ID: project}
+	srv := New(cloud.NewMockGCE(pr))
+	t.Cleanup(srv.Close)
+
+	svc, err := srv.Service(context.Background(), pr)
+	if err != nil {
+		t.Fatalf("srv.Service() = %v, want nil", err)
+	}
+	for _, opt := range opts {
+		opt(svc)
+	}
+	return srv, cloud.NewGCE(svc)
+}
+
+func TestParsePath(t *testing.T) {
+	for _, tc := range []struct {
+		path    string
+		want    *route
+		wantErr bool
+	}{
+		{
+			path: "/compute/v1/projects/p/global/addresses",
+			want: &route{version: meta.VersionGA, projectID: "p", resource: "addresses", key: meta.GlobalKey("")},
+		},
+		{
+			path: "/compute/alpha/projects/p/regions/r1/addresses/a",
+			want: &route{version: meta.VersionAlpha, projectID: "p", resource: "addresses", key: meta.RegionalKey("a", "r1"), hasName: true},
+		},
+		{
+			path: "/compute/beta/projects/p/zones/z1/instanceGroups/ig/addInstances",
+			want: &route{version: meta.VersionBeta, projectID: "p", resource: "instanceGroups", key: meta.ZonalKey("ig", "z1"), hasName: true, method: "addInstances"},
+		},
+		{
+			path: "/compute/v1/projects/p/aggregated/addresses",
+			want: &route{version: meta.VersionGA, projectID: "p", resource: "addresses", aggregated: true},
+		},
+		{path: "/compute/v2/projects/p/global/addresses", wantErr: true},
+		{path: "/compute/v1/projects/p/foo/addresses", wantErr: true},
+		{path: "/compute/v1/projects/p/global/a/b/c/d", wantErr: true},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			got, err := parsePath(tc.path)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("parsePath() = %v; gotErr = %t, want %t", err, gotErr, tc.wantErr)
+			}
+			if diff := cmp.Diff(got, tc.want, cmp.AllowUnexported(route{})); diff != "" {
+				t.Errorf("parsePath(): -got,+want: %s", diff)
+			}
+		})
+	}
+}
+
+func TestServerCRUD(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		mode cloud.OperationMode
+	}{
+		{name: "Wait", mode: cloud.OperationModeWait},
+		{name: "Get", mode: cloud.OperationModeGet},
+		{name: "Batch", mode: cloud.OperationModeBatch},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			srv, gce := newTestServer(t, func(svc *cloud.Service) {
+				svc.OperationMode = tc.mode
+				svc.OperationPoller.Interval = 5 * time.Millisecond
+			})
+			srv.Mock.Operations.Latency = 10 * time.Millisecond
+
+			key := meta.RegionalKey("addr", "us-central1")
+			if err := gce.Addresses().Insert(ctx, key, &ga.Address{Description: "d"}); err != nil {
+				t.Fatalf("Insert() = %v, want nil", err)
+			}
+			// The object is visible in the mock.
+			if _, err := srv.Mock.Addresses().Get(ctx, key); err != nil {
+				t.Errorf("mock Get() = %v, want nil", err)
+			}
+			got, err := gce.Addresses().Get(ctx, key)
+			if err != nil {
+				t.Fatalf("Get() = %v, want nil", err)
+			}
+			if got.Name != "addr" || got.Description != "d" {
+				t.Errorf("Get() = %+v, want Name=addr, Description=d", got)
+			}
+			// Alpha view of the same object.
+			if _, err := gce.AlphaAddresses().Get(ctx, key); err != nil {
+				t.Errorf("AlphaAddresses().Get() = %v, want nil", err)
+			}
+
+			err = gce.Addresses().Insert(ctx, key, &ga.Address{})
+			var gerr *googleapi.Error
+			if !errors.As(err, &gerr) || gerr.Code != http.StatusConflict {
+				t.Errorf("Insert() = %v, want HTTP %d", err, http.StatusConflict)
+			}
+
+			if err := gce.Addresses().Delete(ctx, key); err != nil {
+				t.Fatalf("Delete() = %v, want nil", err)
+			}
+			_, err = gce.Addresses().Get(ctx, key)
+			if !errors.As(err, &gerr) || gerr.Code != http.StatusNotFound {
+				t.Errorf("Get() = %v, want HTTP %d", err, http.StatusNotFound)
+			}
+		})
+	}
+}
+
+func TestServerList(t *testing.T) {
+	ctx := context.Background()
+	srv, gce := newTestServer(t)
+
+	for _, k := range []*meta.Key{
+		meta.RegionalKey("a", "us-central1"),
+		meta.RegionalKey("b", "us-central1"),
+		meta.RegionalKey("c", "us-central1"),
+		meta.RegionalKey("d", "us-east1"),
+	} {
+		if err := srv.Mock.Addresses().Insert(ctx, k, &ga.Address{}); err != nil {
+			t.Fatalf("Insert(%v) = %v, want nil", k, err)
+		}
+	}
+
+	fl := filter.Regexp("name", "a|b")
+	objs, err := gce.Addresses().List(ctx, "us-central1", fl)
+	if err != nil {
+		t.Fatalf("List() = %v, want nil", err)
+	}
+	var names []string
+	for _, o := range objs {
+		names = append(names, o.Name)
+	}
+	sort.Strings(names)
+	if diff := cmp.Diff(names, []string{"a", "b"}); diff != "" {
+		t.Errorf("List(): -got,+want: %s", diff)
+	}
+
+	// The filter is rendered, sent to the server and evaluated by the mock.
+	var gotFilter string
+	for _, r := range srv.Requests() {
+		if r.Path == "/compute/v1/projects/proj/regions/us-central1/addresses" {
+			gotFilter = r.Query.Get("filter")
+		}
+	}
+	if gotFilter != fl.String() {
+		t.Errorf("filter = %q, want %q", gotFilter, fl.String())
+	}
+
+	agg, err := gce.AlphaAddresses().AggregatedList(ctx, filter.None)
+	if err != nil {
+		t.Fatalf("AggregatedList() = %v, want nil", err)
+	}
+	if len(agg["regions/us-central1"]) != 3 || len(agg["regions/us-east1"]) != 1 {
+		t.Errorf("AggregatedList() = %v, want 3 in us-central1 and 1 in us-east1", agg)
+	}
+
+	_, err = gce.Addresses().List(ctx, "us-central1", filter.Regexp("name", "(a"))
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) || gerr.Code != http.StatusBadRequest {
+		t.Errorf("List(invalid filter) = %v, want HTTP %d", err, http.StatusBadRequest)
+	}
+}
+
+type countingRateLimiter struct {
+	accepted int
+}
+
+func (rl *countingRateLimiter) Accept(context.Context, *cloud.RateLimitKey) error {
+	rl.accepted++
+	return nil
+}
+
+func (rl *countingRateLimiter) Observe(context.Context, error, *cloud.RateLimitKey) {}
+
+func TestServerListPages(t *testing.T) {
+	ctx := context.Background()
+	pr := &cloud.SingleProjectRouter{ID: project}
+	srv := New(cloud.NewMockGCE(pr))
+	t.Cleanup(srv.Close)
+	svc, err := srv.Service(ctx, pr)
+	if err != nil {
+		t.Fatalf("srv.Service() = %v, want nil", err)
+	}
+	rl := &countingRateLimiter{}
+	svc.RateLimiter = rl
+	gce := cloud.NewGCE(svc)
+
+	for _, name := range []string{"e", "d", "c", "b", "a"} {
+		if err := srv.Mock.Firewalls().Insert(ctx, meta.GlobalKey(name), &ga.Firewall{}); err != nil {
+			t.Fatalf("Insert(%s) = %v, want nil", name, err)
+		}
+	}
+
+	var pages [][]string
+	err = gce.Firewalls().ListPages(ctx, filter.None, &cloud.ListOptions{MaxResults: 2}, func(page []*ga.Firewall) error {
+		var names []string
+		for _, o := range page {
+			names = append(names, o.Name)
+		}
+		pages = append(pages, names)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ListPages() = %v, want nil", err)
+	}
+	if diff := cmp.Diff(pages, [][]string{{"a", "b"}, {"c", "d"}, {"e"}}); diff != "" {
+		t.Errorf("ListPages(): -got,+want: %s", diff)
+	}
+	// Each page is a separate, rate limited request.
+	if rl.accepted != 3 {
+		t.Errorf("RateLimiter.Accept() called %d times, want 3", rl.accepted)
+	}
+
+	// Stop after the first page.
+	var n int
+	err = gce.Firewalls().ListPages(ctx, filter.None, &cloud.ListOptions{MaxResults: 2}, func([]*ga.Firewall) error {
+		n++
+		return cloud.ErrStopPaging
+	})
+	if err != nil || n != 1 {
+		t.Errorf("ListPages() = %v, %d pages; want nil, 1 page", err, n)
+	}
+}
+
+func TestServerOperationError(t *testing.T) {
+	ctx := context.Background()
+	srv, gce := newTestServer(t)
+
+	key := meta.GlobalKey("bs")
+	if err := srv.Mock.BackendServices().Insert(ctx, key, &ga.BackendService{}); err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+	srv.Mock.Operations.Errors[cloud.MockOperationKey{Service: "BackendServices", Method: "Delete", Key: *key}] = &cloud.MockOperationError{
+		HTTPStatusCode: http.StatusBadRequest,
+		Code:           "RESOURCE_IN_USE_BY_ANOTHER_RESOURCE",
+		Message:        "in use",
+	}
+	// The error is returned in the operation and surfaced by
+	// WaitForCompletion().
+	err := gce.BackendServices().Delete(ctx, key)
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) || gerr.Code != http.StatusBadRequest {
+		t.Errorf("Delete() = %v, want HTTP %d", err, http.StatusBadRequest)
+	}
+	var opErr *cloud.OperationError
+	if !errors.As(err, &opErr) || len(opErr.Errors) != 1 || opErr.Errors[0].Code != "RESOURCE_IN_USE_BY_ANOTHER_RESOURCE" {
+		t.Errorf("Delete() = %v, want OperationError with RESOURCE_IN_USE_BY_ANOTHER_RESOURCE", err)
+	}
+}
+
+func TestServerAsync(t *testing.T) {
+	ctx := context.Background()
+	srv, gce := newTestServer(t)
+
+	key := meta.ZonalKey("neg", "us-central1-b")
+	op, err := gce.NetworkEndpointGroups().InsertAsync(ctx, key, &ga.NetworkEndpointGroup{})
+	if err != nil {
+		t.Fatalf("InsertAsync() = %v, want nil", err)
+	}
+	if err := op.Wait(ctx); err != nil {
+		t.Fatalf("Wait() = %v, want nil", err)
+	}
+	if done, err := op.Done(ctx); !done || err != nil {
+		t.Errorf("Done() = %t, %v; want true, nil", done, err)
+	}
+	if want := cloud.NewNetworkEndpointGroupsResourceID(project, "us-central1-b", "neg"); !op.ResourceID().Equal(want) {
+		t.Errorf("ResourceID() = %v, want %v", op.ResourceID(), want)
+	}
+	if _, err := srv.Mock.NetworkEndpointGroups().Get(ctx, key); err != nil {
+		t.Errorf("Get() = %v, want nil", err)
+	}
+
+	// Resume from the serialized reference, e.g. after a restart.
+	b, err := json.Marshal(op.Ref())
+	if err != nil {
+		t.Fatalf("json.Marshal() = %v, want nil", err)
+	}
+	var ref cloud.OperationRef
+	if err := json.Unmarshal(b, &ref); err != nil {
+		t.Fatalf("json.Unmarshal(%s) = %v, want nil", b, err)
+	}
+	if ref.Version != meta.VersionGA || ref.Key.Zone != key.Zone {
+		t.Errorf("ref = %+v, want ga operation in zone %q", ref, key.Zone)
+	}
+	resumed, err := gce.ResumeOperation(&ref)
+	if err != nil {
+		t.Fatalf("ResumeOperation() = %v, want nil", err)
+	}
+	if err := resumed.Wait(ctx); err != nil {
+		t.Errorf("resumed.Wait() = %v, want nil", err)
+	}
+
+	// Operation errors are returned by Wait() and Err().
+	srv.Mock.Operations.Errors[cloud.MockOperationKey{Service: "NetworkEndpointGroups", Method: "Delete", Key: *key}] = &cloud.MockOperationError{
+		HTTPStatusCode: http.StatusBadRequest,
+		Code:           "RESOURCE_IN_USE_BY_ANOTHER_RESOURCE",
+		Message:        "in use",
+	}
+	op, err = gce.NetworkEndpointGroups().DeleteAsync(ctx, key)
+	if err != nil {
+		t.Fatalf("DeleteAsync() = %v, want nil", err)
+	}
+	var gerr *googleapi.Error
+	if err := op.Wait(ctx); !errors.As(err, &gerr) || gerr.Code != http.StatusBadRequest {
+		t.Errorf("Wait() = %v, want HTTP %d", err, http.StatusBadRequest)
+	}
+	if err := op.Err(); !errors.As(err, &gerr) || gerr.Code != http.StatusBadRequest {
+		t.Errorf("Err() = %v, want HTTP %d", err, http.StatusBadRequest)
+	}
+}
+
+// operationRequests counts the requests for operations by type.
+func operationRequests(srv *Server) (lists, waits, gets int) {
+	for _, r := range srv.Requests() {
+		if !strings.Contains(r.Path, "/operations") {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(r.Path, "/operations"):
+			lists++
+		case strings.HasSuffix(r.Path, "/wait"):
+			waits++
+		default:
+			gets++
+		}
+	}
+	return lists, waits, gets
+}
+
+func TestServerOperationPoller(t *testing.T) {
+	ctx := context.Background()
+	srv, gce := newTestServer(t, func(svc *cloud.Service) {
+		svc.OperationMode = cloud.OperationModeBatch
+		svc.OperationPoller.Interval = 20 * time.Millisecond
+		svc.OperationPoller.MaxBatchSize = 4
+	})
+	srv.Mock.Operations.Latency = 50 * time.Millisecond
+
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := meta.ZonalKey(fmt.Sprintf("neg-%d", i), "us-central1-b")
+			errs[i] = gce.NetworkEndpointGroups().Insert(ctx, key, &ga.NetworkEndpointGroup{})
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Insert(neg-%d) = %v, want nil", i, err)
+		}
+	}
+	objs, err := srv.Mock.NetworkEndpointGroups().List(ctx, "us-central1-b", filter.None)
+	if err != nil || len(objs) != n {
+		t.Errorf("mock List() = [%d items], %v; want [%d items], nil", len(objs), err, n)
+	}
+
+	// The operations are polled with List calls of at most 4 operations
+	// instead of separately.
+	lists, waits, gets := operationRequests(srv)
+	if lists == 0 || lists >= 2*n || waits != 0 || gets != 0 {
+		t.Errorf("operation requests: %d lists, %d waits, %d gets; want 0 < lists < %d and no waits or gets", lists, waits, gets, 2*n)
+	}
+
+	// Operation errors are returned from the List.
+	key := meta.ZonalKey("neg-0", "us-central1-b")
+	srv.Mock.Operations.Errors[cloud.MockOperationKey{Service: "NetworkEndpointGroups", Method: "Delete", Key: *key}] = &cloud.MockOperationError{
+		HTTPStatusCode: http.StatusBadRequest,
+		Code:           "RESOURCE_IN_USE_BY_ANOTHER_RESOURCE",
+		Message:        "in use",
+	}
+	err = gce.NetworkEndpointGroups().Delete(ctx, key)
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) || gerr.Code != http.StatusBadRequest {
+		t.Errorf("Delete() = %v, want HTTP %d", err, http.StatusBadRequest)
+	}
+}
+
+func TestServerOperationPollerStraggler(t *testing.T) {
+	ctx := context.Background()
+	srv, gce := newTestServer(t, func(svc *cloud.Service) {
+		svc.OperationMode = cloud.OperationModeBatch
+		svc.OperationPoller.Interval = time.Hour
+		svc.OperationPoller.StragglerTimeout = 10 * time.Millisecond
+	})
+	srv.Mock.Operations.Latency = 20 * time.Millisecond
+
+	// The poller never lists, so the operation is waited for separately
+	// after StragglerTimeout.
+	if err := gce.Networks().Insert(ctx, meta.GlobalKey("net"), &ga.Network{}); err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+	if lists, waits, _ := operationRequests(srv); lists != 0 || waits == 0 {
+		t.Errorf("operation requests: %d lists, %d waits; want no lists and > 0 waits", lists, waits)
+	}
+}
+
+func TestServerCustomMethod(t *testing.T) {
+	ctx := context.Background()
+	srv, gce := newTestServer(t)
+
+	key := meta.GlobalKey("bs")
+	var got *alpha.SecurityPolicyReference
+	srv.Mock.MockAlphaBackendServices.SetSecurityPolicyHook = func(_ context.Context, _ *meta.Key, ref *alpha.SecurityPolicyReference, _ *cloud.MockAlphaBackendServices) error {
+		got = ref
+		return nil
+	}
+	ref := &alpha.SecurityPolicyReference{SecurityPolicy: "sp"}
+	if err := gce.AlphaBackendServices().SetSecurityPolicy(ctx, key, ref); err != nil {
+		t.Fatalf("SetSecurityPolicy() = %v, want nil", err)
+	}
+	if got == nil || got.SecurityPolicy != "sp" {
+		t.Errorf("SetSecurityPolicyHook got %+v, want %+v", got, ref)
+	}
+}
+
+func TestServerLinks(t *testing.T) {
+	ctx := context.Background()
+	pr := &cloud.SingleProjectRouter{ID: project}
+	srv := New(cloud.NewMockGCE(pr))
+	defer srv.Close()
+	svc, err := srv.Service(ctx, pr)
+	if err != nil {
+		t.Fatalf("srv.Service() = %v, want nil", err)
+	}
+
+	op, err := svc.GA.Addresses.Insert(project, "us-central1", &ga.Address{Name: "addr", Description: "d"}).Context(ctx).Do()
+	if err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+	for _, link := range []string{op.SelfLink, op.TargetLink} {
+		if !strings.HasPrefix(link, srv.URL()+"/compute/v1/projects/"+project+"/") {
+			t.Errorf("link = %q, want prefix %q", link, srv.URL())
+		}
+	}
+
+	// Follow the TargetLink of the operation to the SelfLink of the object.
+	var addr ga.Address
+	getJSON(t, op.TargetLink, &addr)
+	if addr.Description != "d" {
+		t.Errorf("GET %s = %+v, want Description=d", op.TargetLink, addr)
+	}
+	var addr2 ga.Address
+	getJSON(t, addr.SelfLink, &addr2)
+	if addr2.SelfLink != addr.SelfLink {
+		t.Errorf("GET %s: SelfLink = %q, want %q", addr.SelfLink, addr2.SelfLink, addr.SelfLink)
+	}
+}
+
+// getJSON decodes the response of GET url into v.
+func getJSON(t *testing.T, url string, v any) {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s = %v, want nil", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s = HTTP %d, want %d", url, resp.StatusCode, http.StatusOK)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("GET %s: Decode() = %v, want nil", url, err)
+	}
+}
+
+type recordingObserver struct {
+	lock sync.Mutex
+	keys []cloud.CallContextKey
+}
+
+func (o *recordingObserver) Start(_ context.Context, key *cloud.CallContextKey) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.keys = append(o.keys, *key)
+}
+
+func (o *recordingObserver) End(context.Context, *cloud.CallContextKey, error) {}
+
+func TestServerCallContextKey(t *testing.T) {
+	obs := &recordingObserver{}
+	ctx := cloud.WithCallObserver(context.Background(), obs)
+	_, gce := newTestServer(t)
+
+	key := meta.ZonalKey("neg", "us-central1-b")
+	if err := gce.NetworkEndpointGroups().Insert(ctx, key, &ga.NetworkEndpointGroup{}); err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+	if _, err := gce.NetworkEndpointGroups().Get(ctx, key); err != nil {
+		t.Fatalf("Get() = %v, want nil", err)
+	}
+	if _, err := gce.NetworkEndpointGroups().List(ctx, "us-central1-b", filter.None); err != nil {
+		t.Fatalf("List() = %v, want nil", err)
+	}
+	if _, err := gce.NetworkEndpointGroups().AggregatedList(ctx, filter.None); err != nil {
+		t.Fatalf("AggregatedList() = %v, want nil", err)
+	}
+	if err := gce.NetworkEndpointGroups().AttachNetworkEndpoints(ctx, key, &ga.NetworkEndpointGroupsAttachEndpointsRequest{}); err != nil {
+		t.Fatalf("AttachNetworkEndpoints() = %v, want nil", err)
+	}
+	if err := gce.NetworkEndpointGroups().Delete(ctx, key); err != nil {
+		t.Fatalf("Delete() = %v, want nil", err)
+	}
+
+	ck := func(op string, key meta.Key, mutation bool) cloud.CallContextKey {
+		return cloud.CallContextKey{
+			ProjectID: project,
+			Operation: op,
+			Version:   meta.VersionGA,
+			Service:   "NetworkEndpointGroups",
+			Key:       key,
+			Mutation:  mutation,
+		}
+	}
+	want := []cloud.CallContextKey{
+		ck("Insert", *key, true),
+		ck("Get", *key, false),
+		ck("List", meta.Key{Zone: "us-central1-b"}, false),
+		ck("AggregatedList", meta.Key{}, false),
+		ck("AttachNetworkEndpoints", *key, true),
+		ck("Delete", *key, true),
+	}
+	if diff := cmp.Diff(obs.keys, want); diff != "" {
+		t.Errorf("observed keys; -got,+want: %s", diff)
+	}
+}
+
+func TestServerInterceptors(t *testing.T) {
+	var calls []string
+	record := func(ctx context.Context, call *cloud.Call, next cloud.Invoker) (interface{}, error) {
+		res, err := next(ctx, call)
+		calls = append(calls, fmt.Sprintf("%s.%s %T", call.Key.Service, call.Key.Operation, res))
+		return res, err
+	}
+	label := func(ctx context.Context, call *cloud.Call, next cloud.Invoker) (interface{}, error) {
+		call.Header.Set("X-Goog-User-Project", "billing")
+		if a, ok := call.Request.(*ga.Address); ok {
+			a.Description = "intercepted"
+		}
+		return next(ctx, call)
+	}
+	cached := &ga.Address{Name: "cached"}
+	cache := func(ctx context.Context, call *cloud.Call, next cloud.Invoker) (interface{}, error) {
+		if call.Key.Operation == "Get" && call.Key.Key.Name == "cached" {
+			return cached, nil
+		}
+		return next(ctx, call)
+	}
+	srv, gce := newTestServer(t, func(svc *cloud.Service) {
+		svc.OperationMode = cloud.OperationModeGet
+		svc.Interceptors = append(svc.Interceptors, record, label, cache)
+	})
+	ctx := context.Background()
+
+	key := meta.RegionalKey("addr", "us-central1")
+	if err := gce.Addresses().Insert(ctx, key, &ga.Address{}); err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+	got, err := gce.Addresses().Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get() = %v, want nil", err)
+	}
+	if got.Description != "intercepted" {
+		t.Errorf("Description = %q, want %q", got.Description, "intercepted")
+	}
+	if got, err := gce.Addresses().Get(ctx, meta.RegionalKey("cached", "us-central1")); err != nil || got != cached {
+		t.Errorf("Get(cached) = %+v, %v; want %+v, nil", got, err, cached)
+	}
+	if _, err := gce.Addresses().List(ctx, "us-central1", filter.None); err != nil {
+		t.Fatalf("List() = %v, want nil", err)
+	}
+	if _, err := gce.Addresses().AggregatedList(ctx, filter.None); err != nil {
+		t.Fatalf("AggregatedList() = %v, want nil", err)
+	}
+	if err := gce.Addresses().Delete(ctx, key); err != nil {
+		t.Fatalf("Delete() = %v, want nil", err)
+	}
+
+	want := []string{
+		"Addresses.Insert *compute.Operation",
+		"Addresses.Get *compute.Address",
+		"Addresses.Get *compute.Address",
+		"Addresses.List []*compute.Address",
+		"Addresses.AggregatedList map[string][]*compute.Address",
+		"Addresses.Delete *compute.Operation",
+	}
+	if diff := cmp.Diff(calls, want); diff != "" {
+		t.Errorf("intercepted calls; -got,+want: %s", diff)
+	}
+
+	var apiCalls, withHeader int
+	for _, r := range srv.Requests() {
+		if strings.Contains(r.Path, "/operations") {
+			continue
+		}
+		apiCalls++
+		if r.Header.Get("X-Goog-User-Project") == "billing" {
+			withHeader++
+		}
+	}
+	// The cached Get does not reach the server.
+	if apiCalls != 5 || withHeader != apiCalls {
+		t.Errorf("%d requests with the header out of %d, want 5 out of 5", withHeader, apiCalls)
+	}
+}
+
+func TestServerInterceptorsNilResult(t *testing.T) {
+	nilResult := func(ctx context.Context, call *cloud.Call, next cloud.Invoker) (interface{}, error) {
+		return nil, nil
+	}
+	_, gce := newTestServer(t, func(svc *cloud.Service) {
+		svc.Interceptors = append(svc.Interceptors, nilResult)
+	})
+	ctx := context.Background()
+	key := meta.RegionalKey("addr", "us-central1")
+
+	if op, err := gce.Addresses().InsertAsync(ctx, key, &ga.Address{}); err == nil {
+		t.Errorf("InsertAsync() = %v, nil; want error", op)
+	}
+	if err := gce.Addresses().Insert(ctx, key, &ga.Address{}); err == nil {
+		t.Errorf("Insert() = nil, want error")
+	}
+	if got, err := gce.Addresses().Get(ctx, key); err == nil {
+		t.Errorf("Get() = %v, nil; want error", got)
+	}
+	it := gce.Addresses().ListIterator(ctx, "us-central1", filter.None, nil)
+	if page, err := it.Next(); err == nil {
+		t.Errorf("it.Next() = %v, nil; want error", page)
+	}
+}
+
+func TestServerInterceptorsRetry(t *testing.T) {
+	// twice calls next twice, e.g. to retry the call.
+	twice := func(ctx context.Context, call *cloud.Call, next cloud.Invoker) (interface{}, error) {
+		if _, err := next(ctx, call); err != nil {
+			return nil, err
+		}
+		return next(ctx, call)
+	}
+	srv, gce := newTestServer(t, func(svc *cloud.Service) {
+		svc.Interceptors = append(svc.Interceptors, twice)
+	})
+	ctx := context.Background()
+
+	for _, name := range []string{"a", "b"} {
+		if err := srv.Mock.Addresses().Insert(ctx, meta.RegionalKey(name, "us-central1"), &ga.Address{}); err != nil {
+			t.Fatalf("mock Insert() = %v, want nil", err)
+		}
+	}
+	l, err := gce.Addresses().List(ctx, "us-central1", filter.None)
+	if err != nil || len(l) != 2 {
+		t.Errorf("List() = [%d items], %v; want [2 items], nil", len(l), err)
+	}
+	al, err := gce.Addresses().AggregatedList(ctx, filter.None)
+	if err != nil || len(al["regions/us-central1"]) != 2 {
+		t.Errorf("AggregatedList() = %v, %v; want 2 items in regions/us-central1, nil", al, err)
+	}
+}
+
+// eventObserver records the events of the optional observer interfaces.
+type eventObserver struct {
+	lock   sync.Mutex
+	events []string
+}
+
+func (o *eventObserver) add(format string, args ...interface{}) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.events = append(o.events, fmt.Sprintf(format, args...))
+}
+
+func (o *eventObserver) Start(_ context.Context, key *cloud.CallContextKey) {
+	o.add("Start %s.%s", key.Service, key.Operation)
+}
+
+func (o *eventObserver) End(_ context.Context, key *cloud.CallContextKey, err error) {
+	o.add("End %s.%s err=%v", key.Service, key.Operation, err != nil)
+}
+
+func (o *eventObserver) RateLimitEnd(_ context.Context, key *cloud.RateLimitKey, _ time.Duration, err error) {
+	o.add("RateLimitEnd %s.%s err=%v", key.Service, key.Operation, err != nil)
+}
+
+func (o *eventObserver) OperationStart(_ context.Context, key *cloud.CallContextKey, ref *cloud.OperationRef) {
+	o.add("OperationStart %s.%s op=%t", key.Service, key.Operation, ref.Key.Name != "")
+}
+
+func (o *eventObserver) OperationPoll(_ context.Context, ref *cloud.OperationRef, attempt int, done bool, err error) {
+	o.add("OperationPoll attempt=%d done=%t err=%v", attempt, done, err != nil)
+}
+
+func (o *eventObserver) OperationEnd(_ context.Context, key *cloud.CallContextKey, _ time.Duration, err error) {
+	o.add("OperationEnd %s.%s err=%v", key.Service, key.Operation, err != nil)
+}
+
+func TestServerCallObserverEvents(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		mode cloud.OperationMode
+		want []string
+	}{
+		{
+			name: "get",
+			mode: cloud.OperationModeGet,
+			want: []string{
+				"Start Networks.Insert",
+				"RateLimitEnd Networks.Insert err=false",
+				"End Networks.Insert err=false",
+				"OperationStart Networks.Insert op=true",
+				"RateLimitEnd Operations.Get err=false",
+				"OperationPoll attempt=1 done=true err=false",
+				"OperationEnd Networks.Insert err=false",
+				"Start Networks.Get",
+				"RateLimitEnd Networks.Get err=false",
+				"End Networks.Get err=true",
+			},
+		},
+		{
+			name: "batch",
+			mode: cloud.OperationModeBatch,
+			want: []string{
+				"Start Networks.Insert",
+				"RateLimitEnd Networks.Insert err=false",
+				"End Networks.Insert err=false",
+				"OperationStart Networks.Insert op=true",
+				"RateLimitEnd Operations.List err=false",
+				"OperationPoll attempt=0 done=true err=false",
+				"OperationEnd Networks.Insert err=false",
+				"Start Networks.Get",
+				"RateLimitEnd Networks.Get err=false",
+				"End Networks.Get err=true",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			obs := &eventObserver{}
+			_, gce := newTestServer(t, func(svc *cloud.Service) {
+				svc.OperationMode = tc.mode
+				svc.CallObservers = append(svc.CallObservers, obs)
+			})
+			ctx := context.Background()
+
+			if err := gce.Networks().Insert(ctx, meta.GlobalKey("net"), &ga.Network{}); err != nil {
+				t.Fatalf("Insert() = %v, want nil", err)
+			}
+			if _, err := gce.Networks().Get(ctx, meta.GlobalKey("other")); err == nil {
+				t.Fatalf("Get() = nil, want error")
+			}
+			if diff := cmp.Diff(obs.events, tc.want); diff != "" {
+				t.Errorf("events; -got,+want: %s", diff)
+			}
+		})
+	}
+}
+
+// The call of a synchronous operation method ends when the operation is
+// done, with the error of the operation.
+func TestServerCallObserverOperationMethod(t *testing.T) {
+	obs := &eventObserver{}
+	srv, gce := newTestServer(t, func(svc *cloud.Service) {
+		svc.OperationMode = cloud.OperationModeGet
+		svc.CallObservers = append(svc.CallObservers, obs)
+	})
+	ctx := context.Background()
+	key := meta.ZonalKey("neg", "us-central1-b")
+	req := &ga.NetworkEndpointGroupsAttachEndpointsRequest{}
+
+	if err := srv.Mock.NetworkEndpointGroups().Insert(ctx, key, &ga.NetworkEndpointGroup{}); err != nil {
+		t.Fatalf("mock Insert() = %v, want nil", err)
+	}
+	srv.Mock.Operations.Errors[cloud.MockOperationKey{Service: "NetworkEndpointGroups", Method: "AttachNetworkEndpoints", Key: *key}] = &cloud.MockOperationError{
+		HTTPStatusCode: http.StatusBadRequest,
+		Code:           "INVALID_USAGE",
+	}
+	if err := gce.NetworkEndpointGroups().AttachNetworkEndpoints(ctx, key, req); err == nil {
+		t.Fatalf("AttachNetworkEndpoints() = nil, want error")
+	}
+	if _, err := gce.NetworkEndpointGroups().AttachNetworkEndpointsAsync(ctx, key, req); err != nil {
+		t.Fatalf("AttachNetworkEndpointsAsync() = %v, want nil", err)
+	}
+	want := []string{
+		"Start NetworkEndpointGroups.AttachNetworkEndpoints",
+		"RateLimitEnd NetworkEndpointGroups.AttachNetworkEndpoints err=false",
+		"OperationStart NetworkEndpointGroups.AttachNetworkEndpoints op=true",
+		"RateLimitEnd Operations.Get err=false",
+		"OperationPoll attempt=1 done=true err=true",
+		"OperationEnd NetworkEndpointGroups.AttachNetworkEndpoints err=true",
+		"End NetworkEndpointGroups.AttachNetworkEndpoints err=true",
+		// The asynchronous variant ends the call when the operation starts.
+		"Start NetworkEndpointGroups.AttachNetworkEndpoints",
+		"RateLimitEnd NetworkEndpointGroups.AttachNetworkEndpoints err=false",
+		"End NetworkEndpointGroups.AttachNetworkEndpoints err=false",
+		"OperationStart NetworkEndpointGroups.AttachNetworkEndpoints op=true",
+	}
+	if diff := cmp.Diff(obs.events, want); diff != "" {
+		t.Errorf("events; -got,+want: %s", diff)
+	}
+}
+
+type spanRecorder struct {
+	lock  sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (r *spanRecorder) ExportSpan(s *trace.SpanData) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+// tree returns the names of the spans as an indented tree, with the status
+// code of the spans that failed.
+func (r *spanRecorder) tree() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	children := map[trace.SpanID][]*trace.SpanData{}
+	ids := map[trace.SpanID]bool{}
+	for _, s := range r.spans {
+		ids[s.SpanID] = true
+	}
+	var roots []*trace.SpanData
+	for _, s := range r.spans {
+		if ids[s.ParentSpanID] {
+			children[s.ParentSpanID] = append(children[s.ParentSpanID], s)
+		} else {
+			roots = append(roots, s)
+		}
+	}
+	var ret []string
+	var walk func(spans []*trace.SpanData, indent string)
+	walk = func(spans []*trace.SpanData, indent string) {
+		sort.Slice(spans, func(i, j int) bool { return spans[i].StartTime.Before(spans[j].StartTime) })
+		for _, s := range spans {
+			line := indent + s.Name
+			if s.Code != trace.StatusCodeOK {
+				line += fmt.Sprintf(" (%d)", s.Code)
+			}
+			ret = append(ret, line)
+			walk(children[s.SpanID], indent+"  ")
+		}
+	}
+	walk(roots, "")
+	return ret
+}
+
+func TestServerTrace(t *testing.T) {
+	rec := &spanRecorder{}
+	trace.RegisterExporter(rec)
+	t.Cleanup(func() { trace.UnregisterExporter(rec) })
+
+	_, gce := newTestServer(t, func(svc *cloud.Service) {
+		svc.OperationMode = cloud.OperationModeGet
+	})
+	ctx, root := trace.StartSpan(context.Background(), "root", trace.WithSampler(trace.AlwaysSample()))
+
+	key := meta.GlobalKey("net")
+	if err := gce.Networks().Insert(ctx, key, &ga.Network{}); err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+	if _, err := gce.Networks().Get(ctx, meta.GlobalKey("other")); err == nil {
+		t.Fatalf("Get() = nil, want error")
+	}
+	if _, err := gce.Networks().List(ctx, filter.Regexp("name", "net")); err != nil {
+		t.Fatalf("List() = %v, want nil", err)
+	}
+	op, err := gce.Networks().DeleteAsync(ctx, key)
+	if err != nil {
+		t.Fatalf("DeleteAsync() = %v, want nil", err)
+	}
+	if err := op.Wait(ctx); err != nil {
+		t.Fatalf("op.Wait() = %v, want nil", err)
+	}
+	root.End()
+
+	// The span of a synchronous call includes the wait for the operation.
+	// The wait for the operation of an asynchronous call is a sibling.
+	want := []string{
+		"root",
+		"  cloud/Networks.Insert",
+		"    cloud/RateLimiter.Accept",
+		"    cloud/request",
+		"    cloud/Operation.Wait",
+		"      cloud/Operation.poll",
+		"        cloud/RateLimiter.Accept",
+		"  cloud/Networks.Get (5)",
+		"    cloud/RateLimiter.Accept",
+		"    cloud/request (5)",
+		"  cloud/Networks.List",
+		"    cloud/RateLimiter.Accept",
+		"  cloud/Networks.Delete",
+		"    cloud/RateLimiter.Accept",
+		"    cloud/request",
+		"  cloud/Operation.Wait",
+		"    cloud/Operation.poll",
+		"      cloud/RateLimiter.Accept",
+	}
+	if diff := cmp.Diff(rec.tree(), want); diff != "" {
+		t.Errorf("spans; -got,+want: %s", diff)
+	}
+
+	attrs := map[string]map[string]interface{}{}
+	for _, s := range rec.spans {
+		attrs[s.Name] = s.Attributes
+	}
+	wantAttrs := map[string]interface{}{
+		"project":   project,
+		"service":   "Networks",
+		"operation": "Insert",
+		"version":   "ga",
+		"key":       key.String(),
+		"mutation":  true,
+	}
+	if diff := cmp.Diff(attrs["cloud/Networks.Insert"], wantAttrs); diff != "" {
+		t.Errorf("Insert span attributes; -got,+want: %s", diff)
+	}
+	if got, want := attrs["cloud/Networks.List"]["filter"], filter.Regexp("name", "net").String(); got != want {
+		t.Errorf("List span filter = %v, want %q", got, want)
+	}
+}
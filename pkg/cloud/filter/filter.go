@@ -25,6 +25,13 @@ limitations under the License.
 //  // List on multiple conditions.
 //  f := filter.Regexp("name", "homer.*").AndNotRegexp("name", "homers")
 //  c.GlobalAddresses().List(ctx, f)
+//
+//  // List on alternative conditions.
+//  f := filter.Or(filter.Regexp("name", "k8s-fw-.*"), filter.Regexp("description", ".*cluster-uid.*"))
+//  c.GlobalAddresses().List(ctx, f)
+//
+//  // Check field names and value types against the object type.
+//  f, err := filter.For[ga.ForwardingRule]().AndRegexp("labels.cluster", "c1").Filter()
 package filter
 
 import (
@@ -32,6 +39,7 @@ import (
 	"fmt"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"k8s.io/klog/v2"
@@ -73,6 +81,20 @@ func NotEqualBool(fieldName string, v bool) *F {
 	return (&F{}).AndNotEqualBool(fieldName, v)
 }
 
+// Or returns a filter that matches if any of the filters match. Each of the
+// filters is grouped with parentheses, i.e. Or(a.And(b), c) is
+// "((a) (b)) OR (c)". If any of the filters is None, the result matches
+// everything.
+func Or(filters ...*F) *F {
+	return (&F{}).AndOr(filters...)
+}
+
+// Not returns a filter that matches if fl does not match. Not(None) matches
+// nothing, see AndNot().
+func Not(fl *F) *F {
+	return (&F{}).AndNot(fl)
+}
+
 // F is a filter to be used with List() operations.
 //
 // From the compute API description:
@@ -100,18 +122,74 @@ func NotEqualBool(fieldName string, v bool) *F {
 // parentheses. For example, (scheduling.automaticRestart eq true)
 // (zone eq us-central1-f). Multiple expressions are treated as AND expressions,
 // meaning that resources must match all expressions to pass the filters.
+//
+// Expressions can also be combined with OR and negated with NOT, e.g.
+// (name eq k8s-fw-.*) OR (description eq .*cluster-uid.*) or
+// NOT (name eq default). See Or() and Not().
 type F struct {
+	// predicates are joined with AND.
 	predicates []filterPredicate
 }
 
-// TODO(rramkumar): Support logical OR
-
 // And joins two filters together.
 func (fl *F) And(rest *F) *F {
+	if rest == nil {
+		return fl
+	}
 	fl.predicates = append(fl.predicates, rest.predicates...)
 	return fl
 }
 
+// AndOr adds a predicate that matches if any of the filters match. Nothing
+// is added if one of the filters matches everything (e.g. None).
+func (fl *F) AndOr(filters ...*F) *F {
+	for _, f := range filters {
+		if f.matchesAll() {
+			return fl
+		}
+	}
+	// Copy the filters, as Or() may append to them.
+	fl.predicates = append(fl.predicates, filterPredicate{op: or, sub: append([]*F(nil), filters...)})
+	return fl
+}
+
+// AndNot adds a predicate that matches if rest does not match. If rest
+// matches everything (e.g. None), the predicate matches nothing; it is
+// rendered as "(name eq .*) (name ne .*)", as the filter expressions cannot
+// be empty and all resources have a name.
+func (fl *F) AndNot(rest *F) *F {
+	if rest.matchesAll() {
+		all := ".*"
+		fl.predicates = append(fl.predicates,
+			filterPredicate{fieldName: "name", op: regexpEquals, s: &all},
+			filterPredicate{fieldName: "name", op: regexpNotEquals, s: &all},
+		)
+		return fl
+	}
+	fl.predicates = append(fl.predicates, filterPredicate{op: not, sub: []*F{rest}})
+	return fl
+}
+
+// Or returns a filter that matches if either fl or rest match. If fl is
+// empty, this is equivalent to And(rest). If rest matches everything (e.g.
+// None), so does the result. Note: fl is modified.
+func (fl *F) Or(rest *F) *F {
+	if rest.matchesAll() {
+		fl.predicates = nil
+		return fl
+	}
+	if len(fl.predicates) == 0 {
+		return fl.And(rest)
+	}
+	if len(fl.predicates) == 1 && fl.predicates[0].op == or {
+		fl.predicates[0].sub = append(fl.predicates[0].sub, rest)
+		return fl
+	}
+	first := &F{predicates: fl.predicates}
+	fl.predicates = []filterPredicate{{op: or, sub: []*F{first, rest}}}
+	return fl
+}
+
 // AndRegexp adds a field ~ string predicate.
 func (fl *F) AndRegexp(fieldName, v string) *F {
 	fl.predicates = append(fl.predicates, filterPredicate{fieldName: fieldName, op: regexpEquals, s: &v})
@@ -148,7 +226,16 @@ func (fl *F) AndNotEqualBool(fieldName string, v bool) *F {
 	return fl
 }
 
+// matchesAll returns true if fl has no predicates, i.e. it matches
+// everything.
+func (fl *F) matchesAll() bool {
+	return fl == nil || len(fl.predicates) == 0
+}
+
 func (fl *F) String() string {
+	if fl == nil {
+		return ""
+	}
 	if len(fl.predicates) == 1 {
 		return fl.predicates[0].String()
 	}
@@ -164,6 +251,10 @@ func (fl *F) String() string {
 // is used by the Mock implementations to perform filtering and SHOULD NOT be
 // used in production code as it is not well-tested to be equivalent to the
 // actual compute API.
+//
+// As with the compute API, regexps must match the entire field. Fields may be
+// strings, integers of any width, floats, bools, keys of a map (e.g.
+// "labels.cluster") or repeated fields, which match if any element matches.
 func (fl *F) Match(obj interface{}) bool {
 	if fl == nil {
 		return true
@@ -183,9 +274,13 @@ const (
 	regexpNotEquals filterOp = iota
 	equals          filterOp = iota
 	notEquals       filterOp = iota
+	// or and not are logical operators on the sub filters.
+	or  filterOp = iota
+	not filterOp = iota
 )
 
-// filterPredicate is an individual predicate for a fieldName and value.
+// filterPredicate is an individual predicate for a fieldName and value or a
+// logical operator (or, not) on sub filters.
 type filterPredicate struct {
 	fieldName string
 
@@ -193,9 +288,22 @@ type filterPredicate struct {
 	s  *string
 	i  *int
 	b  *bool
+
+	sub []*F
 }
 
 func (fp *filterPredicate) String() string {
+	switch fp.op {
+	case or:
+		var pl []string
+		for _, f := range fp.sub {
+			pl = append(pl, "("+f.String()+")")
+		}
+		return strings.Join(pl, " OR ")
+	case not:
+		return "NOT (" + fp.sub[0].String() + ")"
+	}
+
 	var op string
 	switch fp.op {
 	case regexpEquals:
@@ -216,9 +324,7 @@ func (fp *filterPredicate) String() string {
 	var value string
 	switch {
 	case fp.s != nil:
-		// There does not seem to be any sort of escaping as specified in the
-		// document. This means it's possible to create malformed expressions.
-		value = *fp.s
+		value = quoteLiteral(*fp.s)
 	case fp.i != nil:
 		value = fmt.Sprintf("%d", *fp.i)
 	case fp.b != nil:
@@ -230,38 +336,61 @@ func (fp *filterPredicate) String() string {
 	return fmt.Sprintf("%s %s %s", fp.fieldName, op, value)
 }
 
+// quoteLiteral returns v quoted with double quotes if it cannot be used as a
+// bare literal in a filter expression, i.e. it is empty, contains whitespace
+// or '"' or has unbalanced parentheses. '\' and '"' are escaped inside the
+// quotes. Literals that do not need quoting are returned unchanged.
+func quoteLiteral(v string) string {
+	needsQuote := v == "" || strings.ContainsAny(v, " \t\r\n\"")
+	depth := 0
+	for _, c := range v {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth < 0 {
+			needsQuote = true
+		}
+	}
+	if !needsQuote {
+		return v
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(v) + `"`
+}
+
 func (fp *filterPredicate) match(o interface{}) bool {
-	v, err := extractValue(fp.fieldName, o)
-	klog.V(6).Infof("extractValue(%q, %#v) = %v, %v", fp.fieldName, o, v, err)
+	switch fp.op {
+	case or:
+		for _, f := range fp.sub {
+			if f.Match(o) {
+				return true
+			}
+		}
+		return false
+	case not:
+		return !fp.sub[0].Match(o)
+	}
+
+	values, err := extractValues(fp.fieldName, o)
+	klog.V(6).Infof("extractValues(%q, %#v) = %v, %v", fp.fieldName, o, values, err)
 	if err != nil {
 		return false
 	}
 
+	// Repeated fields match if any of the elements match.
 	var match bool
-	switch x := v.(type) {
-	case string:
-		if fp.s == nil {
-			return false
-		}
-		re, err := regexp.Compile(*fp.s)
-		if err != nil {
-			klog.Errorf("Match regexp %q is invalid: %v", *fp.s, err)
+	for _, v := range values {
+		m, ok := fp.matchValue(v)
+		if !ok {
 			return false
 		}
-		match = x == *fp.s
-		if fp.op < regexpNotEquals {
-			match = re.Match([]byte(x))
+		if m {
+			match = true
+			break
 		}
-	case int:
-		if fp.i == nil {
-			return false
-		}
-		match = x == *fp.i
-	case bool:
-		if fp.b == nil {
-			return false
-		}
-		match = x == *fp.b
 	}
 
 	switch fp.op {
@@ -278,6 +407,57 @@ func (fp *filterPredicate) match(o interface{}) bool {
 	return false
 }
 
+// matchValue returns true if the value v (as returned by extractValues())
+// is equal to the value of the predicate. ok is false if the predicate
+// cannot be compared to v, e.g. the types are incompatible.
+func (fp *filterPredicate) matchValue(v interface{}) (match bool, ok bool) {
+	switch x := v.(type) {
+	case string:
+		if fp.s == nil {
+			return false, false
+		}
+		if fp.op == equals || fp.op == notEquals {
+			return x == *fp.s, true
+		}
+		// The regexp must match the entire field.
+		re, err := regexp.Compile("^(?:" + *fp.s + ")$")
+		if err != nil {
+			klog.Errorf("Match regexp %q is invalid: %v", *fp.s, err)
+			return false, false
+		}
+		return re.MatchString(x), true
+	case int64:
+		if fp.i != nil {
+			return x == int64(*fp.i), true
+		}
+		if fp.s != nil {
+			i, err := strconv.ParseInt(*fp.s, 10, 64)
+			return err == nil && x == i, err == nil
+		}
+	case uint64:
+		if fp.i != nil {
+			return *fp.i >= 0 && x == uint64(*fp.i), true
+		}
+		if fp.s != nil {
+			u, err := strconv.ParseUint(*fp.s, 10, 64)
+			return err == nil && x == u, err == nil
+		}
+	case float64:
+		if fp.i != nil {
+			return x == float64(*fp.i), true
+		}
+		if fp.s != nil {
+			f, err := strconv.ParseFloat(*fp.s, 64)
+			return err == nil && x == f, err == nil
+		}
+	case bool:
+		if fp.b != nil {
+			return x == *fp.b, true
+		}
+	}
+	return false, false
+}
+
 // snakeToCamelCase converts from "names_like_this" to "NamesLikeThis" to
 // interoperate between proto and Golang naming conventions.
 func snakeToCamelCase(s string) string {
@@ -289,33 +469,73 @@ func snakeToCamelCase(s string) string {
 	return ret
 }
 
-// extractValue returns the value of the field named by path in object o if it exists.
-func extractValue(path string, o interface{}) (interface{}, error) {
-	parts := strings.Split(path, ".")
-	for _, f := range parts {
-		v := reflect.ValueOf(o)
-		// Dereference Ptr to handle *struct.
-		if v.Kind() == reflect.Ptr {
-			if v.IsNil() {
-				return nil, errors.New("field is nil")
+// extractValues returns the values of the field named by path in object o
+// if it exists. Path elements are struct fields (in snake_case) or keys of a
+// map, e.g. "labels.cluster". If the path traverses a slice, the values for
+// each of the elements are returned.
+//
+// Values are normalized by kind: string, int64 (all signed integers), uint64
+// (all unsigned integers), float64 or bool.
+func extractValues(path string, o interface{}) ([]interface{}, error) {
+	return extractValuesRec(strings.Split(path, "."), reflect.ValueOf(o))
+}
+
+func extractValuesRec(parts []string, v reflect.Value) ([]interface{}, error) {
+	// Dereference Ptr to handle *struct.
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, errors.New("field is nil")
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		var ret []interface{}
+		for i := 0; i < v.Len(); i++ {
+			values, err := extractValuesRec(parts, v.Index(i))
+			if err != nil {
+				return nil, err
 			}
-			v = v.Elem()
+			ret = append(ret, values...)
 		}
-		if v.Kind() != reflect.Struct {
-			return nil, fmt.Errorf("cannot get field from non-struct (%T)", o)
+		return ret, nil
+	}
+
+	if len(parts) == 0 {
+		switch v.Kind() {
+		case reflect.String:
+			return []interface{}{v.String()}, nil
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return []interface{}{v.Int()}, nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return []interface{}{v.Uint()}, nil
+		case reflect.Float32, reflect.Float64:
+			return []interface{}{v.Float()}, nil
+		case reflect.Bool:
+			return []interface{}{v.Bool()}, nil
 		}
-		v = v.FieldByName(snakeToCamelCase(f))
-		if !v.IsValid() {
-			return nil, fmt.Errorf("cannot get field %q as it is not a valid field in %T", f, o)
+		return nil, fmt.Errorf("unhandled object of type %v", v.Type())
+	}
+
+	f := parts[0]
+	switch v.Kind() {
+	case reflect.Struct:
+		fv := v.FieldByName(snakeToCamelCase(f))
+		if !fv.IsValid() {
+			return nil, fmt.Errorf("cannot get field %q as it is not a valid field in %v", f, v.Type())
 		}
-		if !v.CanInterface() {
-			return nil, fmt.Errorf("cannot get field %q in obj of type %T", f, o)
+		if !fv.CanInterface() {
+			return nil, fmt.Errorf("cannot get field %q in obj of type %v", f, v.Type())
 		}
-		o = v.Interface()
-	}
-	switch o.(type) {
-	case string, int, bool:
-		return o, nil
+		return extractValuesRec(parts[1:], fv)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("cannot get key %q from map of type %v", f, v.Type())
+		}
+		fv := v.MapIndex(reflect.ValueOf(f).Convert(v.Type().Key()))
+		if !fv.IsValid() {
+			return nil, fmt.Errorf("key %q not found in map", f)
+		}
+		return extractValuesRec(parts[1:], fv)
 	}
-	return nil, fmt.Errorf("unhandled object of type %T", o)
+	return nil, fmt.Errorf("cannot get field %q from non-struct (%v)", f, v.Type())
 }
@@ -37,6 +37,22 @@ func TestFilterToString(t *testing.T) {
 		{Regexp("field1", "abc").AndRegexp("field2", "def"), `(field1 eq abc) (field2 eq def)`},
 		{Regexp("field1", "abc").AndNotEqualInt("field2", 17), `(field1 eq abc) (field2 ne 17)`},
 		{Regexp("field1", "abc").And(EqualInt("field2", 17)), `(field1 eq abc) (field2 eq 17)`},
+		{Or(Regexp("field1", "abc"), EqualInt("field2", 17)), `(field1 eq abc) OR (field2 eq 17)`},
+		{Regexp("field1", "abc").Or(EqualInt("field2", 17)).Or(EqualBool("field3", true)), `(field1 eq abc) OR (field2 eq 17) OR (field3 eq true)`},
+		{(&F{}).Or(Regexp("field1", "abc")), `field1 eq abc`},
+		{Or(Regexp("field1", "abc").AndRegexp("field2", "def"), EqualInt("field3", 1)), `((field1 eq abc) (field2 eq def)) OR (field3 eq 1)`},
+		{Regexp("field1", "abc").AndOr(EqualInt("field2", 1), EqualInt("field2", 2)), `(field1 eq abc) ((field2 eq 1) OR (field2 eq 2))`},
+		{Not(Regexp("field1", "abc")), `NOT (field1 eq abc)`},
+		{Not(Regexp("field1", "abc").AndRegexp("field2", "def")), `NOT ((field1 eq abc) (field2 eq def))`},
+		{Regexp("field1", "abc").AndNot(Or(EqualInt("field2", 1), EqualInt("field2", 2))), `(field1 eq abc) (NOT ((field2 eq 1) OR (field2 eq 2)))`},
+		{None, ``},
+		{Or(None, Regexp("name", "a")), ``},
+		{Regexp("field1", "abc").AndOr(EqualInt("field2", 1), None), `field1 eq abc`},
+		{Regexp("field1", "abc").Or(None), ``},
+		{Regexp("field1", "abc").And(None), `field1 eq abc`},
+		{Not(None), `(name eq .*) (name ne .*)`},
+		{Regexp("name", "a").AndNot(None), `(name eq a) (name eq .*) (name ne .*)`},
+		{Not(&F{}), `(name eq .*) (name ne .*)`},
 	} {
 		if tc.f.String() != tc.want {
 			t.Errorf("filter %#v String() = %q, want %q", tc.f, tc.f.String(), tc.want)
@@ -44,6 +60,21 @@ func TestFilterToString(t *testing.T) {
 	}
 }
 
+func TestFilterOrCopiesFilters(t *testing.T) {
+	t.Parallel()
+
+	fs := make([]*F, 2, 3)
+	fs[0], fs[1] = Regexp("field1", "a"), Regexp("field1", "b")
+	fl := Or(fs...).Or(Regexp("field1", "c"))
+
+	if got := fs[:3][2]; got != nil {
+		t.Errorf("Or() modified the caller's slice: fs[2] = %v, want nil", got)
+	}
+	if got, want := fl.String(), `(field1 eq a) OR (field1 eq b) OR (field1 eq c)`; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
 func TestFilterMatch(t *testing.T) {
 	t.Parallel()
 
@@ -54,8 +85,15 @@ func TestFilterMatch(t *testing.T) {
 		S           string
 		I           int
 		B           bool
+		I32         int32
+		I64         int64
+		U64         uint64
+		F           float64
+		Labels      map[string]string
+		Items       []string
 		Unhandled   struct{}
 		NestedField *inner
+		NestedList  []*inner
 	}
 
 	for _, tc := range []struct {
@@ -87,6 +125,47 @@ func TestFilterMatch(t *testing.T) {
 		{f: NotRegexp("nested_field.x", "xyz"), o: &S{NestedField: &inner{"xyz"}}},
 		{f: Regexp("nested_field.y", "xyz"), o: &S{NestedField: &inner{"xyz"}}},
 		{f: Regexp("nested_field", "xyz"), o: &S{NestedField: &inner{"xyz"}}},
+		{f: Or(Regexp("s", "abc"), EqualInt("i", 10)), o: &S{S: "abc"}, want: true},
+		{f: Or(Regexp("s", "abc"), EqualInt("i", 10)), o: &S{I: 10}, want: true},
+		{f: Or(Regexp("s", "abc"), EqualInt("i", 10)), o: &S{S: "def", I: 11}},
+		{f: Regexp("s", "abc").Or(EqualInt("i", 10)).Or(EqualBool("b", true)), o: &S{B: true}, want: true},
+		{f: Or(Regexp("s", "abc").AndEqualInt("i", 10), EqualBool("b", true)), o: &S{S: "abc"}},
+		{f: Or(Regexp("s", "abc").AndEqualInt("i", 10), EqualBool("b", true)), o: &S{S: "abc", I: 10}, want: true},
+		{f: Not(Regexp("s", "abc")), o: &S{S: "abc"}},
+		{f: Not(Regexp("s", "abc")), o: &S{S: "def"}, want: true},
+		{f: Regexp("s", "abc").AndNot(Or(EqualInt("i", 1), EqualInt("i", 2))), o: &S{S: "abc", I: 2}},
+		{f: Regexp("s", "abc").AndNot(Or(EqualInt("i", 1), EqualInt("i", 2))), o: &S{S: "abc", I: 3}, want: true},
+		{f: Or(None, Regexp("s", "abc")), o: &S{S: "def"}, want: true},
+		{f: Not(None), o: &S{S: "abc"}},
+		{f: Not(None), o: &struct{ Name string }{"abc"}},
+		{f: Regexp("s", "abc").AndNot(None), o: &S{S: "abc"}},
+		// Regexps must match the entire field.
+		{f: Regexp("s", "b"), o: &S{S: "abc"}},
+		{f: Regexp("s", "a|abc"), o: &S{S: "abc"}, want: true},
+		{f: NotRegexp("s", "a.*"), o: &S{S: "abc"}},
+		{f: NotRegexp("s", "b"), o: &S{S: "abc"}, want: true},
+		// Integer widths and floats.
+		{f: EqualInt("i64", 80), o: &S{I64: 80}, want: true},
+		{f: NotEqualInt("i64", 80), o: &S{I64: 80}},
+		{f: EqualInt("u64", 123), o: &S{U64: 123}, want: true},
+		{f: EqualInt("u64", -1), o: &S{U64: 123}},
+		{f: EqualInt("i32", 7), o: &S{I32: 7}, want: true},
+		{f: EqualInt("f", 2), o: &S{F: 2}, want: true},
+		{f: Regexp("u64", "18446744073709551615"), o: &S{U64: 18446744073709551615}, want: true},
+		{f: Regexp("f", "2.5"), o: &S{F: 2.5}, want: true},
+		{f: Regexp("i64", "abc"), o: &S{I64: 1}},
+		{f: NotRegexp("i64", "abc"), o: &S{I64: 1}},
+		// Maps.
+		{f: Regexp("labels.cluster", "c1"), o: &S{Labels: map[string]string{"cluster": "c1"}}, want: true},
+		{f: Regexp("labels.cluster", "c1"), o: &S{Labels: map[string]string{"cluster": "c2"}}},
+		{f: Regexp("labels.cluster", "c1"), o: &S{}},
+		// Repeated fields match if any element matches.
+		{f: Regexp("items", "b"), o: &S{Items: []string{"a", "b"}}, want: true},
+		{f: Regexp("items", "c"), o: &S{Items: []string{"a", "b"}}},
+		{f: NotRegexp("items", "b"), o: &S{Items: []string{"a", "b"}}},
+		{f: NotRegexp("items", "c"), o: &S{Items: []string{"a", "b"}}, want: true},
+		{f: Regexp("nested_list.x", "2"), o: &S{NestedList: []*inner{{"1"}, {"2"}}}, want: true},
+		{f: Regexp("items", "a"), o: &S{}},
 	} {
 		got := tc.f.Match(tc.o)
 		if got != tc.want {
@@ -116,7 +195,7 @@ func TestFilterSnakeToCamelCase(t *testing.T) {
 	}
 }
 
-func TestFilterExtractValue(t *testing.T) {
+func TestFilterExtractValues(t *testing.T) {
 	t.Parallel()
 
 	type nest2 struct {
@@ -130,47 +209,66 @@ func TestFilterExtractValue(t *testing.T) {
 		S       string
 		I       int
 		F       bool
+		I64     int64
+		U64     uint64
+		Float   float64
 		Nest    nest
 		NestPtr *nest
+		Labels  map[string]string
+		Items   []string
+		Nests   []*nest
 
-		Unhandled float64
+		Unhandled struct{}
 	}{
-		"abc",
-		13,
-		true,
-		nest{"xyz", nest2{"zzz"}},
-		&nest{"yyy", nest2{}},
-		0.0,
+		S:       "abc",
+		I:       13,
+		F:       true,
+		I64:     -64,
+		U64:     64,
+		Float:   1.5,
+		Nest:    nest{"xyz", nest2{"zzz"}},
+		NestPtr: &nest{"yyy", nest2{}},
+		Labels:  map[string]string{"cluster": "c1"},
+		Items:   []string{"a", "b"},
+		Nests:   []*nest{{X: "n1"}, {X: "n2"}},
 	}
 
 	for _, tc := range []struct {
 		path    string
 		o       interface{}
-		want    interface{}
+		want    []interface{}
 		wantErr bool
 	}{
-		{path: "s", o: st, want: "abc"},
-		{path: "i", o: st, want: 13},
-		{path: "f", o: st, want: true},
-		{path: "nest.x", o: st, want: "xyz"},
-		{path: "nest_ptr.x", o: st, want: "yyy"},
+		{path: "s", o: st, want: []interface{}{"abc"}},
+		{path: "i", o: st, want: []interface{}{int64(13)}},
+		{path: "f", o: st, want: []interface{}{true}},
+		{path: "i64", o: st, want: []interface{}{int64(-64)}},
+		{path: "u64", o: st, want: []interface{}{uint64(64)}},
+		{path: "float", o: st, want: []interface{}{1.5}},
+		{path: "nest.x", o: st, want: []interface{}{"xyz"}},
+		{path: "nest_ptr.x", o: st, want: []interface{}{"yyy"}},
+		{path: "labels.cluster", o: st, want: []interface{}{"c1"}},
+		{path: "items", o: st, want: []interface{}{"a", "b"}},
+		{path: "nests.x", o: st, want: []interface{}{"n1", "n2"}},
+		{path: "items", o: &struct{ Items []string }{}},
 		// Error cases.
 		{path: "", o: st, wantErr: true},
 		{path: "no_such_field", o: st, wantErr: true},
 		{path: "s.invalid_type", o: st, wantErr: true},
 		{path: "unhandled", o: st, wantErr: true},
+		{path: "labels.no_such_key", o: st, wantErr: true},
 		{path: "nest.x", o: &struct{ Nest *nest }{}, wantErr: true},
 	} {
-		o, err := extractValue(tc.path, tc.o)
+		o, err := extractValues(tc.path, tc.o)
 		gotErr := err != nil
 		if gotErr != tc.wantErr {
-			t.Errorf("extractValue(%v, %+v) = %v, %v; gotErr = %v, tc.wantErr = %v", tc.path, tc.o, o, err, gotErr, tc.wantErr)
+			t.Errorf("extractValues(%v, %+v) = %v, %v; gotErr = %v, tc.wantErr = %v", tc.path, tc.o, o, err, gotErr, tc.wantErr)
 		}
 		if err != nil {
 			continue
 		}
 		if !reflect.DeepEqual(o, tc.want) {
-			t.Errorf("extractValue(%v, %+v) = %v, nil; want %v, nil", tc.path, tc.o, o, tc.want)
+			t.Errorf("extractValues(%v, %+v) = %v, nil; want %v, nil", tc.path, tc.o, o, tc.want)
 		}
 	}
 }
@@ -0,0 +1,306 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParseError is returned by Parse() for an invalid filter expression.
+type ParseError struct {
+	// Filter is the expression that was parsed.
+	Filter string
+	// Pos is the byte offset in Filter where the error was found.
+	Pos int
+	// Msg describes the error.
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid filter %q: %s at position %d", e.Filter, e.Msg, e.Pos)
+}
+
+// Parse the filter expression s. Parse is the inverse of F.String(), i.e.
+// Parse(fl.String()).String() == fl.String(). The following syntax is
+// accepted:
+//
+//	field eq literal          // Also "ne".
+//	(expr) (expr)             // AND; the keyword "AND" is optional.
+//	(expr) OR (expr)          // OR has precedence over AND.
+//	NOT (expr)
+//
+// Literals may be quoted with double quotes ("a b"), in which case '\' escapes
+// the next character. Unquoted literals end at whitespace or an unbalanced
+// ')'. Literals must be valid regular expressions. Literals that are valid
+// integers or booleans will also match integer and boolean fields with
+// Match().
+//
+// An empty expression returns a filter that matches everything.
+func Parse(s string) (*F, error) {
+	p := &parser{s: s}
+	fl, err := p.parseSeq()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos])
+	}
+	return fl, nil
+}
+
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &ParseError{Filter: p.s, Pos: p.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.s) && isSpace(p.s[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+// keyword consumes kw if it is next in the input, followed by a space or
+// '('.
+func (p *parser) keyword(kw string) bool {
+	if !strings.HasPrefix(p.s[p.pos:], kw) {
+		return false
+	}
+	end := p.pos + len(kw)
+	if end < len(p.s) && !isSpace(p.s[end]) && p.s[end] != '(' {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+// parseItem is a single element of a sequence.
+type parseItem struct {
+	fl *F
+	// group is true if the item was enclosed in parentheses.
+	group bool
+}
+
+// parseSeq parses a sequence of items joined with AND/OR until the end of
+// the input or an unbalanced ')'.
+func (p *parser) parseSeq() (*F, error) {
+	// terms are joined by AND, the items in each term by OR.
+	var terms [][]parseItem
+	for {
+		p.skipSpace()
+		if p.eof() || p.s[p.pos] == ')' {
+			break
+		}
+		var isOr bool
+		if len(terms) > 0 {
+			switch {
+			case p.keyword("OR"):
+				isOr = true
+			case p.keyword("AND"):
+			}
+			p.skipSpace()
+			if p.eof() || p.s[p.pos] == ')' {
+				return nil, p.errorf("expected expression")
+			}
+		}
+		item, err := p.parseItem()
+		if err != nil {
+			return nil, err
+		}
+		if isOr {
+			terms[len(terms)-1] = append(terms[len(terms)-1], item)
+		} else {
+			terms = append(terms, []parseItem{item})
+		}
+	}
+
+	// A single "(expr)" is an OR with a single element; this is how
+	// F.String() renders Or() with one filter.
+	if len(terms) == 1 && len(terms[0]) == 1 {
+		if item := terms[0][0]; item.group {
+			return &F{predicates: []filterPredicate{{op: or, sub: []*F{item.fl}}}}, nil
+		}
+		return terms[0][0].fl, nil
+	}
+
+	ret := &F{}
+	for _, term := range terms {
+		if len(term) == 1 {
+			ret.predicates = append(ret.predicates, term[0].fl.predicates...)
+			continue
+		}
+		var alts []*F
+		for _, item := range term {
+			alts = append(alts, item.fl)
+		}
+		ret.predicates = append(ret.predicates, filterPredicate{op: or, sub: alts})
+	}
+	return ret, nil
+}
+
+// parseItem parses "(expr)", "NOT item" or a "field op literal" predicate.
+func (p *parser) parseItem() (parseItem, error) {
+	switch {
+	case p.s[p.pos] == '(':
+		open := p.pos
+		p.pos++
+		fl, err := p.parseSeq()
+		if err != nil {
+			return parseItem{}, err
+		}
+		if p.eof() {
+			p.pos = open
+			return parseItem{}, p.errorf("unbalanced '('")
+		}
+		if len(fl.predicates) == 0 {
+			return parseItem{}, p.errorf("expected expression")
+		}
+		p.pos++
+		return parseItem{fl: fl, group: true}, nil
+	case p.keyword("NOT"):
+		p.skipSpace()
+		if p.eof() || p.s[p.pos] == ')' {
+			return parseItem{}, p.errorf("expected expression after NOT")
+		}
+		item, err := p.parseItem()
+		if err != nil {
+			return parseItem{}, err
+		}
+		return parseItem{fl: Not(item.fl)}, nil
+	}
+	pred, err := p.parsePredicate()
+	if err != nil {
+		return parseItem{}, err
+	}
+	return parseItem{fl: &F{predicates: []filterPredicate{pred}}}, nil
+}
+
+func (p *parser) parsePredicate() (filterPredicate, error) {
+	start := p.pos
+	for p.pos < len(p.s) && isFieldChar(p.s[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		return filterPredicate{}, p.errorf("expected field name")
+	}
+	fieldName := p.s[start:p.pos]
+
+	if p.eof() || !isSpace(p.s[p.pos]) {
+		return filterPredicate{}, p.errorf("expected space after field name")
+	}
+	p.skipSpace()
+
+	var isNe bool
+	switch {
+	case p.keyword("eq"):
+	case p.keyword("ne"):
+		isNe = true
+	default:
+		return filterPredicate{}, p.errorf("expected operator \"eq\" or \"ne\"")
+	}
+	p.skipSpace()
+
+	litPos := p.pos
+	v, err := p.parseLiteral()
+	if err != nil {
+		return filterPredicate{}, err
+	}
+	if _, err := regexp.Compile(v); err != nil {
+		p.pos = litPos
+		return filterPredicate{}, p.errorf("invalid regular expression: %v", err)
+	}
+
+	fp := filterPredicate{fieldName: fieldName, op: regexpEquals, s: &v}
+	if isNe {
+		fp.op = regexpNotEquals
+	}
+	if i, err := strconv.Atoi(v); err == nil {
+		fp.i = &i
+	}
+	if v == "true" || v == "false" {
+		b := v == "true"
+		fp.b = &b
+	}
+	return fp, nil
+}
+
+func (p *parser) parseLiteral() (string, error) {
+	if p.eof() {
+		return "", p.errorf("expected value")
+	}
+	if p.s[p.pos] == '"' {
+		start := p.pos
+		p.pos++
+		var sb strings.Builder
+		for ; p.pos < len(p.s); p.pos++ {
+			switch c := p.s[p.pos]; c {
+			case '\\':
+				p.pos++
+				if p.eof() {
+					return "", p.errorf("unterminated escape")
+				}
+				sb.WriteByte(p.s[p.pos])
+			case '"':
+				p.pos++
+				return sb.String(), nil
+			default:
+				sb.WriteByte(c)
+			}
+		}
+		p.pos = start
+		return "", p.errorf("unterminated quoted value")
+	}
+
+	start := p.pos
+	depth := 0
+Loop:
+	for ; p.pos < len(p.s); p.pos++ {
+		switch c := p.s[p.pos]; {
+		case isSpace(c):
+			break Loop
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth == 0 {
+				break Loop
+			}
+			depth--
+		}
+	}
+	if p.pos == start {
+		return "", p.errorf("expected value")
+	}
+	return p.s[start:p.pos], nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isFieldChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-'
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	for _, f := range []*F{
+		{},
+		Regexp("field1", "abc"),
+		NotRegexp("field1", "a.*(b|c)"),
+		EqualInt("field1", 13),
+		NotEqualBool("field1", true),
+		Regexp("field1", "abc").AndRegexp("field2", "def"),
+		Regexp("field1", "abc").AndNotEqualInt("field2", 17).AndEqualBool("field3", false),
+		Or(Regexp("field1", "abc"), EqualInt("field2", 17)),
+		Or(Regexp("field1", "abc")),
+		Or(Regexp("field1", "abc").AndRegexp("field2", "def"), EqualInt("field3", 1)),
+		Regexp("field1", "abc").AndOr(EqualInt("field2", 1), EqualInt("field2", 2)),
+		Or(Or(Regexp("a", "1"), Regexp("b", "2")), Regexp("c", "3")),
+		Not(Regexp("field1", "abc")),
+		Not(Regexp("field1", "abc").AndRegexp("field2", "def")),
+		Regexp("field1", "abc").AndNot(Or(EqualInt("field2", 1), EqualInt("field2", 2))),
+		Regexp("labels.cluster", "k8s-.*").AndNot(Not(Regexp("nested_field.x", "y"))),
+		Regexp("field1", "a b"),
+		Regexp("field1", `a"b\.`),
+		Regexp("field1", `a\)`),
+		Regexp("field1", ""),
+		Not(None),
+		Regexp("field1", "abc").AndNot(None),
+		Or(Not(None), Regexp("field1", "abc")),
+		Or(None, Regexp("field1", "abc")),
+	} {
+		s := f.String()
+		got, err := Parse(s)
+		if err != nil {
+			t.Errorf("Parse(%q) = %v, want nil", s, err)
+			continue
+		}
+		if got.String() != s {
+			t.Errorf("Parse(%q).String() = %q, want %q", s, got.String(), s)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		s    string
+		want string
+	}{
+		{s: "  name   eq  foo ", want: "name eq foo"},
+		{s: "(name eq k8s-.*) (labels.cluster ne foo)", want: "(name eq k8s-.*) (labels.cluster ne foo)"},
+		{s: "(a eq 1) AND (b eq 2)", want: "(a eq 1) (b eq 2)"},
+		{s: "a eq 1 b eq 2", want: "(a eq 1) (b eq 2)"},
+		{s: "(a eq 1) OR (b eq 2) (c eq 3)", want: "((a eq 1) OR (b eq 2)) (c eq 3)"},
+		{s: "(a eq 1) (b eq 2) OR (c eq 3)", want: "(a eq 1) ((b eq 2) OR (c eq 3))"},
+		{s: "NOT a eq 1", want: "NOT (a eq 1)"},
+		{s: "NOT(a eq 1)", want: "NOT (a eq 1)"},
+		{s: "name eq (a|b)-.*", want: "name eq (a|b)-.*"},
+		{s: `name eq "a b"`, want: `name eq "a b"`},
+		{s: `name eq "a\"b\\."`, want: `name eq "a\"b\\."`},
+		{s: `name eq "a\.b"`, want: `name eq a.b`},
+		{s: "NOTE eq x", want: "NOTE eq x"},
+	} {
+		got, err := Parse(tc.s)
+		if err != nil {
+			t.Errorf("Parse(%q) = %v, want nil", tc.s, err)
+			continue
+		}
+		if got.String() != tc.want {
+			t.Errorf("Parse(%q).String() = %q, want %q", tc.s, got.String(), tc.want)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		s       string
+		wantPos int
+	}{
+		{s: "name", wantPos: 4},
+		{s: "name lt 1", wantPos: 5},
+		{s: "name eq", wantPos: 7},
+		{s: "name eq ", wantPos: 8},
+		{s: "(name eq a", wantPos: 0},
+		{s: "(a eq 1) ((b eq 2)", wantPos: 9},
+		{s: "name eq a)", wantPos: 9},
+		{s: "(a eq 1) OR", wantPos: 11},
+		{s: "(a eq 1) ()", wantPos: 10},
+		{s: "NOT", wantPos: 3},
+		{s: `name eq "abc`, wantPos: 8},
+		{s: "!name eq a", wantPos: 0},
+		{s: "name=a", wantPos: 4},
+		{s: "name eq (a", wantPos: 8},
+	} {
+		_, err := Parse(tc.s)
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("Parse(%q) = %v, want *ParseError", tc.s, err)
+			continue
+		}
+		if perr.Pos != tc.wantPos {
+			t.Errorf("Parse(%q) = %v; Pos = %d, want %d", tc.s, err, perr.Pos, tc.wantPos)
+		}
+	}
+}
+
+func TestParseMatch(t *testing.T) {
+	t.Parallel()
+
+	type S struct {
+		S string
+		I int
+		B bool
+	}
+	for _, tc := range []struct {
+		s    string
+		o    interface{}
+		want bool
+	}{
+		{s: "s eq abc", o: &S{S: "abc"}, want: true},
+		{s: "s eq 13", o: &S{S: "13"}, want: true},
+		{s: "i eq 13", o: &S{I: 13}, want: true},
+		{s: "i ne 13", o: &S{I: 13}},
+		{s: "b eq true", o: &S{B: true}, want: true},
+		{s: "(s eq a.*) OR (i eq 1)", o: &S{I: 1}, want: true},
+		{s: "(s eq a.*) (NOT (i eq 1))", o: &S{S: "abc", I: 1}},
+		{s: "", o: &S{}, want: true},
+	} {
+		fl, err := Parse(tc.s)
+		if err != nil {
+			t.Fatalf("Parse(%q) = %v, want nil", tc.s, err)
+		}
+		if got := fl.Match(tc.o); got != tc.want {
+			t.Errorf("Parse(%q).Match(%+v) = %t, want %t", tc.s, tc.o, got, tc.want)
+		}
+	}
+}
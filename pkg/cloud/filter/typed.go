@@ -0,0 +1,194 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Typed constructs a filter for objects of type T (e.g. ga.ForwardingRule).
+// Field names and value types are checked against T as predicates are added.
+// Checking stops at the first error, which is returned by Filter().
+//
+//	fl, err := filter.For[ga.ForwardingRule]().
+//		AndRegexp("name", "k8s-.*").
+//		AndRegexp("labels.cluster", "c1").
+//		Filter()
+type Typed[T any] struct {
+	fl  *F
+	err error
+}
+
+// For returns an empty typed filter for objects of type T.
+func For[T any]() *Typed[T] {
+	return &Typed[T]{fl: &F{}}
+}
+
+// Filter returns the filter or the first error encountered while
+// constructing it.
+func (t *Typed[T]) Filter() (*F, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	return t.fl, nil
+}
+
+// AndRegexp adds a field ~ string predicate. The field must be a string.
+func (t *Typed[T]) AndRegexp(fieldName, v string) *Typed[T] {
+	if t.check(fieldName, "string", reflect.String) && t.checkRegexp(fieldName, v) {
+		t.fl.AndRegexp(fieldName, v)
+	}
+	return t
+}
+
+// AndNotRegexp adds a field !~ string predicate. The field must be a string.
+func (t *Typed[T]) AndNotRegexp(fieldName, v string) *Typed[T] {
+	if t.check(fieldName, "string", reflect.String) && t.checkRegexp(fieldName, v) {
+		t.fl.AndNotRegexp(fieldName, v)
+	}
+	return t
+}
+
+// AndEqualInt adds a field = int predicate. The field must be a number.
+func (t *Typed[T]) AndEqualInt(fieldName string, v int) *Typed[T] {
+	if t.check(fieldName, "number", numberKinds...) {
+		t.fl.AndEqualInt(fieldName, v)
+	}
+	return t
+}
+
+// AndNotEqualInt adds a field != int predicate. The field must be a number.
+func (t *Typed[T]) AndNotEqualInt(fieldName string, v int) *Typed[T] {
+	if t.check(fieldName, "number", numberKinds...) {
+		t.fl.AndNotEqualInt(fieldName, v)
+	}
+	return t
+}
+
+// AndEqualBool adds a field = bool predicate. The field must be a bool.
+func (t *Typed[T]) AndEqualBool(fieldName string, v bool) *Typed[T] {
+	if t.check(fieldName, "bool", reflect.Bool) {
+		t.fl.AndEqualBool(fieldName, v)
+	}
+	return t
+}
+
+// AndNotEqualBool adds a field != bool predicate. The field must be a bool.
+func (t *Typed[T]) AndNotEqualBool(fieldName string, v bool) *Typed[T] {
+	if t.check(fieldName, "bool", reflect.Bool) {
+		t.fl.AndNotEqualBool(fieldName, v)
+	}
+	return t
+}
+
+// AndOr adds a predicate that matches if any of the filters match.
+func (t *Typed[T]) AndOr(filters ...*Typed[T]) *Typed[T] {
+	var sub []*F
+	for _, f := range filters {
+		if t.err == nil && f.err != nil {
+			t.err = f.err
+		}
+		sub = append(sub, f.fl)
+	}
+	if t.err == nil {
+		t.fl.AndOr(sub...)
+	}
+	return t
+}
+
+// AndNot adds a predicate that matches if rest does not match.
+func (t *Typed[T]) AndNot(rest *Typed[T]) *Typed[T] {
+	if t.err == nil && rest.err != nil {
+		t.err = rest.err
+	}
+	if t.err == nil {
+		t.fl.AndNot(rest.fl)
+	}
+	return t
+}
+
+var numberKinds = []reflect.Kind{
+	reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+	reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+	reflect.Float32, reflect.Float64,
+}
+
+// check that fieldName refers to a field of one of the given kinds in T.
+// typeName is used in the error message. Returns false and records the error
+// if the check fails or a previous check has failed.
+func (t *Typed[T]) check(fieldName, typeName string, kinds ...reflect.Kind) bool {
+	if t.err != nil {
+		return false
+	}
+	root := reflect.TypeOf((*T)(nil)).Elem()
+	ft, err := fieldType(root, fieldName)
+	if err != nil {
+		t.err = err
+		return false
+	}
+	for _, k := range kinds {
+		if ft.Kind() == k {
+			return true
+		}
+	}
+	t.err = fmt.Errorf("filter: field %q of %v is a %v, not a %s", fieldName, root, ft, typeName)
+	return false
+}
+
+func (t *Typed[T]) checkRegexp(fieldName, v string) bool {
+	if _, err := regexp.Compile(v); err != nil {
+		t.err = fmt.Errorf("filter: invalid regexp for field %q: %w", fieldName, err)
+		return false
+	}
+	return true
+}
+
+// fieldType returns the type of the field named by path in type t. The path
+// is resolved the same way as extractValues() resolves it for Match():
+// struct fields are given in snake_case (or camelCase), map keys can be any
+// string and repeated fields refer to the type of their elements.
+func fieldType(t reflect.Type, path string) (reflect.Type, error) {
+	deref := func(t reflect.Type) reflect.Type {
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			t = t.Elem()
+		}
+		return t
+	}
+	root := t
+	for _, f := range strings.Split(path, ".") {
+		t = deref(t)
+		switch t.Kind() {
+		case reflect.Struct:
+			sf, ok := t.FieldByName(snakeToCamelCase(f))
+			if !ok || !sf.IsExported() {
+				return nil, fmt.Errorf("filter: unknown field %q in %q for %v", f, path, root)
+			}
+			t = sf.Type
+		case reflect.Map:
+			if t.Key().Kind() != reflect.String {
+				return nil, fmt.Errorf("filter: map with non-string keys at %q in %q for %v", f, path, root)
+			}
+			t = t.Elem()
+		default:
+			return nil, fmt.Errorf("filter: cannot get field %q in %q from %v for %v", f, path, t, root)
+		}
+	}
+	return deref(t), nil
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"testing"
+
+	ga "google.golang.org/api/compute/v1"
+)
+
+func TestTyped(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name    string
+		fl      interface{ Filter() (*F, error) }
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			fl:   For[ga.Address](),
+			want: "",
+		},
+		{
+			name: "string fields",
+			fl:   For[ga.Address]().AndRegexp("name", "k8s-.*").AndNotRegexp("address_type", "INTERNAL"),
+			want: "(name eq k8s-.*) (address_type ne INTERNAL)",
+		},
+		{
+			name: "camelCase field",
+			fl:   For[ga.Address]().AndRegexp("addressType", "INTERNAL"),
+			want: "addressType eq INTERNAL",
+		},
+		{
+			name: "number and map fields",
+			fl:   For[ga.ForwardingRule]().AndEqualInt("id", 123).AndRegexp("labels.cluster", "c1"),
+			want: "(id eq 123) (labels.cluster eq c1)",
+		},
+		{
+			name: "int64 field",
+			fl:   For[ga.Address]().AndNotEqualInt("prefix_length", 0),
+			want: "prefix_length ne 0",
+		},
+		{
+			name: "repeated field",
+			fl:   For[ga.Address]().AndRegexp("users", ".*/instances/vm"),
+			want: "users eq .*/instances/vm",
+		},
+		{
+			name: "bool field",
+			fl:   For[ga.Network]().AndEqualBool("auto_create_subnetworks", true),
+			want: "auto_create_subnetworks eq true",
+		},
+		{
+			name: "or and not",
+			fl: For[ga.Address]().
+				AndOr(For[ga.Address]().AndRegexp("name", "a"), For[ga.Address]().AndRegexp("name", "b")).
+				AndNot(For[ga.Address]().AndRegexp("region", ".*/us-central1")),
+			want: "((name eq a) OR (name eq b)) (NOT (region eq .*/us-central1))",
+		},
+		{
+			name: "literal is quoted",
+			fl:   For[ga.Address]().AndRegexp("description", `my "address"`),
+			want: `description eq "my \"address\""`,
+		},
+		{
+			name:    "unknown field",
+			fl:      For[ga.Address]().AndRegexp("nmae", "x"),
+			wantErr: true,
+		},
+		{
+			name:    "unknown nested field",
+			fl:      For[ga.BackendService]().AndRegexp("cdn_policy.no_such_field", "x"),
+			wantErr: true,
+		},
+		{
+			name:    "field of a string",
+			fl:      For[ga.Address]().AndRegexp("name.x", "x"),
+			wantErr: true,
+		},
+		{
+			name:    "regexp on number",
+			fl:      For[ga.Address]().AndRegexp("id", "123"),
+			wantErr: true,
+		},
+		{
+			name:    "int on string",
+			fl:      For[ga.Address]().AndEqualInt("name", 1),
+			wantErr: true,
+		},
+		{
+			name:    "bool on string",
+			fl:      For[ga.Address]().AndEqualBool("name", true),
+			wantErr: true,
+		},
+		{
+			name:    "invalid regexp",
+			fl:      For[ga.Address]().AndRegexp("name", "a((("),
+			wantErr: true,
+		},
+		{
+			name:    "error in sub filter",
+			fl:      For[ga.Address]().AndNot(For[ga.Address]().AndRegexp("nmae", "x")),
+			wantErr: true,
+		},
+		{
+			name:    "first error is kept",
+			fl:      For[ga.Address]().AndRegexp("nmae", "x").AndRegexp("name", "x"),
+			wantErr: true,
+		},
+	} {
+		fl, err := tc.fl.Filter()
+		if gotErr := err != nil; gotErr != tc.wantErr {
+			t.Errorf("%s: Filter() = %v, %v; gotErr = %t, want %t", tc.name, fl, err, gotErr, tc.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := fl.String(); got != tc.want {
+			t.Errorf("%s: Filter().String() = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTypedMatch(t *testing.T) {
+	t.Parallel()
+
+	fl, err := For[ga.ForwardingRule]().AndRegexp("labels.cluster", "c1").AndEqualInt("id", 123).Filter()
+	if err != nil {
+		t.Fatalf("Filter() = %v, want nil", err)
+	}
+	if !fl.Match(&ga.ForwardingRule{Id: 123, Labels: map[string]string{"cluster": "c1"}}) {
+		t.Errorf("%v: Match() = false, want true", fl)
+	}
+	if fl.Match(&ga.ForwardingRule{Id: 123}) {
+		t.Errorf("%v: Match() = true, want false", fl)
+	}
+}
@@ -86,6 +86,7 @@ func (g *GCEProjects) SetCommonInstanceMetadata(ctx context.Context, projectID s
 		Operation: "SetCommonInstanceMetadata",
 		Version:   meta.Version("ga"),
 		Service:   "Projects",
+		Mutation:  true,
 	}
 	if err := g.s.RateLimiter.Accept(ctx, rk); err != nil {
 		return err
@@ -173,11 +173,16 @@ type Cloud interface {
 {{- range .All}}
 	{{.WrapType}}() {{.WrapType}}
 {{- end}}
+
+	// ResumeOperation returns the handle for an operation started by one
+	// of the Async methods. See Operation.Ref().
+	ResumeOperation(ref *OperationRef) (Operation, error)
 }
 
 // NewGCE returns a GCE.
 func NewGCE(s *Service) *GCE {
 	g := &GCE{
+		s: s,
 	{{- range .All}}
 		{{.Field}}: &{{.GCEWrapType}}{s},
 	{{- end}}
@@ -190,6 +195,8 @@ var _ Cloud = (*GCE)(nil)
 
 // GCE is the golang adapter for the compute APIs.
 type GCE struct {
+	s *Service
+
 {{- range .All}}
 	{{.Field}} *{{.GCEWrapType}}
 {{- end}}
@@ -224,6 +231,43 @@ type MockGCE struct {
 {{- range .All}}
 	{{.MockField}} *{{.MockWrapType}}
 {{- end}}
+
+	// Operations models long-running operations. This is nil unless
+	// EnableOperations() is called.
+	Operations *MockOperations
+	// References tracks references between objects. This is nil unless
+	// EnableReferences() is called.
+	References *MockReferences
+	// Defaults populates server-side defaults on Insert. This is nil unless
+	// EnableDefaults() is called.
+	Defaults *MockDefaults
+}
+
+// EnableOperations configures all of the mocks to create long-running
+// operations in ops for each mutation.
+func (mock *MockGCE) EnableOperations(ops *MockOperations) {
+	mock.Operations = ops
+{{- range .All}}
+	mock.{{.MockField}}.Operations = ops
+{{- end}}
+}
+
+// EnableReferences configures all of the mocks to enforce referential
+// integrity between objects using refs. See MockReferences.
+func (mock *MockGCE) EnableReferences(refs *MockReferences) {
+	mock.References = refs
+{{- range .All}}
+	mock.{{.MockField}}.References = refs
+{{- end}}
+}
+
+// EnableDefaults configures all of the mocks to populate server-side defaults
+// and output-only fields on Insert using d. See MockDefaults.
+func (mock *MockGCE) EnableDefaults(d *MockDefaults) {
+	mock.Defaults = d
+{{- range .All}}
+	mock.{{.MockField}}.Defaults = d
+{{- end}}
 }
 {{range .All}}
 // {{.WrapType}} returns the interface for the {{.Version}} {{.Service}}.
@@ -309,29 +353,48 @@ type {{.WrapType}} interface {
 {{- if .GenerateList}}
 {{- if .KeyIsGlobal}}
 	List(ctx context.Context, fl *filter.F) ([]*{{.FQObjectType}}, error)
+	ListPages(ctx context.Context, fl *filter.F, opts *ListOptions, f func([]*{{.FQObjectType}}) error) error
+	ListIterator(ctx context.Context, fl *filter.F, opts *ListOptions) *PageIterator[[]*{{.FQObjectType}}]
 {{- end -}}
 {{- if .KeyIsRegional}}
 	List(ctx context.Context, region string, fl *filter.F) ([]*{{.FQObjectType}}, error)
+	ListPages(ctx context.Context, region string, fl *filter.F, opts *ListOptions, f func([]*{{.FQObjectType}}) error) error
+	ListIterator(ctx context.Context, region string, fl *filter.F, opts *ListOptions) *PageIterator[[]*{{.FQObjectType}}]
 {{- end -}}
 {{- if .KeyIsZonal}}
 	List(ctx context.Context, zone string, fl *filter.F) ([]*{{.FQObjectType}}, error)
+	ListPages(ctx context.Context, zone string, fl *filter.F, opts *ListOptions, f func([]*{{.FQObjectType}}) error) error
+	ListIterator(ctx context.Context, zone string, fl *filter.F, opts *ListOptions) *PageIterator[[]*{{.FQObjectType}}]
 {{- end -}}
 {{- end -}}
 {{- if .GenerateInsert}}
 	Insert(ctx context.Context, key *meta.Key, obj *{{.FQObjectType}}) error
+	InsertAsync(ctx context.Context, key *meta.Key, obj *{{.FQObjectType}}) (Operation, error)
 {{- end -}}
 {{- if .GenerateDelete}}
 	Delete(ctx context.Context, key *meta.Key) error
+	DeleteAsync(ctx context.Context, key *meta.Key) (Operation, error)
 {{- end -}}
 {{- if .AggregatedList}}
 	AggregatedList(ctx context.Context, fl *filter.F) (map[string][]*{{.FQObjectType}}, error)
+	AggregatedListPages(ctx context.Context, fl *filter.F, opts *ListOptions, f func(map[string][]*{{.FQObjectType}}) error) error
+	AggregatedListIterator(ctx context.Context, fl *filter.F, opts *ListOptions) *PageIterator[map[string][]*{{.FQObjectType}}]
 {{- end}}
 {{- if .ListUsable}}
 	ListUsable(ctx context.Context, fl *filter.F) ([]*{{.FQListUsableObjectType}}, error)
+	ListUsablePages(ctx context.Context, fl *filter.F, opts *ListOptions, f func([]*{{.FQListUsableObjectType}}) error) error
+	ListUsableIterator(ctx context.Context, fl *filter.F, opts *ListOptions) *PageIterator[[]*{{.FQListUsableObjectType}}]
 {{- end}}
 {{- with .Methods -}}
 {{- range .}}
 	{{.InterfaceFunc}}
+{{- if .IsOperation}}
+	{{.AsyncInterfaceFunc}}
+{{- end -}}
+{{- if .IsPaged}}
+	{{.PagesInterfaceFunc}}
+	{{.IteratorInterfaceFunc}}
+{{- end -}}
 {{- end -}}
 {{- end}}
 }
@@ -364,6 +427,16 @@ type {{.MockWrapType}} struct {
 	// Objects maintained by the mock.
 	Objects map[meta.Key]*Mock{{.Service}}Obj
 
+	// Operations, if non-nil, will be used to model long-running operations
+	// for mutations. See MockGCE.EnableOperations().
+	Operations *MockOperations
+	// References, if non-nil, will be used to enforce referential integrity
+	// on Insert and Delete. See MockGCE.EnableReferences().
+	References *MockReferences
+	// Defaults, if non-nil, will be used to populate server-side defaults on
+	// Insert. See MockGCE.EnableDefaults().
+	Defaults *MockDefaults
+
 	// If an entry exists for the given key and operation, then the error
 	// will be returned instead of the operation.
 	{{- if .GenerateGet}}
@@ -543,6 +616,41 @@ func (m *{{.MockWrapType}}) List(ctx context.Context, zone string, fl *filter.F)
 	{{- end}}
 	return objs, nil
 }
+
+// ListPages calls f for each page of the objects returned by List().
+{{- if .KeyIsGlobal}}
+func (m *{{.MockWrapType}}) ListPages(ctx context.Context, fl *filter.F, opts *ListOptions, f func([]*{{.FQObjectType}}) error) error {
+	return listPages(m.ListIterator(ctx, fl, opts), f)
+}
+{{- end -}}
+{{- if .KeyIsRegional}}
+func (m *{{.MockWrapType}}) ListPages(ctx context.Context, region string, fl *filter.F, opts *ListOptions, f func([]*{{.FQObjectType}}) error) error {
+	return listPages(m.ListIterator(ctx, region, fl, opts), f)
+}
+{{- end -}}
+{{- if .KeyIsZonal}}
+func (m *{{.MockWrapType}}) ListPages(ctx context.Context, zone string, fl *filter.F, opts *ListOptions, f func([]*{{.FQObjectType}}) error) error {
+	return listPages(m.ListIterator(ctx, zone, fl, opts), f)
+}
+{{- end}}
+
+// ListIterator returns an iterator over the objects returned by List() in
+// pages of opts.MaxResults.
+{{- if .KeyIsGlobal}}
+func (m *{{.MockWrapType}}) ListIterator(ctx context.Context, fl *filter.F, opts *ListOptions) *PageIterator[[]*{{.FQObjectType}}] {
+	return newMockPageIterator(ctx, opts, func() ([]*{{.FQObjectType}}, error) { return m.List(ctx, fl) })
+}
+{{- end -}}
+{{- if .KeyIsRegional}}
+func (m *{{.MockWrapType}}) ListIterator(ctx context.Context, region string, fl *filter.F, opts *ListOptions) *PageIterator[[]*{{.FQObjectType}}] {
+	return newMockPageIterator(ctx, opts, func() ([]*{{.FQObjectType}}, error) { return m.List(ctx, region, fl) })
+}
+{{- end -}}
+{{- if .KeyIsZonal}}
+func (m *{{.MockWrapType}}) ListIterator(ctx context.Context, zone string, fl *filter.F, opts *ListOptions) *PageIterator[[]*{{.FQObjectType}}] {
+	return newMockPageIterator(ctx, opts, func() ([]*{{.FQObjectType}}, error) { return m.List(ctx, zone, fl) })
+}
+{{- end}}
 {{- end}}
 
 {{- if .GenerateInsert}}
@@ -577,11 +685,66 @@ func (m *{{.MockWrapType}}) Insert(ctx context.Context, key *meta.Key, obj *{{.F
 	obj.Name = key.Name
 	projectID := m.ProjectRouter.ProjectID(ctx, "{{.Version}}", "{{.Resource}}")
 	obj.SelfLink = SelfLink(meta.Version{{.VersionTitle}}, projectID, "{{.Resource}}", key)
+	if m.Defaults != nil {
+		if err := m.Defaults.apply(projectID, meta.Version{{.VersionTitle}}, "{{.Resource}}", key, obj); err != nil {
+			klog.V(5).Infof("{{.MockWrapType}}.Insert(%v, %v, %+v) = %v", ctx, key, obj, err)
+			return err
+		}
+	}
 
+	if m.Operations != nil {
+		if m.References != nil {
+			if err := m.References.checkInsert(projectID, "{{.Resource}}", key, obj); err != nil {
+				klog.V(5).Infof("{{.MockWrapType}}.Insert(%v, %v, %+v) = %v", ctx, key, obj, err)
+				return err
+			}
+		}
+		// The object is inserted when the operation completes. The lock is
+		// released while waiting for the operation.
+		m.Lock.Unlock()
+		defer m.Lock.Lock()
+
+		opKey := MockOperationKey{Service: "{{.Service}}", Method: "Insert", Key: *key}
+		err := m.Operations.run(ctx, projectID, opKey, meta.Version{{.VersionTitle}}, "{{.Resource}}", func() error {
+			m.Lock.Lock()
+			defer m.Lock.Unlock()
+
+			if _, ok := m.Objects[*key]; ok {
+				return &googleapi.Error{
+					Code: http.StatusConflict,
+					Message: fmt.Sprintf("{{.MockWrapType}} %v exists", key),
+				}
+			}
+			if m.References != nil {
+				if err := m.References.insert(projectID, "{{.Resource}}", key, obj); err != nil {
+					return err
+				}
+			}
+			m.Objects[*key] = &Mock{{.Service}}Obj{obj}
+			return nil
+		})
+		klog.V(5).Infof("{{.MockWrapType}}.Insert(%v, %v, %+v) = %v", ctx, key, obj, err)
+		return err
+	}
+
+	if m.References != nil {
+		if err := m.References.insert(projectID, "{{.Resource}}", key, obj); err != nil {
+			klog.V(5).Infof("{{.MockWrapType}}.Insert(%v, %v, %+v) = %v", ctx, key, obj, err)
+			return err
+		}
+	}
 	m.Objects[*key] = &Mock{{.Service}}Obj{obj}
 	klog.V(5).Infof("{{.MockWrapType}}.Insert(%v, %v, %+v) = nil", ctx, key, obj)
 	return nil
 }
+
+// InsertAsync is a mock for InsertAsync. If operations are enabled, the
+// object is inserted when the returned operation completes.
+func (m *{{.MockWrapType}}) InsertAsync(ctx context.Context, key *meta.Key, obj *{{.FQObjectType}}) (Operation, error) {
+	projectID := m.ProjectRouter.ProjectID(ctx, "{{.Version}}", "{{.Resource}}")
+	target := &ResourceID{projectID, "{{.Resource}}", key}
+	return mockAsync(ctx, meta.Version{{.VersionTitle}}, target, func(ctx context.Context) error { return m.Insert(ctx, key, obj) })
+}
 {{- end}}
 
 {{- if .GenerateDelete}}
@@ -613,10 +776,60 @@ func (m *{{.MockWrapType}}) Delete(ctx context.Context, key *meta.Key) error {
 		return err
 	}
 
+	projectID := m.ProjectRouter.ProjectID(ctx, "{{.Version}}", "{{.Resource}}")
+	if m.Operations != nil {
+		if m.References != nil {
+			if err := m.References.checkDelete(projectID, "{{.Resource}}", key); err != nil {
+				klog.V(5).Infof("{{.MockWrapType}}.Delete(%v, %v) = %v", ctx, key, err)
+				return err
+			}
+		}
+		// The object is deleted when the operation completes. The lock is
+		// released while waiting for the operation.
+		m.Lock.Unlock()
+		defer m.Lock.Lock()
+
+		opKey := MockOperationKey{Service: "{{.Service}}", Method: "Delete", Key: *key}
+		err := m.Operations.run(ctx, projectID, opKey, meta.Version{{.VersionTitle}}, "{{.Resource}}", func() error {
+			m.Lock.Lock()
+			defer m.Lock.Unlock()
+
+			if _, ok := m.Objects[*key]; !ok {
+				return &googleapi.Error{
+					Code: http.StatusNotFound,
+					Message: fmt.Sprintf("{{.MockWrapType}} %v not found", key),
+				}
+			}
+			if m.References != nil {
+				if err := m.References.delete(projectID, "{{.Resource}}", key); err != nil {
+					return err
+				}
+			}
+			delete(m.Objects, *key)
+			return nil
+		})
+		klog.V(5).Infof("{{.MockWrapType}}.Delete(%v, %v) = %v", ctx, key, err)
+		return err
+	}
+
+	if m.References != nil {
+		if err := m.References.delete(projectID, "{{.Resource}}", key); err != nil {
+			klog.V(5).Infof("{{.MockWrapType}}.Delete(%v, %v) = %v", ctx, key, err)
+			return err
+		}
+	}
 	delete(m.Objects, *key)
 	klog.V(5).Infof("{{.MockWrapType}}.Delete(%v, %v) = nil", ctx, key)
 	return nil
 }
+
+// DeleteAsync is a mock for DeleteAsync. If operations are enabled, the
+// object is deleted when the returned operation completes.
+func (m *{{.MockWrapType}}) DeleteAsync(ctx context.Context, key *meta.Key) (Operation, error) {
+	projectID := m.ProjectRouter.ProjectID(ctx, "{{.Version}}", "{{.Resource}}")
+	target := &ResourceID{projectID, "{{.Resource}}", key}
+	return mockAsync(ctx, meta.Version{{.VersionTitle}}, target, func(ctx context.Context) error { return m.Delete(ctx, key) })
+}
 {{- end}}
 
 {{- if .AggregatedList}}
@@ -654,6 +867,18 @@ func (m *{{.MockWrapType}}) AggregatedList(ctx context.Context, fl *filter.F) (m
 	klog.V(5).Infof("{{.MockWrapType}}.AggregatedList(%v, %v) = [%v items], nil", ctx, fl, len(objs))
 	return objs, nil
 }
+
+// AggregatedListPages calls f for each page of the objects returned by
+// AggregatedList().
+func (m *{{.MockWrapType}}) AggregatedListPages(ctx context.Context, fl *filter.F, opts *ListOptions, f func(map[string][]*{{.FQObjectType}}) error) error {
+	return listPages(m.AggregatedListIterator(ctx, fl, opts), f)
+}
+
+// AggregatedListIterator returns an iterator over the objects returned by
+// AggregatedList() in pages of opts.MaxResults.
+func (m *{{.MockWrapType}}) AggregatedListIterator(ctx context.Context, fl *filter.F, opts *ListOptions) *PageIterator[map[string][]*{{.FQObjectType}}] {
+	return newMockAggregatedPageIterator(ctx, opts, func() (map[string][]*{{.FQObjectType}}, error) { return m.AggregatedList(ctx, fl) })
+}
 {{- end}}
 
 {{- if .ListUsable}}
@@ -692,6 +917,18 @@ func (m *{{.MockWrapType}}) ListUsable(ctx context.Context, fl *filter.F) ([]*{{
   klog.V(5).Infof("{{.MockWrapType}}.ListUsable(%v, %v) = [%v items], nil", ctx, fl, len(objs))
 	return objs, nil
 }
+
+// ListUsablePages calls f for each page of the objects returned by
+// ListUsable().
+func (m *{{.MockWrapType}}) ListUsablePages(ctx context.Context, fl *filter.F, opts *ListOptions, f func([]*{{.FQListUsableObjectType}}) error) error {
+	return listPages(m.ListUsableIterator(ctx, fl, opts), f)
+}
+
+// ListUsableIterator returns an iterator over the objects returned by
+// ListUsable() in pages of opts.MaxResults.
+func (m *{{.MockWrapType}}) ListUsableIterator(ctx context.Context, fl *filter.F, opts *ListOptions) *PageIterator[[]*{{.FQListUsableObjectType}}] {
+	return newMockPageIterator(ctx, opts, func() ([]*{{.FQListUsableObjectType}}, error) { return m.ListUsable(ctx, fl) })
+}
 {{- end}}
 
 // Obj wraps the object for use in the mock.
@@ -703,7 +940,68 @@ func (m *{{.MockWrapType}}) Obj(o *{{.FQObjectType}}) *Mock{{.Service}}Obj {
 {{- range .}}
 // {{.Name}} is a mock for the corresponding method.
 func (m *{{.MockWrapType}}) {{.FcnArgs}} {
-{{- if .IsOperation }}
+{{- if .HasMockDefault }}
+	apply := func() error {
+		if m.{{.MockHookName}} != nil {
+			return m.{{.MockHookName}}(ctx, key {{.CallArgs}}, m)
+		}
+		return m.default{{.Name}}(ctx, key {{.CallArgs}})
+	}
+	if m.Operations != nil {
+		// The mutation is applied when the operation completes.
+		projectID := m.ProjectRouter.ProjectID(ctx, "{{.Version}}", "{{.Resource}}")
+		opKey := MockOperationKey{Service: "{{.Service}}", Method: "{{.Name}}", Key: *key}
+		return m.Operations.run(ctx, projectID, opKey, meta.Version{{.VersionTitle}}, "{{.Resource}}", apply)
+	}
+	return apply()
+}
+
+// default{{.Name}} is used by {{.Name}}() if no hook is set. See
+// mockApplyUpdate() for details.
+func (m *{{.MockWrapType}}) default{{.Name}}(ctx context.Context, key *meta.Key, arg0 {{.MockDefaultArgType}}) error {
+	if !key.Valid() {
+		return fmt.Errorf("invalid GCE key (%+v)", key)
+	}
+
+	m.Lock.Lock()
+	defer m.Lock.Unlock()
+
+	obj, ok := m.Objects[*key]
+	if !ok {
+		err := &googleapi.Error{
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("{{.MockWrapType}} %v not found", key),
+		}
+		klog.V(5).Infof("{{.MockWrapType}}.{{.Name}}(%v, %v, %+v) = %v", ctx, key, arg0, err)
+		return err
+	}
+	updated := &{{.FQObjectType}}{}
+	if err := mockApplyUpdate("{{.Name}}", obj.To{{.VersionTitle}}(), arg0, updated); err != nil {
+		klog.V(5).Infof("{{.MockWrapType}}.{{.Name}}(%v, %v, %+v) = %v", ctx, key, arg0, err)
+		return err
+	}
+	if m.References != nil {
+		projectID := m.ProjectRouter.ProjectID(ctx, "{{.Version}}", "{{.Resource}}")
+		if err := m.References.Update(projectID, "{{.Resource}}", key, updated); err != nil {
+			klog.V(5).Infof("{{.MockWrapType}}.{{.Name}}(%v, %v, %+v) = %v", ctx, key, arg0, err)
+			return err
+		}
+	}
+	m.Objects[*key] = &Mock{{.Service}}Obj{updated}
+	klog.V(5).Infof("{{.MockWrapType}}.{{.Name}}(%v, %v, %+v) = nil", ctx, key, arg0)
+	return nil
+{{- else if .IsOperation }}
+	if m.Operations != nil {
+		// The hook is called when the operation completes.
+		projectID := m.ProjectRouter.ProjectID(ctx, "{{.Version}}", "{{.Resource}}")
+		opKey := MockOperationKey{Service: "{{.Service}}", Method: "{{.Name}}", Key: *key}
+		return m.Operations.run(ctx, projectID, opKey, meta.Version{{.VersionTitle}}, "{{.Resource}}", func() error {
+			if m.{{.MockHookName}} != nil {
+				return m.{{.MockHookName}}(ctx, key {{.CallArgs}}, m)
+			}
+			return nil
+		})
+	}
 	if m.{{.MockHookName}} != nil {
 		return m.{{.MockHookName}}(ctx, key {{.CallArgs}}, m)
 	}
@@ -720,6 +1018,30 @@ func (m *{{.MockWrapType}}) {{.FcnArgs}} {
 	return nil, nil
 {{- end}}
 }
+{{- if .IsPaged}}
+
+// {{.Name}}Pages calls f for each page of the objects returned by
+// {{.Name}}().
+func (m *{{.MockWrapType}}) {{.PagesFcnArgs}} {
+	return listPages(m.{{.Name}}Iterator(ctx, key {{.CallArgs}}, fl, opts), f)
+}
+
+// {{.Name}}Iterator returns an iterator over the objects returned by
+// {{.Name}}() in pages of opts.MaxResults.
+func (m *{{.MockWrapType}}) {{.IteratorFcnArgs}} {
+	return newMockPageIterator(ctx, opts, func() ({{.PageType}}, error) { return m.{{.Name}}(ctx, key {{.CallArgs}}, fl) })
+}
+{{- end}}
+{{- if .IsOperation}}
+
+// {{.Name}}Async is a mock for {{.Name}}Async. If operations are enabled, the
+// mutation is applied when the returned operation completes.
+func (m *{{.MockWrapType}}) {{.AsyncFcnArgs}} {
+	projectID := m.ProjectRouter.ProjectID(ctx, "{{.Version}}", "{{.Resource}}")
+	target := &ResourceID{projectID, "{{.Resource}}", key}
+	return mockAsync(ctx, meta.Version{{.VersionTitle}}, target, func(ctx context.Context) error { return m.{{.Name}}(ctx, key {{.CallArgs}}) })
+}
+{{- end}}
 {{end -}}
 {{- end}}
 // {{.GCEWrapType}} is a simplifying adapter for the GCE {{.Service}}.
@@ -742,11 +1064,15 @@ func (g *{{.GCEWrapType}}) Get(ctx context.Context, key *meta.Key) (*{{.FQObject
 		Operation: "Get",
 		Version: meta.Version("{{.Version}}"),
 		Service: "{{.Service}}",
+		Key: *key,
 	}
 
 	klog.V(5).Infof("{{.GCEWrapType}}.Get(%v, %v): projectID = %v, ck = %+v", ctx, key, projectID, ck)
-	callObserverStart(ctx, ck)
-	if err := g.s.RateLimiter.Accept(ctx, ck); err != nil {
+	ctx = startCallSpan(ctx, ck)
+	g.s.callObserverStart(ctx, ck)
+	if err := g.s.acceptRateLimit(ctx, ck); err != nil {
+		g.s.callObserverEnd(ctx, ck, err)
+		endCallSpan(ctx, err)
 		klog.V(4).Infof("{{.GCEWrapType}}.Get(%v, %v): RateLimiter error: %v", ctx, key, err)
 		return nil, err
 	}
@@ -760,11 +1086,17 @@ func (g *{{.GCEWrapType}}) Get(ctx context.Context, key *meta.Key) (*{{.FQObject
 {{- if .KeyIsZonal}}
 	call := g.s.{{.VersionTitle}}.{{.Service}}.Get(projectID, key.Zone, key.Name)
 {{- end}}
-	call.Context(ctx)
-	v, err := call.Do()
+	v, err := intercept(ctx, g.s, &Call{Key: ck, Header: call.Header()}, func(ctx context.Context) (*{{.FQObjectType}}, error) {
+		reqCtx, reqSpan := startSpan(ctx, SpanRequest)
+		call.Context(reqCtx)
+		v, err := call.Do()
+		endSpan(reqSpan, err)
+		return v, err
+	})
 	klog.V(4).Infof("{{.GCEWrapType}}.Get(%v, %v) = %+v, %v", ctx, key, v, err)
 
-	callObserverEnd(ctx, ck, err)
+	g.s.callObserverEnd(ctx, ck, err)
+	endCallSpan(ctx, err)
 	g.s.RateLimiter.Observe(ctx, err, ck)
 
 	return v, err
@@ -791,10 +1123,20 @@ func (g *{{.GCEWrapType}}) List(ctx context.Context, zone string, fl *filter.F)
 		Operation: "List",
 		Version: meta.Version("{{.Version}}"),
 		Service: "{{.Service}}",
+{{- if .KeyIsRegional}}
+		Key: meta.Key{Region: region},
+{{- end}}
+{{- if .KeyIsZonal}}
+		Key: meta.Key{Zone: zone},
+{{- end}}
 	}
 
-	callObserverStart(ctx, ck)
-	if err := g.s.RateLimiter.Accept(ctx, ck); err != nil {
+	ctx = startCallSpan(ctx, ck)
+	g.s.callObserverStart(ctx, ck)
+	setSpanFilter(ctx, fl)
+	if err := g.s.acceptRateLimit(ctx, ck); err != nil {
+		g.s.callObserverEnd(ctx, ck, err)
+		endCallSpan(ctx, err)
 		return nil, err
 	}
 
@@ -819,15 +1161,24 @@ func (g *{{.GCEWrapType}}) List(ctx context.Context, zone string, fl *filter.F)
 		all = append(all, l.Items...)
 		return nil
 	}
-	if err := call.Pages(ctx, f); err != nil {
-		callObserverEnd(ctx, ck, err)
+	all, err := intercept(ctx, g.s, &Call{Key: ck, Header: call.Header()}, func(ctx context.Context) ([]*{{.FQObjectType}}, error) {
+		// The invoker may be called more than once, e.g. by a retrying
+		// interceptor.
+		all = nil
+		err := call.Pages(ctx, f)
+		return all, err
+	})
+	if err != nil {
+		g.s.callObserverEnd(ctx, ck, err)
+		endCallSpan(ctx, err)
 		g.s.RateLimiter.Observe(ctx, err, ck)
 
 		klog.V(4).Infof("{{.GCEWrapType}}.List(%v, ..., %v) = %v, %v", ctx, fl, nil, err)
 		return nil, err
 	}
 
-    callObserverEnd(ctx, ck, nil)
+	g.s.callObserverEnd(ctx, ck, nil)
+	endCallSpan(ctx, nil)
 	g.s.RateLimiter.Observe(ctx, nil, ck)
 
 	if kLogEnabled(4) {
@@ -842,15 +1193,119 @@ func (g *{{.GCEWrapType}}) List(ctx context.Context, zone string, fl *filter.F)
 
 	return all, nil
 }
+
+// ListPages calls f for each page of {{.Object}} objects. See ListIterator().
+{{- if .KeyIsGlobal}}
+func (g *{{.GCEWrapType}}) ListPages(ctx context.Context, fl *filter.F, opts *ListOptions, f func([]*{{.FQObjectType}}) error) error {
+	return listPages(g.ListIterator(ctx, fl, opts), f)
+}
+{{- end -}}
+{{- if .KeyIsRegional}}
+func (g *{{.GCEWrapType}}) ListPages(ctx context.Context, region string, fl *filter.F, opts *ListOptions, f func([]*{{.FQObjectType}}) error) error {
+	return listPages(g.ListIterator(ctx, region, fl, opts), f)
+}
+{{- end -}}
+{{- if .KeyIsZonal}}
+func (g *{{.GCEWrapType}}) ListPages(ctx context.Context, zone string, fl *filter.F, opts *ListOptions, f func([]*{{.FQObjectType}}) error) error {
+	return listPages(g.ListIterator(ctx, zone, fl, opts), f)
+}
+{{- end}}
+
+// ListIterator returns an iterator over the pages of {{.Object}} objects.
+// Each page is fetched with a separate (rate limited) call.
+{{- if .KeyIsGlobal}}
+func (g *{{.GCEWrapType}}) ListIterator(ctx context.Context, fl *filter.F, opts *ListOptions) *PageIterator[[]*{{.FQObjectType}}] {
+{{- end -}}
+{{- if .KeyIsRegional}}
+func (g *{{.GCEWrapType}}) ListIterator(ctx context.Context, region string, fl *filter.F, opts *ListOptions) *PageIterator[[]*{{.FQObjectType}}] {
+{{- end -}}
+{{- if .KeyIsZonal}}
+func (g *{{.GCEWrapType}}) ListIterator(ctx context.Context, zone string, fl *filter.F, opts *ListOptions) *PageIterator[[]*{{.FQObjectType}}] {
+{{- end}}
+	projectID := g.s.ProjectRouter.ProjectID(ctx, "{{.Version}}", "{{.Service}}")
+	ck := &CallContextKey{
+		ProjectID: projectID,
+		Operation: "List",
+		Version:   meta.Version("{{.Version}}"),
+		Service:   "{{.Service}}",
+{{- if .KeyIsRegional}}
+		Key: meta.Key{Region: region},
+{{- end}}
+{{- if .KeyIsZonal}}
+		Key: meta.Key{Zone: zone},
+{{- end}}
+	}
+{{- if .KeyIsGlobal}}
+	call := g.s.{{.VersionTitle}}.{{.Service}}.List(projectID)
+{{- end -}}
+{{- if .KeyIsRegional}}
+	call := g.s.{{.VersionTitle}}.{{.Service}}.List(projectID, region)
+{{- end -}}
+{{- if .KeyIsZonal}}
+	call := g.s.{{.VersionTitle}}.{{.Service}}.List(projectID, zone)
+{{- end}}
+	if fl != filter.None {
+		call.Filter(fl.String())
+	}
+	if n := opts.maxResults(); n > 0 {
+		call.MaxResults(n)
+	}
+	return newPageIterator(ctx, func(ctx context.Context, pageToken string) ([]*{{.FQObjectType}}, string, error) {
+		klog.V(5).Infof("{{.GCEWrapType}}.ListIterator(%v, ..., %v): page %q, projectID = %v, ck = %+v", ctx, fl, pageToken, projectID, ck)
+		ctx = startCallSpan(ctx, ck)
+		g.s.callObserverStart(ctx, ck)
+		setSpanFilter(ctx, fl)
+		if err := g.s.acceptRateLimit(ctx, ck); err != nil {
+			g.s.callObserverEnd(ctx, ck, err)
+			endCallSpan(ctx, err)
+			return nil, "", err
+		}
+		call.PageToken(pageToken)
+		l, err := intercept(ctx, g.s, &Call{Key: ck, Header: call.Header()}, func(ctx context.Context) (*{{.ObjectListType}}, error) {
+			reqCtx, reqSpan := startSpan(ctx, SpanRequest)
+			call.Context(reqCtx)
+			l, err := call.Do()
+			endSpan(reqSpan, err)
+			return l, err
+		})
+
+		g.s.callObserverEnd(ctx, ck, err)
+		endCallSpan(ctx, err)
+		g.s.RateLimiter.Observe(ctx, err, ck)
+
+		if err != nil {
+			klog.V(4).Infof("{{.GCEWrapType}}.ListIterator(%v, ..., %v): page %q = %v", ctx, fl, pageToken, err)
+			return nil, "", err
+		}
+		klog.V(4).Infof("{{.GCEWrapType}}.ListIterator(%v, ..., %v): page %q = [%v items], next %q", ctx, fl, pageToken, len(l.Items), l.NextPageToken)
+		return l.Items, l.NextPageToken, nil
+	})
+}
 {{- end}}
 
 {{- if .GenerateInsert}}
 // Insert {{.Object}} with key of value obj.
 func (g *{{.GCEWrapType}}) Insert(ctx context.Context, key *meta.Key, obj *{{.FQObjectType}}) error {
-	klog.V(5).Infof("{{.GCEWrapType}}.Insert(%v, %v, %+v): called", ctx, key, obj)
+	sc := &syncCall{}
+	op, err := g.insertAsync(ctx, key, obj, sc)
+	err = sc.wait(op, err)
+	klog.V(4).Infof("{{.GCEWrapType}}.Insert(%v, %v, %+v) = %+v", ctx, key, obj, err)
+	return err
+}
+
+// InsertAsync starts inserting {{.Object}} with key of value obj. The
+// returned Operation completes when the object has been inserted.
+func (g *{{.GCEWrapType}}) InsertAsync(ctx context.Context, key *meta.Key, obj *{{.FQObjectType}}) (Operation, error) {
+	return g.insertAsync(ctx, key, obj, nil)
+}
+
+// insertAsync implements InsertAsync. The end of the call is deferred to
+// sc, if set.
+func (g *{{.GCEWrapType}}) insertAsync(ctx context.Context, key *meta.Key, obj *{{.FQObjectType}}, sc *syncCall) (Operation, error) {
+	klog.V(5).Infof("{{.GCEWrapType}}.InsertAsync(%v, %v, %+v): called", ctx, key, obj)
 	if !key.Valid() {
-		klog.V(2).Infof("{{.GCEWrapType}}.Insert(%v, %v, ...): key is invalid (%#v)", ctx, key, key)
-		return fmt.Errorf("invalid GCE key (%+v)", key)
+		klog.V(2).Infof("{{.GCEWrapType}}.InsertAsync(%v, %v, ...): key is invalid (%#v)", ctx, key, key)
+		return nil, fmt.Errorf("invalid GCE key (%+v)", key)
 	}
 	projectID := g.s.ProjectRouter.ProjectID(ctx, "{{.Version}}", "{{.Service}}")
 	ck:= &CallContextKey{
@@ -858,13 +1313,18 @@ func (g *{{.GCEWrapType}}) Insert(ctx context.Context, key *meta.Key, obj *{{.FQ
 		Operation: "Insert",
 		Version: meta.Version("{{.Version}}"),
 		Service: "{{.Service}}",
+		Key: *key,
+		Mutation: true,
 	}
 
-	klog.V(5).Infof("{{.GCEWrapType}}.Insert(%v, %v, ...): projectID = %v, ck = %+v", ctx, key, projectID, ck)
-	callObserverStart(ctx, ck)
-	if err := g.s.RateLimiter.Accept(ctx, ck); err != nil {
-		klog.V(4).Infof("{{.GCEWrapType}}.Insert(%v, %v, ...): RateLimiter error: %v", ctx, key, err)
-		return err
+	klog.V(5).Infof("{{.GCEWrapType}}.InsertAsync(%v, %v, ...): projectID = %v, ck = %+v", ctx, key, projectID, ck)
+	ctx = startCallSpan(ctx, ck)
+	g.s.callObserverStart(ctx, ck)
+	if err := g.s.acceptRateLimit(ctx, ck); err != nil {
+		g.s.callObserverEnd(ctx, ck, err)
+		endCallSpan(ctx, err)
+		klog.V(4).Infof("{{.GCEWrapType}}.InsertAsync(%v, %v, ...): RateLimiter error: %v", ctx, key, err)
+		return nil, err
 	}
 	obj.Name = key.Name
 
@@ -877,31 +1337,47 @@ func (g *{{.GCEWrapType}}) Insert(ctx context.Context, key *meta.Key, obj *{{.FQ
 {{- if .KeyIsZonal}}
 	call := g.s.{{.VersionTitle}}.{{.Service}}.Insert(projectID, key.Zone, obj)
 {{- end}}
-	call.Context(ctx)
+	op, err := intercept(ctx, g.s, &Call{Key: ck, Request: obj, Header: call.Header()}, func(ctx context.Context) (*{{.Version}}.Operation, error) {
+		reqCtx, reqSpan := startSpan(ctx, SpanRequest)
+		call.Context(reqCtx)
+		op, err := call.Do()
+		endSpan(reqSpan, err)
+		return op, err
+	})
 
-	op, err := call.Do()
-
-	callObserverEnd(ctx, ck, err)
-	g.s.RateLimiter.Observe(ctx, err, ck)
+	g.s.endCall(ctx, ck, sc, err)
 
 	if err != nil {
-		klog.V(4).Infof("{{.GCEWrapType}}.Insert(%v, %v, ...) = %+v", ctx, key, err)
-		return err
+		klog.V(4).Infof("{{.GCEWrapType}}.InsertAsync(%v, %v, ...) = %+v", ctx, key, err)
+		return nil, err
 	}
-
-	err = g.s.WaitForCompletion(ctx, op)
-	klog.V(4).Infof("{{.GCEWrapType}}.Insert(%v, %v, %+v) = %+v", ctx, key, obj, err)
-	return err
+	return g.s.newOperation(ctx, ck, op, &ResourceID{projectID, "{{.Resource}}", key})
 }
 {{- end}}
 
 {{- if .GenerateDelete}}
 // Delete the {{.Object}} referenced by key.
 func (g *{{.GCEWrapType}}) Delete(ctx context.Context, key *meta.Key) error {
-	klog.V(5).Infof("{{.GCEWrapType}}.Delete(%v, %v): called", ctx, key)
+	sc := &syncCall{}
+	op, err := g.deleteAsync(ctx, key, sc)
+	err = sc.wait(op, err)
+	klog.V(4).Infof("{{.GCEWrapType}}.Delete(%v, %v) = %v", ctx, key, err)
+	return err
+}
+
+// DeleteAsync starts deleting the {{.Object}} referenced by key. The
+// returned Operation completes when the object has been deleted.
+func (g *{{.GCEWrapType}}) DeleteAsync(ctx context.Context, key *meta.Key) (Operation, error) {
+	return g.deleteAsync(ctx, key, nil)
+}
+
+// deleteAsync implements DeleteAsync. The end of the call is deferred to
+// sc, if set.
+func (g *{{.GCEWrapType}}) deleteAsync(ctx context.Context, key *meta.Key, sc *syncCall) (Operation, error) {
+	klog.V(5).Infof("{{.GCEWrapType}}.DeleteAsync(%v, %v): called", ctx, key)
 	if !key.Valid() {
-		klog.V(2).Infof("{{.GCEWrapType}}.Delete(%v, %v): key is invalid (%#v)", ctx, key, key)
-		return fmt.Errorf("invalid GCE key (%+v)", key)
+		klog.V(2).Infof("{{.GCEWrapType}}.DeleteAsync(%v, %v): key is invalid (%#v)", ctx, key, key)
+		return nil, fmt.Errorf("invalid GCE key (%+v)", key)
 	}
 	projectID := g.s.ProjectRouter.ProjectID(ctx, "{{.Version}}", "{{.Service}}")
 	ck:= &CallContextKey{
@@ -909,12 +1385,17 @@ func (g *{{.GCEWrapType}}) Delete(ctx context.Context, key *meta.Key) error {
 		Operation: "Delete",
 		Version: meta.Version("{{.Version}}"),
 		Service: "{{.Service}}",
-	}
-	klog.V(5).Infof("{{.GCEWrapType}}.Delete(%v, %v): projectID = %v, ck = %+v", ctx, key, projectID, ck)
-	callObserverStart(ctx, ck)
-	if err := g.s.RateLimiter.Accept(ctx, ck); err != nil {
-		klog.V(4).Infof("{{.GCEWrapType}}.Delete(%v, %v): RateLimiter error: %v", ctx, key, err)
-		return err
+		Key: *key,
+		Mutation: true,
+	}
+	klog.V(5).Infof("{{.GCEWrapType}}.DeleteAsync(%v, %v): projectID = %v, ck = %+v", ctx, key, projectID, ck)
+	ctx = startCallSpan(ctx, ck)
+	g.s.callObserverStart(ctx, ck)
+	if err := g.s.acceptRateLimit(ctx, ck); err != nil {
+		g.s.callObserverEnd(ctx, ck, err)
+		endCallSpan(ctx, err)
+		klog.V(4).Infof("{{.GCEWrapType}}.DeleteAsync(%v, %v): RateLimiter error: %v", ctx, key, err)
+		return nil, err
 	}
 
 {{- if .KeyIsGlobal}}
@@ -926,21 +1407,21 @@ func (g *{{.GCEWrapType}}) Delete(ctx context.Context, key *meta.Key) error {
 {{- if .KeyIsZonal}}
 	call := g.s.{{.VersionTitle}}.{{.Service}}.Delete(projectID, key.Zone, key.Name)
 {{- end}}
-	call.Context(ctx)
+	op, err := intercept(ctx, g.s, &Call{Key: ck, Header: call.Header()}, func(ctx context.Context) (*{{.Version}}.Operation, error) {
+		reqCtx, reqSpan := startSpan(ctx, SpanRequest)
+		call.Context(reqCtx)
+		op, err := call.Do()
+		endSpan(reqSpan, err)
+		return op, err
+	})
 
-	op, err := call.Do()
-
-	callObserverEnd(ctx, ck, err)
-	g.s.RateLimiter.Observe(ctx, err, ck)
+	g.s.endCall(ctx, ck, sc, err)
 
 	if err != nil {
-		klog.V(4).Infof("{{.GCEWrapType}}.Delete(%v, %v) = %v", ctx, key, err)
-		return err
+		klog.V(4).Infof("{{.GCEWrapType}}.DeleteAsync(%v, %v) = %v", ctx, key, err)
+		return nil, err
 	}
-
-	err = g.s.WaitForCompletion(ctx, op)
-	klog.V(4).Infof("{{.GCEWrapType}}.Delete(%v, %v) = %v", ctx, key, err)
-	return err
+	return g.s.newOperation(ctx, ck, op, &ResourceID{projectID, "{{.Resource}}", key})
 }
 {{end -}}
 
@@ -958,8 +1439,12 @@ func (g *{{.GCEWrapType}}) AggregatedList(ctx context.Context, fl *filter.F) (ma
 	}
 
 	klog.V(5).Infof("{{.GCEWrapType}}.AggregatedList(%v, %v): projectID = %v, ck = %+v", ctx, fl, projectID, ck)
-	callObserverStart(ctx, ck)
-	if err := g.s.RateLimiter.Accept(ctx, ck); err != nil {
+	ctx = startCallSpan(ctx, ck)
+	g.s.callObserverStart(ctx, ck)
+	setSpanFilter(ctx, fl)
+	if err := g.s.acceptRateLimit(ctx, ck); err != nil {
+		g.s.callObserverEnd(ctx, ck, err)
+		endCallSpan(ctx, err)
 		klog.V(5).Infof("{{.GCEWrapType}}.AggregatedList(%v, %v): RateLimiter error: %v", ctx, fl, err)
 		return nil, err
 	}
@@ -978,8 +1463,16 @@ func (g *{{.GCEWrapType}}) AggregatedList(ctx context.Context, fl *filter.F) (ma
 		}
 		return nil
 	}
-	if err := call.Pages(ctx, f); err != nil {
-		callObserverEnd(ctx, ck, err)
+	all, err := intercept(ctx, g.s, &Call{Key: ck, Header: call.Header()}, func(ctx context.Context) (map[string][]*{{.FQObjectType}}, error) {
+		// The invoker may be called more than once, e.g. by a retrying
+		// interceptor.
+		all = map[string][]*{{.FQObjectType}}{}
+		err := call.Pages(ctx, f)
+		return all, err
+	})
+	if err != nil {
+		g.s.callObserverEnd(ctx, ck, err)
+		endCallSpan(ctx, err)
 		g.s.RateLimiter.Observe(ctx, err, ck)
 
 		klog.V(4).Infof("{{.GCEWrapType}}.AggregatedList(%v, %v) = %v, %v", ctx, fl, nil, err)
@@ -996,6 +1489,68 @@ func (g *{{.GCEWrapType}}) AggregatedList(ctx context.Context, fl *filter.F) (ma
 	}
 	return all, nil
 }
+
+// AggregatedListPages calls f for each page of {{.Object}} objects across
+// all locations. See AggregatedListIterator().
+func (g *{{.GCEWrapType}}) AggregatedListPages(ctx context.Context, fl *filter.F, opts *ListOptions, f func(map[string][]*{{.FQObjectType}}) error) error {
+	return listPages(g.AggregatedListIterator(ctx, fl, opts), f)
+}
+
+// AggregatedListIterator returns an iterator over the pages of {{.Object}}
+// objects across all locations. Each page is fetched with a separate (rate
+// limited) call.
+func (g *{{.GCEWrapType}}) AggregatedListIterator(ctx context.Context, fl *filter.F, opts *ListOptions) *PageIterator[map[string][]*{{.FQObjectType}}] {
+	projectID := g.s.ProjectRouter.ProjectID(ctx, "{{.Version}}", "{{.Service}}")
+	ck := &CallContextKey{
+		ProjectID: projectID,
+		Operation: "AggregatedList",
+		Version:   meta.Version("{{.Version}}"),
+		Service:   "{{.Service}}",
+	}
+	call := g.s.{{.VersionTitle}}.{{.Service}}.AggregatedList(projectID)
+	if fl != filter.None {
+		call.Filter(fl.String())
+	}
+	if n := opts.maxResults(); n > 0 {
+		call.MaxResults(n)
+	}
+	return newPageIterator(ctx, func(ctx context.Context, pageToken string) (map[string][]*{{.FQObjectType}}, string, error) {
+		klog.V(5).Infof("{{.GCEWrapType}}.AggregatedListIterator(%v, %v): page %q, projectID = %v, ck = %+v", ctx, fl, pageToken, projectID, ck)
+		ctx = startCallSpan(ctx, ck)
+		g.s.callObserverStart(ctx, ck)
+		setSpanFilter(ctx, fl)
+		if err := g.s.acceptRateLimit(ctx, ck); err != nil {
+			g.s.callObserverEnd(ctx, ck, err)
+			endCallSpan(ctx, err)
+			return nil, "", err
+		}
+		call.PageToken(pageToken)
+		l, err := intercept(ctx, g.s, &Call{Key: ck, Header: call.Header()}, func(ctx context.Context) (*{{.ObjectAggregatedListType}}, error) {
+			reqCtx, reqSpan := startSpan(ctx, SpanRequest)
+			call.Context(reqCtx)
+			l, err := call.Do()
+			endSpan(reqSpan, err)
+			return l, err
+		})
+
+		g.s.callObserverEnd(ctx, ck, err)
+		endCallSpan(ctx, err)
+		g.s.RateLimiter.Observe(ctx, err, ck)
+
+		if err != nil {
+			klog.V(4).Infof("{{.GCEWrapType}}.AggregatedListIterator(%v, %v): page %q = %v", ctx, fl, pageToken, err)
+			return nil, "", err
+		}
+		page := map[string][]*{{.FQObjectType}}{}
+		for k, v := range l.Items {
+			if len(v.{{.AggregatedListField}}) > 0 {
+				page[k] = v.{{.AggregatedListField}}
+			}
+		}
+		klog.V(4).Infof("{{.GCEWrapType}}.AggregatedListIterator(%v, %v): page %q = [%v locations], next %q", ctx, fl, pageToken, len(page), l.NextPageToken)
+		return page, l.NextPageToken, nil
+	})
+}
 {{- end}}
 
 {{- if .ListUsable}}
@@ -1009,8 +1564,12 @@ func (g *{{.GCEWrapType}}) ListUsable(ctx context.Context, fl *filter.F) ([]*{{.
 		Version: meta.Version("{{.Version}}"),
 		Service: "{{.Service}}",
 	}
-    callObserverStart(ctx, ck)
-	if err := g.s.RateLimiter.Accept(ctx, ck); err != nil {
+	ctx = startCallSpan(ctx, ck)
+	g.s.callObserverStart(ctx, ck)
+	setSpanFilter(ctx, fl)
+	if err := g.s.acceptRateLimit(ctx, ck); err != nil {
+		g.s.callObserverEnd(ctx, ck, err)
+		endCallSpan(ctx, err)
 		return nil, err
 	}
 
@@ -1025,8 +1584,16 @@ func (g *{{.GCEWrapType}}) ListUsable(ctx context.Context, fl *filter.F) ([]*{{.
 		all = append(all, l.Items...)
 		return nil
 	}
-	if err := call.Pages(ctx, f); err != nil {
-		callObserverEnd(ctx, ck, err)
+	all, err := intercept(ctx, g.s, &Call{Key: ck, Header: call.Header()}, func(ctx context.Context) ([]*{{.FQListUsableObjectType}}, error) {
+		// The invoker may be called more than once, e.g. by a retrying
+		// interceptor.
+		all = nil
+		err := call.Pages(ctx, f)
+		return all, err
+	})
+	if err != nil {
+		g.s.callObserverEnd(ctx, ck, err)
+		endCallSpan(ctx, err)
 		g.s.RateLimiter.Observe(ctx, err, ck)
 
 		klog.V(4).Infof("{{.GCEWrapType}}.ListUsable(%v, ..., %v) = %v, %v", ctx, fl, nil, err)
@@ -1045,23 +1612,80 @@ func (g *{{.GCEWrapType}}) ListUsable(ctx context.Context, fl *filter.F) ([]*{{.
 
 	return all, nil
 }
+
+// ListUsablePages calls f for each page of Usable {{.Object}} objects. See
+// ListUsableIterator().
+func (g *{{.GCEWrapType}}) ListUsablePages(ctx context.Context, fl *filter.F, opts *ListOptions, f func([]*{{.FQListUsableObjectType}}) error) error {
+	return listPages(g.ListUsableIterator(ctx, fl, opts), f)
+}
+
+// ListUsableIterator returns an iterator over the pages of Usable
+// {{.Object}} objects. Each page is fetched with a separate (rate limited)
+// call.
+func (g *{{.GCEWrapType}}) ListUsableIterator(ctx context.Context, fl *filter.F, opts *ListOptions) *PageIterator[[]*{{.FQListUsableObjectType}}] {
+	projectID := g.s.ProjectRouter.ProjectID(ctx, "{{.Version}}", "{{.Service}}")
+	ck := &CallContextKey{
+		ProjectID: projectID,
+		Operation: "ListUsable",
+		Version:   meta.Version("{{.Version}}"),
+		Service:   "{{.Service}}",
+	}
+	call := g.s.{{.VersionTitle}}.{{.Service}}.ListUsable(projectID)
+	if fl != filter.None {
+		call.Filter(fl.String())
+	}
+	if n := opts.maxResults(); n > 0 {
+		call.MaxResults(n)
+	}
+	return newPageIterator(ctx, func(ctx context.Context, pageToken string) ([]*{{.FQListUsableObjectType}}, string, error) {
+		klog.V(5).Infof("{{.GCEWrapType}}.ListUsableIterator(%v, %v): page %q, projectID = %v, ck = %+v", ctx, fl, pageToken, projectID, ck)
+		ctx = startCallSpan(ctx, ck)
+		g.s.callObserverStart(ctx, ck)
+		setSpanFilter(ctx, fl)
+		if err := g.s.acceptRateLimit(ctx, ck); err != nil {
+			g.s.callObserverEnd(ctx, ck, err)
+			endCallSpan(ctx, err)
+			return nil, "", err
+		}
+		call.PageToken(pageToken)
+		l, err := intercept(ctx, g.s, &Call{Key: ck, Header: call.Header()}, func(ctx context.Context) (*{{.ObjectListUsableType}}, error) {
+			reqCtx, reqSpan := startSpan(ctx, SpanRequest)
+			call.Context(reqCtx)
+			l, err := call.Do()
+			endSpan(reqSpan, err)
+			return l, err
+		})
+
+		g.s.callObserverEnd(ctx, ck, err)
+		endCallSpan(ctx, err)
+		g.s.RateLimiter.Observe(ctx, err, ck)
+
+		if err != nil {
+			klog.V(4).Infof("{{.GCEWrapType}}.ListUsableIterator(%v, %v): page %q = %v", ctx, fl, pageToken, err)
+			return nil, "", err
+		}
+		klog.V(4).Infof("{{.GCEWrapType}}.ListUsableIterator(%v, %v): page %q = [%v items], next %q", ctx, fl, pageToken, len(l.Items), l.NextPageToken)
+		return l.Items, l.NextPageToken, nil
+	})
+}
 {{- end}}
 
 {{- with .Methods -}}
 {{- range .}}
 // {{.Name}} is a method on {{.GCEWrapType}}.
 func (g *{{.GCEWrapType}}) {{.FcnArgs}} {
+{{- if .IsOperation}}
+	sc := &syncCall{observeWait: true}
+	op, err := g.{{.AsyncImplName}}(ctx, key {{.CallArgs}}, sc)
+	err = sc.wait(op, err)
+	klog.V(4).Infof("{{.GCEWrapType}}.{{.Name}}(%v, %v, ...) = %+v", ctx, key, err)
+	return err
+{{- else}}
 	klog.V(5).Infof("{{.GCEWrapType}}.{{.Name}}(%v, %v, ...): called", ctx, key)
 
 	if !key.Valid() {
 		klog.V(2).Infof("{{.GCEWrapType}}.{{.Name}}(%v, %v, ...): key is invalid (%#v)", ctx, key, key)
-{{- if .IsOperation}}
-		return fmt.Errorf("invalid GCE key (%+v)", key)
-{{- else if .IsGet}}
-		return nil, fmt.Errorf("invalid GCE key (%+v)", key)
-{{- else if .IsPaged}}
 		return nil, fmt.Errorf("invalid GCE key (%+v)", key)
-{{- end}}
 	}
 	projectID := g.s.ProjectRouter.ProjectID(ctx, "{{.Version}}", "{{.Service}}")
 	ck:= &CallContextKey{
@@ -1069,16 +1693,19 @@ func (g *{{.GCEWrapType}}) {{.FcnArgs}} {
 		Operation: "{{.Name}}",
 		Version: meta.Version("{{.Version}}"),
 		Service: "{{.Service}}",
+		Key: *key,
 	}
 	klog.V(5).Infof("{{.GCEWrapType}}.{{.Name}}(%v, %v, ...): projectID = %v, ck = %+v", ctx, key, projectID, ck)
-	callObserverStart(ctx, ck)
-	if err := g.s.RateLimiter.Accept(ctx, ck); err != nil {
+	ctx = startCallSpan(ctx, ck)
+	g.s.callObserverStart(ctx, ck)
+{{- if .IsPaged}}
+	setSpanFilter(ctx, fl)
+{{- end}}
+	if err := g.s.acceptRateLimit(ctx, ck); err != nil {
+		g.s.callObserverEnd(ctx, ck, err)
+		endCallSpan(ctx, err)
 		klog.V(4).Infof("{{.GCEWrapType}}.{{.Name}}(%v, %v, ...): RateLimiter error: %v", ctx, key, err)
-	{{- if .IsOperation}}
-		return err
-	{{- else}}
 		return nil, err
-	{{- end}}
 	}
 
 {{- if .KeyIsGlobal}}
@@ -1090,30 +1717,17 @@ func (g *{{.GCEWrapType}}) {{.FcnArgs}} {
 {{- if .KeyIsZonal}}
 	call := g.s.{{.VersionTitle}}.{{.Service}}.{{.Name}}(projectID, key.Zone, key.Name {{.CallArgs}})
 {{- end}}
-{{- if .IsOperation}}
-	call.Context(ctx)
-	op, err := call.Do()
-
-	if err != nil {
-		callObserverEnd(ctx, ck, err)
-		g.s.RateLimiter.Observe(ctx, err, ck)
-
-		klog.V(4).Infof("{{.GCEWrapType}}.{{.Name}}(%v, %v, ...) = %+v", ctx, key, err)
-		return err
-	}
-
-	err = g.s.WaitForCompletion(ctx, op)
-
-    callObserverEnd(ctx, ck, err)
-	g.s.RateLimiter.Observe(ctx, err, ck) // XXX
-
-	klog.V(4).Infof("{{.GCEWrapType}}.{{.Name}}(%v, %v, ...) = %+v", ctx, key, err)
-	return err
-{{- else if .IsGet}}
-	call.Context(ctx)
-	v, err := call.Do()
-
-    callObserverEnd(ctx, ck, err)
+{{- if .IsGet}}
+	v, err := intercept(ctx, g.s, &Call{Key: ck, {{with .RequestArg}}Request: {{.}}, {{end}}Header: call.Header()}, func(ctx context.Context) (*{{.Version}}.{{.ReturnType}}, error) {
+		reqCtx, reqSpan := startSpan(ctx, SpanRequest)
+		call.Context(reqCtx)
+		v, err := call.Do()
+		endSpan(reqSpan, err)
+		return v, err
+	})
+
+	g.s.callObserverEnd(ctx, ck, err)
+	endCallSpan(ctx, err)
 	g.s.RateLimiter.Observe(ctx, err, ck)
 
 	klog.V(4).Infof("{{.GCEWrapType}}.{{.Name}}(%v, %v, ...) = %+v, %v", ctx, key, v, err)
@@ -1125,15 +1739,24 @@ func (g *{{.GCEWrapType}}) {{.FcnArgs}} {
 		all = append(all, l.Items...)
 		return nil
 	}
-	if err := call.Pages(ctx, f); err != nil {
-		callObserverEnd(ctx, ck, err)
+	all, err := intercept(ctx, g.s, &Call{Key: ck, {{with .RequestArg}}Request: {{.}}, {{end}}Header: call.Header()}, func(ctx context.Context) ([]*{{.Version}}.{{.ItemType}}, error) {
+		// The invoker may be called more than once, e.g. by a retrying
+		// interceptor.
+		all = nil
+		err := call.Pages(ctx, f)
+		return all, err
+	})
+	if err != nil {
+		g.s.callObserverEnd(ctx, ck, err)
+		endCallSpan(ctx, err)
 		g.s.RateLimiter.Observe(ctx, err, ck)
 
 		klog.V(4).Infof("{{.GCEWrapType}}.{{.Name}}(%v, %v, ...) = %v, %v", ctx, key, nil, err)
 		return nil, err
 	}
 
-    callObserverEnd(ctx, ck, nil)
+	g.s.callObserverEnd(ctx, ck, nil)
+	endCallSpan(ctx, nil)
 	g.s.RateLimiter.Observe(ctx, nil, ck)
 
 	if kLogEnabled(4) {
@@ -1147,7 +1770,140 @@ func (g *{{.GCEWrapType}}) {{.FcnArgs}} {
 	}
 	return all, nil
 {{- end}}
+{{- end}}
+}
+{{- if .IsPaged}}
+
+// {{.Name}}Pages calls f for each page of objects returned by {{.Name}}.
+// See {{.Name}}Iterator().
+func (g *{{.GCEWrapType}}) {{.PagesFcnArgs}} {
+	return listPages(g.{{.Name}}Iterator(ctx, key {{.CallArgs}}, fl, opts), f)
+}
+
+// {{.Name}}Iterator returns an iterator over the pages of objects returned
+// by {{.Name}}. Each page is fetched with a separate (rate limited) call.
+func (g *{{.GCEWrapType}}) {{.IteratorFcnArgs}} {
+	projectID := g.s.ProjectRouter.ProjectID(ctx, "{{.Version}}", "{{.Service}}")
+	ck := &CallContextKey{
+		ProjectID: projectID,
+		Operation: "{{.Name}}",
+		Version:   meta.Version("{{.Version}}"),
+		Service:   "{{.Service}}",
+		Key: *key,
+	}
+	if !key.Valid() {
+		return newPageIterator(ctx, func(context.Context, string) ({{.PageType}}, string, error) {
+			return nil, "", fmt.Errorf("invalid GCE key (%+v)", key)
+		})
+	}
+{{- if .KeyIsGlobal}}
+	call := g.s.{{.VersionTitle}}.{{.Service}}.{{.Name}}(projectID, key.Name {{.CallArgs}})
+{{- end -}}
+{{- if .KeyIsRegional}}
+	call := g.s.{{.VersionTitle}}.{{.Service}}.{{.Name}}(projectID, key.Region, key.Name {{.CallArgs}})
+{{- end -}}
+{{- if .KeyIsZonal}}
+	call := g.s.{{.VersionTitle}}.{{.Service}}.{{.Name}}(projectID, key.Zone, key.Name {{.CallArgs}})
+{{- end}}
+	if fl != filter.None {
+		call.Filter(fl.String())
+	}
+	if n := opts.maxResults(); n > 0 {
+		call.MaxResults(n)
+	}
+	return newPageIterator(ctx, func(ctx context.Context, pageToken string) ({{.PageType}}, string, error) {
+		klog.V(5).Infof("{{.GCEWrapType}}.{{.Name}}Iterator(%v, %v, ...): page %q, projectID = %v, ck = %+v", ctx, key, pageToken, projectID, ck)
+		ctx = startCallSpan(ctx, ck)
+		g.s.callObserverStart(ctx, ck)
+		setSpanFilter(ctx, fl)
+		if err := g.s.acceptRateLimit(ctx, ck); err != nil {
+			g.s.callObserverEnd(ctx, ck, err)
+			endCallSpan(ctx, err)
+			return nil, "", err
+		}
+		call.PageToken(pageToken)
+		l, err := intercept(ctx, g.s, &Call{Key: ck, {{with .RequestArg}}Request: {{.}}, {{end}}Header: call.Header()}, func(ctx context.Context) (*{{.Version}}.{{.ReturnType}}, error) {
+			reqCtx, reqSpan := startSpan(ctx, SpanRequest)
+			call.Context(reqCtx)
+			l, err := call.Do()
+			endSpan(reqSpan, err)
+			return l, err
+		})
+
+		g.s.callObserverEnd(ctx, ck, err)
+		endCallSpan(ctx, err)
+		g.s.RateLimiter.Observe(ctx, err, ck)
+
+		if err != nil {
+			klog.V(4).Infof("{{.GCEWrapType}}.{{.Name}}Iterator(%v, %v, ...): page %q = %v", ctx, key, pageToken, err)
+			return nil, "", err
+		}
+		klog.V(4).Infof("{{.GCEWrapType}}.{{.Name}}Iterator(%v, %v, ...): page %q = [%v items], next %q", ctx, key, pageToken, len(l.Items), l.NextPageToken)
+		return l.Items, l.NextPageToken, nil
+	})
+}
+{{- end}}
+{{- if .IsOperation}}
+
+// {{.Name}}Async starts {{.Name}}. The returned Operation completes when
+// the operation has finished.
+func (g *{{.GCEWrapType}}) {{.AsyncFcnArgs}} {
+	return g.{{.AsyncImplName}}(ctx, key {{.CallArgs}}, nil)
 }
+
+// {{.AsyncImplName}} implements {{.Name}}Async. The end of the call is
+// deferred to sc, if set.
+func (g *{{.GCEWrapType}}) {{.AsyncImplFcnArgs}} {
+	klog.V(5).Infof("{{.GCEWrapType}}.{{.Name}}Async(%v, %v, ...): called", ctx, key)
+
+	if !key.Valid() {
+		klog.V(2).Infof("{{.GCEWrapType}}.{{.Name}}Async(%v, %v, ...): key is invalid (%#v)", ctx, key, key)
+		return nil, fmt.Errorf("invalid GCE key (%+v)", key)
+	}
+	projectID := g.s.ProjectRouter.ProjectID(ctx, "{{.Version}}", "{{.Service}}")
+	ck := &CallContextKey{
+		ProjectID: projectID,
+		Operation: "{{.Name}}",
+		Version:   meta.Version("{{.Version}}"),
+		Service:   "{{.Service}}",
+		Key: *key,
+		Mutation: true,
+	}
+	klog.V(5).Infof("{{.GCEWrapType}}.{{.Name}}Async(%v, %v, ...): projectID = %v, ck = %+v", ctx, key, projectID, ck)
+	ctx = startCallSpan(ctx, ck)
+	g.s.callObserverStart(ctx, ck)
+	if err := g.s.acceptRateLimit(ctx, ck); err != nil {
+		g.s.callObserverEnd(ctx, ck, err)
+		endCallSpan(ctx, err)
+		klog.V(4).Infof("{{.GCEWrapType}}.{{.Name}}Async(%v, %v, ...): RateLimiter error: %v", ctx, key, err)
+		return nil, err
+	}
+{{- if .KeyIsGlobal}}
+	call := g.s.{{.VersionTitle}}.{{.Service}}.{{.Name}}(projectID, key.Name {{.CallArgs}})
+{{- end -}}
+{{- if .KeyIsRegional}}
+	call := g.s.{{.VersionTitle}}.{{.Service}}.{{.Name}}(projectID, key.Region, key.Name {{.CallArgs}})
+{{- end -}}
+{{- if .KeyIsZonal}}
+	call := g.s.{{.VersionTitle}}.{{.Service}}.{{.Name}}(projectID, key.Zone, key.Name {{.CallArgs}})
+{{- end}}
+	op, err := intercept(ctx, g.s, &Call{Key: ck, {{with .RequestArg}}Request: {{.}}, {{end}}Header: call.Header()}, func(ctx context.Context) (*{{.Version}}.Operation, error) {
+		reqCtx, reqSpan := startSpan(ctx, SpanRequest)
+		call.Context(reqCtx)
+		op, err := call.Do()
+		endSpan(reqSpan, err)
+		return op, err
+	})
+
+	g.s.endCall(ctx, ck, sc, err)
+
+	if err != nil {
+		klog.V(4).Infof("{{.GCEWrapType}}.{{.Name}}Async(%v, %v, ...) = %+v", ctx, key, err)
+		return nil, err
+	}
+	return g.s.newOperation(ctx, ck, op, &ResourceID{projectID, "{{.Resource}}", key})
+}
+{{- end}}
 {{end -}}
 {{- end}}
 `
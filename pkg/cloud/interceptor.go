@@ -0,0 +1,100 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Call is a call to the API, as seen by the Interceptors.
+type Call struct {
+	// Key of the call. Key.Key is the key of the resource, if any.
+	Key *CallContextKey
+	// Request is the object sent with the call, e.g. the *ga.Address for
+	// Addresses.Insert() or the request argument of the additional methods.
+	// It is nil if the call does not send an object. Interceptors can
+	// modify the object, e.g. to add labels; replacing it has no effect.
+	Request interface{}
+	// Header is the header of the HTTP request of the call, e.g. to set
+	// "X-Goog-User-Project". Interceptors can modify it; replacing it has
+	// no effect.
+	Header http.Header
+}
+
+// Invoker makes the call and returns its result.
+//
+// The result is the value returned by the API for the call:
+//
+//   - the object (e.g. *ga.Address) for Get;
+//   - all of the items (e.g. []*ga.Address or map[string][]*ga.Address)
+//     for List, AggregatedList and the paged additional methods;
+//   - the page (e.g. *ga.AddressList) for each page of an iterator;
+//   - the operation (e.g. *ga.Operation) for the calls that start an
+//     operation, such as Insert and Delete;
+//   - the response for the other additional methods.
+type Invoker func(ctx context.Context, call *Call) (interface{}, error)
+
+// Interceptor intercepts the calls made with a Service. It can inspect and
+// modify the call, call next to make it and inspect its result, or return a
+// result (of the type returned by next) or an error without calling next.
+// The call fails if an Interceptor returns a nil result without an error.
+// next may be called more than once, e.g. to retry the call.
+//
+// The calls are intercepted after they have been accepted by the
+// RateLimiter. The calls that poll operations are not intercepted.
+//
+//	func userProject(ctx context.Context, call *cloud.Call, next cloud.Invoker) (interface{}, error) {
+//		call.Header.Set("X-Goog-User-Project", "my-project")
+//		return next(ctx, call)
+//	}
+//
+//	svc.Interceptors = append(svc.Interceptors, userProject)
+type Interceptor func(ctx context.Context, call *Call, next Invoker) (interface{}, error)
+
+// intercept makes the call with invoke through the Interceptors of s. The
+// first Interceptor is the outermost.
+func intercept[T any](ctx context.Context, s *Service, call *Call, invoke func(context.Context) (T, error)) (T, error) {
+	if len(s.Interceptors) == 0 {
+		return invoke(ctx)
+	}
+
+	next := func(ctx context.Context, _ *Call) (interface{}, error) {
+		return invoke(ctx)
+	}
+	for i := len(s.Interceptors) - 1; i >= 0; i-- {
+		ic, inner := s.Interceptors[i], next
+		next = func(ctx context.Context, call *Call) (interface{}, error) {
+			return ic(ctx, call, inner)
+		}
+	}
+
+	var zero T
+	res, err := next(ctx, call)
+	if res == nil {
+		if err == nil {
+			err = fmt.Errorf("interceptor returned nil for %s.%s without an error", call.Key.Service, call.Key.Operation)
+		}
+		return zero, err
+	}
+	v, ok := res.(T)
+	if !ok {
+		return zero, fmt.Errorf("interceptor returned %T for %s.%s, want %T", res, call.Key.Service, call.Key.Operation, zero)
+	}
+	return v, err
+}
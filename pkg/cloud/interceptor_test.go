@@ -0,0 +1,131 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestIntercept(t *testing.T) {
+	t.Parallel()
+
+	errInjected := errors.New("injected")
+
+	// named returns an Interceptor that records its name in events.
+	named := func(name string, events *[]string) Interceptor {
+		return func(ctx context.Context, call *Call, next Invoker) (interface{}, error) {
+			*events = append(*events, name+" before")
+			res, err := next(ctx, call)
+			*events = append(*events, name+" after")
+			return res, err
+		}
+	}
+
+	for _, tc := range []struct {
+		name         string
+		interceptors func(events *[]string) []Interceptor
+		want         string
+		wantErr      bool
+		wantEvents   []string
+	}{
+		{
+			name:         "no interceptors",
+			interceptors: func(*[]string) []Interceptor { return nil },
+			want:         "invoked",
+			wantEvents:   []string{"invoke"},
+		},
+		{
+			name: "order",
+			interceptors: func(events *[]string) []Interceptor {
+				return []Interceptor{named("a", events), named("b", events)}
+			},
+			want:       "invoked",
+			wantEvents: []string{"a before", "b before", "invoke", "b after", "a after"},
+		},
+		{
+			name: "short circuit",
+			interceptors: func(events *[]string) []Interceptor {
+				return []Interceptor{
+					named("a", events),
+					func(context.Context, *Call, Invoker) (interface{}, error) { return "cached", nil },
+					named("b", events),
+				}
+			},
+			want:       "cached",
+			wantEvents: []string{"a before", "a after"},
+		},
+		{
+			name: "error",
+			interceptors: func(*[]string) []Interceptor {
+				return []Interceptor{func(context.Context, *Call, Invoker) (interface{}, error) { return nil, errInjected }}
+			},
+			wantErr: true,
+		},
+		{
+			name: "nil result",
+			interceptors: func(*[]string) []Interceptor {
+				return []Interceptor{func(context.Context, *Call, Invoker) (interface{}, error) { return nil, nil }}
+			},
+			wantErr: true,
+		},
+		{
+			name: "modify result",
+			interceptors: func(*[]string) []Interceptor {
+				return []Interceptor{func(ctx context.Context, call *Call, next Invoker) (interface{}, error) {
+					res, err := next(ctx, call)
+					return res.(string) + "!", err
+				}}
+			},
+			want:       "invoked!",
+			wantEvents: []string{"invoke"},
+		},
+		{
+			name: "wrong type",
+			interceptors: func(*[]string) []Interceptor {
+				return []Interceptor{func(context.Context, *Call, Invoker) (interface{}, error) { return 1, nil }}
+			},
+			wantErr: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var events []string
+			s := &Service{Interceptors: tc.interceptors(&events)}
+			call := &Call{Key: &CallContextKey{Service: "Addresses", Operation: "Get"}, Header: http.Header{}}
+			got, err := intercept(context.Background(), s, call, func(context.Context) (string, error) {
+				events = append(events, "invoke")
+				return "invoked", nil
+			})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("intercept() = %q, %v; gotErr = %t, want %t", got, err, gotErr, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("intercept() = %q, want %q", got, tc.want)
+			}
+			if diff := cmp.Diff(events, tc.wantEvents); diff != "" {
+				t.Errorf("events; -got,+want: %s", diff)
+			}
+		})
+	}
+}
@@ -134,6 +134,33 @@ func (m *Method) IsGet() bool {
 	return m.kind == MethodGet
 }
 
+// HasMockDefault is true if the mock has a default implementation of the
+// method that is used when no hook is set. These are the Update and Patch
+// methods that take the object as the argument and SetLabels.
+func (m *Method) HasMockDefault() bool {
+	if m.kind != MethodOperation {
+		return false
+	}
+	fType := m.m.Func.Type()
+	if fType.NumIn()-m.argsSkip() != 1 {
+		return false
+	}
+	a := newArg(fType.In(m.argsSkip()))
+	switch m.Name() {
+	case "Update", "Patch":
+		return a.typeName == m.Object
+	case "SetLabels":
+		return strings.HasSuffix(a.typeName, "SetLabelsRequest")
+	}
+	return false
+}
+
+// MockDefaultArgType is the type of the argument of a method for which
+// HasMockDefault() is true, e.g. "*ga.BackendService".
+func (m *Method) MockDefaultArgType() string {
+	return newArg(m.m.Func.Type().In(m.argsSkip())).String()
+}
+
 // argsSkip is the number of arguments to skip when generating the
 // synthesized method.
 func (m *Method) argsSkip() int {
@@ -262,6 +289,19 @@ func (m *Method) CallArgs() string {
 	return fmt.Sprintf(", %s", strings.Join(args, ", "))
 }
 
+// RequestArg is the argument of the method that is the object sent with the
+// call, e.g. "arg0". This is the first argument that is a pointer; empty if
+// there are none.
+func (m *Method) RequestArg() string {
+	fType := m.m.Func.Type()
+	for i := m.argsSkip(); i < fType.NumIn(); i++ {
+		if fType.In(i).Kind() == reflect.Ptr {
+			return fmt.Sprintf("arg%d", i-m.argsSkip())
+		}
+	}
+	return ""
+}
+
 // MockHookName is the name of the hook function in the mock.
 func (m *Method) MockHookName() string {
 	return m.m.Name + "Hook"
@@ -335,3 +375,91 @@ func (m *Method) InterfaceFunc() string {
 		panic(fmt.Errorf("invalid method kind: %v", m.kind))
 	}
 }
+
+// PageType is the type of a page returned by the ListPages and Iterator
+// variants of a paged method, e.g. "[]*ga.NetworkEndpointWithHealthStatus".
+func (m *Method) PageType() string {
+	return fmt.Sprintf("[]*%v.%v", m.Version(), m.ItemType)
+}
+
+// PagesFcnArgs is the function signature for the definition of the
+// <Name>Pages() variant of a paged method.
+func (m *Method) PagesFcnArgs() string {
+	args := m.args(m.argsSkip(), true, []string{
+		"ctx context.Context",
+		"key *meta.Key",
+	})
+	args = append(args, "fl *filter.F", "opts *ListOptions", fmt.Sprintf("f func(%v) error", m.PageType()))
+	return fmt.Sprintf("%vPages(%v) error", m.m.Name, strings.Join(args, ", "))
+}
+
+// IteratorFcnArgs is the function signature for the definition of the
+// <Name>Iterator() variant of a paged method.
+func (m *Method) IteratorFcnArgs() string {
+	args := m.args(m.argsSkip(), true, []string{
+		"ctx context.Context",
+		"key *meta.Key",
+	})
+	args = append(args, "fl *filter.F", "opts *ListOptions")
+	return fmt.Sprintf("%vIterator(%v) *PageIterator[%v]", m.m.Name, strings.Join(args, ", "), m.PageType())
+}
+
+// PagesInterfaceFunc is the declaration of the <Name>Pages() variant of a
+// paged method in the interface.
+func (m *Method) PagesInterfaceFunc() string {
+	args := m.args(m.argsSkip(), false, []string{
+		"context.Context",
+		"*meta.Key",
+	})
+	args = append(args, "*filter.F", "*ListOptions", fmt.Sprintf("func(%v) error", m.PageType()))
+	return fmt.Sprintf("%vPages(%v) error", m.m.Name, strings.Join(args, ", "))
+}
+
+// IteratorInterfaceFunc is the declaration of the <Name>Iterator() variant
+// of a paged method in the interface.
+func (m *Method) IteratorInterfaceFunc() string {
+	args := m.args(m.argsSkip(), false, []string{
+		"context.Context",
+		"*meta.Key",
+	})
+	args = append(args, "*filter.F", "*ListOptions")
+	return fmt.Sprintf("%vIterator(%v) *PageIterator[%v]", m.m.Name, strings.Join(args, ", "), m.PageType())
+}
+
+// AsyncFcnArgs is the function signature for the definition of the
+// <Name>Async() variant of an operation method.
+func (m *Method) AsyncFcnArgs() string {
+	args := m.args(m.argsSkip(), true, []string{
+		"ctx context.Context",
+		"key *meta.Key",
+	})
+	return fmt.Sprintf("%vAsync(%v) (Operation, error)", m.m.Name, strings.Join(args, ", "))
+}
+
+// AsyncImplName is the name of the unexported implementation of the
+// <Name>Async() variant of an operation method, e.g. "setLabelsAsync".
+func (m *Method) AsyncImplName() string {
+	return strings.ToLower(m.m.Name[:1]) + m.m.Name[1:] + "Async"
+}
+
+// AsyncImplFcnArgs is the function signature for the definition of the
+// unexported implementation of the <Name>Async() variant. The implementation
+// takes an additional *syncCall that is used by the synchronous variant.
+func (m *Method) AsyncImplFcnArgs() string {
+	args := m.args(m.argsSkip(), true, []string{
+		"ctx context.Context",
+		"key *meta.Key",
+	})
+	args = append(args, "sc *syncCall")
+	return fmt.Sprintf("%v(%v) (Operation, error)", m.AsyncImplName(), strings.Join(args, ", "))
+}
+
+// AsyncInterfaceFunc is the declaration of the <Name>Async() variant of an
+// operation method in the interface.
+func (m *Method) AsyncInterfaceFunc() string {
+	args := m.args(m.argsSkip(), false, []string{
+		"context.Context",
+		"*meta.Key",
+	})
+	return fmt.Sprintf("%vAsync(%v) (Operation, error)", m.m.Name, strings.Join(args, ", "))
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics records OpenCensus metrics for the calls made with the
+// cloud package: the number and latency of the API requests by HTTP status
+// code, the time waiting for the rate limiter and the time waiting for
+// long-running operations.
+//
+//	view.Register(metrics.Views...)
+//
+//	svc.CallObservers = append(svc.CallObservers, metrics.NewObserver())
+//	gce.Addresses().Insert(ctx, ...)
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"google.golang.org/api/googleapi"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+)
+
+const prefix = "k8s-cloud-provider/"
+
+// Tags of the metrics.
+var (
+	// KeyService is the service of the call, e.g. "BackendServices".
+	KeyService = tag.MustNewKey("service")
+	// KeyOperation is the method of the call, e.g. "Get" or "Insert".
+	KeyOperation = tag.MustNewKey("operation")
+	// KeyVersion is the API version of the call, e.g. "ga".
+	KeyVersion = tag.MustNewKey("version")
+	// KeyCode is the result of the call: "OK", the HTTP status code of the
+	// error (e.g. "404"), "canceled", "deadline_exceeded" or "error".
+	KeyCode = tag.MustNewKey("code")
+)
+
+// Measures recorded by the Observer.
+var (
+	// RequestLatency is the latency of the API requests, excluding the
+	// time waiting for the rate limiter. As for CallObserver.End(), this
+	// includes the time waiting for the operation for the methods such as
+	// SetLabels.
+	RequestLatency = stats.Float64(prefix+"request_latency", "Latency of the API requests", stats.UnitMilliseconds)
+	// RateLimitWait is the time waiting in RateLimiter.Accept().
+	RateLimitWait = stats.Float64(prefix+"rate_limit_wait", "Time waiting for the rate limiter", stats.UnitMilliseconds)
+	// OperationWait is the time waiting for long-running operations in
+	// Operation.Wait().
+	OperationWait = stats.Float64(prefix+"operation_wait", "Time waiting for long-running operations", stats.UnitMilliseconds)
+)
+
+// latencyDistribution has buckets from 1ms to ~15m.
+var latencyDistribution = view.Distribution(1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000, 20000, 50000, 100000, 200000, 500000, 1000000)
+
+// Views of the metrics. Register these with view.Register(Views...).
+var (
+	RequestCountView = &view.View{
+		Name:        prefix + "request_count",
+		Description: "Number of API requests",
+		Measure:     RequestLatency,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{KeyService, KeyOperation, KeyVersion, KeyCode},
+	}
+	RequestLatencyView = &view.View{
+		Name:        prefix + "request_latency",
+		Description: "Latency of the API requests",
+		Measure:     RequestLatency,
+		Aggregation: latencyDistribution,
+		TagKeys:     []tag.Key{KeyService, KeyOperation, KeyVersion, KeyCode},
+	}
+	RateLimitWaitView = &view.View{
+		Name:        prefix + "rate_limit_wait",
+		Description: "Time waiting for the rate limiter",
+		Measure:     RateLimitWait,
+		Aggregation: latencyDistribution,
+		TagKeys:     []tag.Key{KeyService, KeyOperation, KeyVersion},
+	}
+	OperationWaitView = &view.View{
+		Name:        prefix + "operation_wait",
+		Description: "Time waiting for long-running operations",
+		Measure:     OperationWait,
+		Aggregation: latencyDistribution,
+		TagKeys:     []tag.Key{KeyService, KeyOperation, KeyVersion, KeyCode},
+	}
+
+	Views = []*view.View{RequestCountView, RequestLatencyView, RateLimitWaitView, OperationWaitView}
+)
+
+// NewObserver returns a new Observer.
+func NewObserver() *Observer {
+	return &Observer{
+		now:   time.Now,
+		calls: map[*cloud.CallContextKey]*call{},
+	}
+}
+
+// Observer is a cloud.CallObserver, cloud.OperationObserver and
+// cloud.RateLimitObserver that records the metrics for the calls. The time
+// waiting for the rate limiter is excluded from the request latency.
+//
+// This object is thread-safe.
+type Observer struct {
+	now func() time.Time
+
+	lock sync.Mutex
+	// calls that have started, by key. The generated code uses the same key
+	// for the Start(), RateLimitEnd() and End() of a call.
+	calls map[*cloud.CallContextKey]*call
+}
+
+type call struct {
+	start time.Time
+	// accepted is the time the rate limiter accepted the call. It is zero
+	// until RateLimitEnd().
+	accepted time.Time
+}
+
+// Start implements cloud.CallObserver.
+func (o *Observer) Start(ctx context.Context, key *cloud.CallContextKey) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.calls[key] = &call{start: o.now()}
+}
+
+// End implements cloud.CallObserver.
+func (o *Observer) End(ctx context.Context, key *cloud.CallContextKey, err error) {
+	now := o.now()
+
+	o.lock.Lock()
+	c, ok := o.calls[key]
+	delete(o.calls, key)
+	o.lock.Unlock()
+	if !ok {
+		return
+	}
+	start := c.start
+	if !c.accepted.IsZero() {
+		start = c.accepted
+	}
+	record(ctx, key, err, RequestLatency.M(milliseconds(now.Sub(start))))
+}
+
+// OperationEnd implements cloud.OperationObserver.
+func (o *Observer) OperationEnd(ctx context.Context, key *cloud.CallContextKey, wait time.Duration, err error) {
+	record(ctx, key, err, OperationWait.M(milliseconds(wait)))
+}
+
+// RateLimitEnd implements cloud.RateLimitObserver.
+func (o *Observer) RateLimitEnd(ctx context.Context, key *cloud.RateLimitKey, wait time.Duration, err error) {
+	now := o.now()
+
+	o.lock.Lock()
+	if c, ok := o.calls[key]; ok {
+		if err != nil {
+			// No request is made.
+			delete(o.calls, key)
+		} else {
+			c.accepted = now
+		}
+	}
+	o.lock.Unlock()
+
+	record(ctx, key, nil, RateLimitWait.M(milliseconds(wait)))
+}
+
+func record(ctx context.Context, key *cloud.CallContextKey, err error, m stats.Measurement) {
+	if key == nil {
+		key = &cloud.CallContextKey{}
+	}
+	mutators := []tag.Mutator{
+		tag.Upsert(KeyService, key.Service),
+		tag.Upsert(KeyOperation, key.Operation),
+		tag.Upsert(KeyVersion, string(key.Version)),
+	}
+	if m.Measure() != RateLimitWait {
+		mutators = append(mutators, tag.Upsert(KeyCode, code(err)))
+	}
+	// Recording fails only if the tag values are invalid, e.g. not ASCII.
+	stats.RecordWithTags(ctx, mutators, m)
+}
+
+// code returns the value of KeyCode for err.
+func code(err error) string {
+	var gerr *googleapi.Error
+	switch {
+	case err == nil:
+		return "OK"
+	case errors.As(err, &gerr):
+		return strconv.Itoa(gerr.Code)
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "deadline_exceeded"
+	}
+	return "error"
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
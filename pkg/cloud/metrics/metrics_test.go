@@ -0,0 +1,219 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	ga "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/fakeserver"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+)
+
+// registerViews registers Views for the duration of the test. Unregistering
+// the views drops the data, so each test starts from scratch.
+func registerViews(t *testing.T) {
+	t.Helper()
+	if err := view.Register(Views...); err != nil {
+		t.Fatalf("view.Register() = %v, want nil", err)
+	}
+	t.Cleanup(func() { view.Unregister(Views...) })
+}
+
+// rows returns the data for the view v by the values of the operation,
+// service, version and code tags, joined with "/".
+func rows(t *testing.T, v *view.View) map[string]view.AggregationData {
+	t.Helper()
+	data, err := view.RetrieveData(v.Name)
+	if err != nil {
+		t.Fatalf("view.RetrieveData(%q) = %v, want nil", v.Name, err)
+	}
+	ret := map[string]view.AggregationData{}
+	for _, row := range data {
+		tags := map[tag.Key]string{}
+		for _, t := range row.Tags {
+			tags[t.Key] = t.Value
+		}
+		var values []string
+		for _, k := range []tag.Key{KeyOperation, KeyService, KeyVersion, KeyCode} {
+			if v, ok := tags[k]; ok {
+				values = append(values, v)
+			}
+		}
+		ret[strings.Join(values, "/")] = row.Data
+	}
+	return ret
+}
+
+// counts returns the number of values in each row of the view v.
+func counts(t *testing.T, v *view.View) map[string]int64 {
+	t.Helper()
+	ret := map[string]int64{}
+	for k, d := range rows(t, v) {
+		switch d := d.(type) {
+		case *view.CountData:
+			ret[k] = d.Value
+		case *view.DistributionData:
+			ret[k] = d.Count
+		default:
+			t.Fatalf("row %q: unexpected data %T", k, d)
+		}
+	}
+	return ret
+}
+
+// means returns the mean of the values in each row of the distribution v.
+func means(t *testing.T, v *view.View) map[string]float64 {
+	t.Helper()
+	ret := map[string]float64{}
+	for k, d := range rows(t, v) {
+		ret[k] = d.(*view.DistributionData).Mean
+	}
+	return ret
+}
+
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func TestObserver(t *testing.T) {
+	registerViews(t)
+
+	fc := &fakeClock{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	obs := NewObserver()
+	obs.now = fc.Now
+	ctx := context.Background()
+	var rlErr error
+
+	// call simulates a call made by the generated code, with a 5s wait for
+	// the rate limiter.
+	call := func(op string, latency time.Duration, err error) {
+		key := &cloud.CallContextKey{ProjectID: "proj", Operation: op, Version: meta.VersionGA, Service: "Addresses"}
+		obs.Start(ctx, key)
+		fc.now = fc.now.Add(5 * time.Second)
+		obs.RateLimitEnd(ctx, key, 5*time.Second, rlErr)
+		if rlErr != nil {
+			obs.End(ctx, key, rlErr)
+			return
+		}
+		fc.now = fc.now.Add(latency)
+		obs.End(ctx, key, err)
+		if op == "Insert" && err == nil {
+			obs.OperationEnd(ctx, key, time.Minute, nil)
+		}
+	}
+
+	call("Get", time.Second, nil)
+	call("Get", 3*time.Second, nil)
+	call("Get", time.Second, &googleapi.Error{Code: http.StatusNotFound})
+	call("Insert", 2*time.Second, nil)
+	rlErr = context.Canceled
+	call("Get", time.Second, nil)
+
+	wantCounts := map[string]int64{
+		"Get/Addresses/ga/OK":    2,
+		"Get/Addresses/ga/404":   1,
+		"Insert/Addresses/ga/OK": 1,
+	}
+	if diff := cmp.Diff(counts(t, RequestCountView), wantCounts); diff != "" {
+		t.Errorf("request counts; -got,+want: %s", diff)
+	}
+	// The request latency does not include the time waiting for the rate
+	// limiter.
+	wantMeans := map[string]float64{
+		"Get/Addresses/ga/OK":    2000,
+		"Get/Addresses/ga/404":   1000,
+		"Insert/Addresses/ga/OK": 2000,
+	}
+	if diff := cmp.Diff(means(t, RequestLatencyView), wantMeans); diff != "" {
+		t.Errorf("request latency; -got,+want: %s", diff)
+	}
+	wantMeans = map[string]float64{
+		"Get/Addresses/ga":    5000,
+		"Insert/Addresses/ga": 5000,
+	}
+	if diff := cmp.Diff(means(t, RateLimitWaitView), wantMeans); diff != "" {
+		t.Errorf("rate limit wait; -got,+want: %s", diff)
+	}
+	wantMeans = map[string]float64{
+		"Insert/Addresses/ga/OK": 60000,
+	}
+	if diff := cmp.Diff(means(t, OperationWaitView), wantMeans); diff != "" {
+		t.Errorf("operation wait; -got,+want: %s", diff)
+	}
+	if len(obs.calls) != 0 {
+		t.Errorf("len(obs.calls) = %d, want 0", len(obs.calls))
+	}
+}
+
+func TestObserverWithServer(t *testing.T) {
+	registerViews(t)
+
+	pr := &cloud.SingleProjectRouter{ID: "proj"}
+	srv := fakeserver.New(cloud.NewMockGCE(pr))
+	t.Cleanup(srv.Close)
+	svc, err := srv.Service(context.Background(), pr)
+	if err != nil {
+		t.Fatalf("srv.Service() = %v, want nil", err)
+	}
+	svc.CallObservers = append(svc.CallObservers, NewObserver())
+	gce := cloud.NewGCE(svc)
+	ctx := context.Background()
+
+	key := meta.GlobalKey("net")
+	if err := gce.Networks().Insert(ctx, key, &ga.Network{}); err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+	if _, err := gce.Networks().Get(ctx, key); err != nil {
+		t.Fatalf("Get() = %v, want nil", err)
+	}
+	var gerr *googleapi.Error
+	if _, err := gce.Networks().Get(ctx, meta.GlobalKey("other")); !errors.As(err, &gerr) || gerr.Code != http.StatusNotFound {
+		t.Fatalf("Get() = %v, want HTTP %d", err, http.StatusNotFound)
+	}
+
+	wantCounts := map[string]int64{
+		"Get/Networks/ga/OK":    1,
+		"Get/Networks/ga/404":   1,
+		"Insert/Networks/ga/OK": 1,
+	}
+	if diff := cmp.Diff(counts(t, RequestCountView), wantCounts); diff != "" {
+		t.Errorf("request counts; -got,+want: %s", diff)
+	}
+	wantCounts = map[string]int64{
+		"Insert/Networks/ga/OK": 1,
+	}
+	if diff := cmp.Diff(counts(t, OperationWaitView), wantCounts); diff != "" {
+		t.Errorf("operation waits; -got,+want: %s", diff)
+	}
+	// The operation polls are rate limited too.
+	rlWaits := counts(t, RateLimitWaitView)
+	if rlWaits["Get/Networks/ga"] != 2 || rlWaits["Insert/Networks/ga"] != 1 {
+		t.Errorf("rate limit waits = %v, want 2 Get and 1 Insert calls", rlWaits)
+	}
+}
@@ -31,6 +31,7 @@ import (
 	"sync"
 
 	cloud "github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	cerrors "github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/errors"
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 	alpha "google.golang.org/api/compute/v0.alpha"
@@ -41,11 +42,18 @@ import (
 
 var (
 	// InUseError is a shared variable with error code StatusBadRequest for error verification.
-	InUseError = &googleapi.Error{Code: http.StatusBadRequest, Message: "It's being used by god."}
+	InUseError = &googleapi.Error{
+		Code:    http.StatusBadRequest,
+		Message: "It's being used by god.",
+		Errors:  []googleapi.ErrorItem{{Reason: cerrors.ReasonInUse, Message: "It's being used by god."}},
+	}
 	// InternalServerError is shared variable with error code StatusInternalServerError for error verification.
 	InternalServerError = &googleapi.Error{Code: http.StatusInternalServerError}
 	// UnauthorizedErr wraps a Google API error with code StatusForbidden.
-	UnauthorizedErr = &googleapi.Error{Code: http.StatusForbidden}
+	UnauthorizedErr = &googleapi.Error{
+		Code:   http.StatusForbidden,
+		Errors: []googleapi.ErrorItem{{Reason: cerrors.ReasonForbidden}},
+	}
 )
 
 // gceObject is an abstraction of all GCE API object in go client
@@ -234,7 +242,11 @@ func convertAndInsertAlphaAddress(key *meta.Key, obj gceObject, mAddrs map[meta.
 				errorCode = http.StatusBadRequest
 			}
 
-			return true, &googleapi.Error{Code: errorCode, Message: msg}
+			return true, &googleapi.Error{
+				Code:    errorCode,
+				Message: msg,
+				Errors:  []googleapi.ErrorItem{{Reason: cerrors.ReasonInUse, Message: msg}},
+			}
 		}
 	}
 
@@ -1041,22 +1053,22 @@ func SetSslPolicyBetaTargetHTTPSProxyHook(ctx context.Context, key *meta.Key, re
 
 // InsertFirewallsUnauthorizedErrHook mocks firewall insertion. A forbidden error will be thrown as return.
 func InsertFirewallsUnauthorizedErrHook(ctx context.Context, key *meta.Key, obj *ga.Firewall, m *cloud.MockFirewalls) (bool, error) {
-	return true, &googleapi.Error{Code: http.StatusForbidden}
+	return true, UnauthorizedErr
 }
 
 // UpdateFirewallsUnauthorizedErrHook mocks firewall updating. A forbidden error will be thrown as return.
 func UpdateFirewallsUnauthorizedErrHook(ctx context.Context, key *meta.Key, obj *ga.Firewall, m *cloud.MockFirewalls) error {
-	return &googleapi.Error{Code: http.StatusForbidden}
+	return UnauthorizedErr
 }
 
 // DeleteFirewallsUnauthorizedErrHook mocks firewall deletion. A forbidden error will be thrown as return.
 func DeleteFirewallsUnauthorizedErrHook(ctx context.Context, key *meta.Key, m *cloud.MockFirewalls) (bool, error) {
-	return true, &googleapi.Error{Code: http.StatusForbidden}
+	return true, UnauthorizedErr
 }
 
 // GetFirewallsUnauthorizedErrHook mocks firewall information retrival. A forbidden error will be thrown as return.
 func GetFirewallsUnauthorizedErrHook(ctx context.Context, key *meta.Key, m *cloud.MockFirewalls) (bool, *ga.Firewall, error) {
-	return true, nil, &googleapi.Error{Code: http.StatusForbidden}
+	return true, nil, UnauthorizedErr
 }
 
 // GetTargetPoolInternalErrHook mocks getting target pool. It returns a internal server error.
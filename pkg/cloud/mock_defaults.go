@@ -0,0 +1,257 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+)
+
+const (
+	// mockTimestampFormat is the format used by GCE for timestamps.
+	mockTimestampFormat = "2006-01-02T15:04:05.000-07:00"
+)
+
+var (
+	// mockExternalIPBase is the first external IP assigned by MockDefaults.
+	mockExternalIPBase = net.ParseIP("35.0.0.1").To4()
+	// mockInternalIPBase is the first internal IP assigned by MockDefaults.
+	mockInternalIPBase = net.ParseIP("10.128.0.2").To4()
+)
+
+// MockDefaulter sets server-side defaults and output-only fields for a
+// resource on Insert. obj is a pointer to the API object; it may be any API
+// version of the resource (e.g. *ga.Address or *alpha.Address). Use
+// SetMockDefault() to set fields in a version-independent way.
+type MockDefaulter func(projectID string, key *meta.Key, obj interface{}) error
+
+// NewMockDefaults returns defaults with the built-in defaulters for the common
+// load balancing resources.
+func NewMockDefaults() *MockDefaults {
+	d := &MockDefaults{}
+	d.Resources = map[string]MockDefaulter{
+		"addresses":             d.defaultAddress,
+		"backendServices":       defaultBackendService,
+		"forwardingRules":       d.defaultForwardingRule,
+		"healthChecks":          defaultHealthCheck,
+		"instances":             defaultInstance,
+		"networkEndpointGroups": defaultNetworkEndpointGroup,
+	}
+	return d
+}
+
+// MockDefaults fills in the fields that GCE sets when a resource is created.
+// Use MockGCE.EnableDefaults() to have Insert() in the mocks populate:
+//
+//   - output-only fields common to all resources: Id, CreationTimestamp,
+//     Fingerprint, Kind and the Region/Zone URLs.
+//   - resource specific defaults from Resources (e.g. Address.Status,
+//     Address.NetworkTier and an assigned Address.Address).
+//
+// Fields that are already set by the caller are not modified.
+//
+// This object is thread-safe, except for Resources (see below).
+type MockDefaults struct {
+	// Resources are the per-resource defaulters, indexed by the resource
+	// name (e.g. "addresses"). The defaulter is called for all versions and
+	// scopes (global, regional, zonal) of the resource. Entries may be
+	// added or replaced to customize the defaults, but only before the mock
+	// is used: Resources is read without a lock.
+	Resources map[string]MockDefaulter
+
+	lock       sync.Mutex
+	id         uint64
+	externalIP uint32
+	internalIP uint32
+}
+
+// apply the defaults to obj.
+func (d *MockDefaults) apply(projectID string, version meta.Version, resource string, key *meta.Key, obj interface{}) error {
+	if err := d.applyCommon(projectID, version, key, obj); err != nil {
+		return err
+	}
+	if f, ok := d.Resources[resource]; ok && f != nil {
+		return f(projectID, key, obj)
+	}
+	return nil
+}
+
+// applyCommon sets the fields that are shared by all resources.
+func (d *MockDefaults) applyCommon(projectID string, version meta.Version, key *meta.Key, obj interface{}) error {
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("MockDefaults: obj must be a pointer to a struct, got %T", obj)
+	}
+
+	SetMockDefault(obj, "Id", d.nextID())
+	SetMockDefault(obj, "CreationTimestamp", time.Now().Format(mockTimestampFormat))
+	SetMockDefault(obj, "Fingerprint", d.NewFingerprint())
+	SetMockDefault(obj, "LabelFingerprint", d.NewFingerprint())
+	SetMockDefault(obj, "Kind", "compute#"+lowerFirst(v.Elem().Type().Name()))
+
+	switch key.Type() {
+	case meta.Regional:
+		SetMockDefault(obj, "Region", SelfLink(version, projectID, "regions", meta.GlobalKey(key.Region)))
+	case meta.Zonal:
+		SetMockDefault(obj, "Zone", SelfLink(version, projectID, "zones", meta.GlobalKey(key.Zone)))
+	}
+	return nil
+}
+
+func (d *MockDefaults) nextID() uint64 {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.id++
+	return 1000000000000000000 + d.id
+}
+
+// NewFingerprint returns a new, unique fingerprint.
+func (d *MockDefaults) NewFingerprint() string {
+	return newMockFingerprint()
+}
+
+// AllocateIP returns a unique IPv4 address from either the internal or
+// external range.
+func (d *MockDefaults) AllocateIP(internal bool) string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	base, n := mockExternalIPBase, &d.externalIP
+	if internal {
+		base, n = mockInternalIPBase, &d.internalIP
+	}
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, binary.BigEndian.Uint32(base)+*n)
+	*n++
+	return ip.String()
+}
+
+// SetMockDefault sets the field with the given name in the struct pointed to
+// by obj to value if the field exists, is assignable from value and is
+// currently the zero value. Returns true if the field was set.
+func SetMockDefault(obj interface{}, field string, value interface{}) bool {
+	f, ok := mockFieldValue(obj, field)
+	if !ok || !f.CanSet() || !f.IsZero() {
+		return false
+	}
+	val := reflect.ValueOf(value)
+	switch {
+	case val.Type().AssignableTo(f.Type()):
+		f.Set(val)
+	case mockIsInt(val.Kind()) && mockIsInt(f.Kind()):
+		f.Set(val.Convert(f.Type()))
+	default:
+		return false
+	}
+	return true
+}
+
+// mockIsInt returns true if k is an integer kind.
+func mockIsInt(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// mockStringField returns the value of the string field in the struct
+// pointed to by obj or "" if it does not exist.
+func mockStringField(obj interface{}, field string) string {
+	f, ok := mockFieldValue(obj, field)
+	if !ok || f.Kind() != reflect.String {
+		return ""
+	}
+	return f.String()
+}
+
+// mockFieldValue returns the field in the struct pointed to by obj. Returns
+// false if obj is not a pointer to a struct or the field does not exist.
+func mockFieldValue(obj interface{}, field string) (reflect.Value, bool) {
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	f := v.Elem().FieldByName(field)
+	return f, f.IsValid()
+}
+
+func (d *MockDefaults) defaultAddress(projectID string, key *meta.Key, obj interface{}) error {
+	internal := mockStringField(obj, "AddressType") == "INTERNAL" || mockStringField(obj, "Subnetwork") != ""
+	if internal {
+		SetMockDefault(obj, "AddressType", "INTERNAL")
+	} else {
+		SetMockDefault(obj, "AddressType", "EXTERNAL")
+		SetMockDefault(obj, "NetworkTier", "PREMIUM")
+	}
+	SetMockDefault(obj, "IpVersion", "IPV4")
+	SetMockDefault(obj, "Status", "RESERVED")
+	if mockStringField(obj, "Address") == "" {
+		SetMockDefault(obj, "Address", d.AllocateIP(internal))
+	}
+	return nil
+}
+
+func (d *MockDefaults) defaultForwardingRule(projectID string, key *meta.Key, obj interface{}) error {
+	SetMockDefault(obj, "LoadBalancingScheme", "EXTERNAL")
+	internal := strings.HasPrefix(mockStringField(obj, "LoadBalancingScheme"), "INTERNAL")
+	if !internal {
+		SetMockDefault(obj, "NetworkTier", "PREMIUM")
+	}
+	SetMockDefault(obj, "IPProtocol", "TCP")
+	SetMockDefault(obj, "IpVersion", "IPV4")
+	if mockStringField(obj, "IPAddress") == "" {
+		SetMockDefault(obj, "IPAddress", d.AllocateIP(internal))
+	}
+	return nil
+}
+
+func defaultBackendService(projectID string, key *meta.Key, obj interface{}) error {
+	SetMockDefault(obj, "LoadBalancingScheme", "EXTERNAL")
+	SetMockDefault(obj, "Protocol", "HTTP")
+	SetMockDefault(obj, "PortName", "http")
+	SetMockDefault(obj, "SessionAffinity", "NONE")
+	SetMockDefault(obj, "TimeoutSec", int64(30))
+	return nil
+}
+
+func defaultHealthCheck(projectID string, key *meta.Key, obj interface{}) error {
+	SetMockDefault(obj, "CheckIntervalSec", int64(5))
+	SetMockDefault(obj, "TimeoutSec", int64(5))
+	SetMockDefault(obj, "HealthyThreshold", int64(2))
+	SetMockDefault(obj, "UnhealthyThreshold", int64(2))
+	return nil
+}
+
+func defaultInstance(projectID string, key *meta.Key, obj interface{}) error {
+	SetMockDefault(obj, "Status", "RUNNING")
+	return nil
+}
+
+func defaultNetworkEndpointGroup(projectID string, key *meta.Key, obj interface{}) error {
+	SetMockDefault(obj, "NetworkEndpointType", "GCE_VM_IP_PORT")
+	return nil
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	alpha "google.golang.org/api/compute/v0.alpha"
+	ga "google.golang.org/api/compute/v1"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+)
+
+func TestMockDefaultsAddress(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mock := NewMockGCE(&SingleProjectRouter{"proj"})
+	mock.EnableDefaults(NewMockDefaults())
+
+	key := meta.RegionalKey("addr", "us-central1")
+	if err := mock.Addresses().Insert(ctx, key, &ga.Address{}); err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+	got, err := mock.Addresses().Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get() = %v, want nil", err)
+	}
+
+	if got.Id == 0 {
+		t.Errorf("Id = 0, want non-zero")
+	}
+	if _, err := time.Parse(mockTimestampFormat, got.CreationTimestamp); err != nil {
+		t.Errorf("CreationTimestamp = %q, invalid: %v", got.CreationTimestamp, err)
+	}
+	if want := "https://www.googleapis.com/compute/v1/projects/proj/regions/us-central1"; got.Region != want {
+		t.Errorf("Region = %q, want %q", got.Region, want)
+	}
+	for _, tc := range []struct{ name, got, want string }{
+		{"Kind", got.Kind, "compute#address"},
+		{"Status", got.Status, "RESERVED"},
+		{"NetworkTier", got.NetworkTier, "PREMIUM"},
+		{"AddressType", got.AddressType, "EXTERNAL"},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s = %q, want %q", tc.name, tc.got, tc.want)
+		}
+	}
+	if net.ParseIP(got.Address) == nil {
+		t.Errorf("Address = %q, want an IP", got.Address)
+	}
+
+	// Internal addresses are allocated from a different range and user
+	// specified values are not overwritten.
+	if err := mock.Addresses().Insert(ctx, meta.RegionalKey("internal", "us-central1"), &ga.Address{AddressType: "INTERNAL"}); err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+	if err := mock.Addresses().Insert(ctx, meta.RegionalKey("static", "us-central1"), &ga.Address{Address: "1.2.3.4", NetworkTier: "STANDARD"}); err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+	internal, _ := mock.Addresses().Get(ctx, meta.RegionalKey("internal", "us-central1"))
+	static, _ := mock.Addresses().Get(ctx, meta.RegionalKey("static", "us-central1"))
+	if internal.Address == got.Address || internal.NetworkTier != "" {
+		t.Errorf("internal = %+v, want different Address from %q and no NetworkTier", internal, got.Address)
+	}
+	if static.Address != "1.2.3.4" || static.NetworkTier != "STANDARD" {
+		t.Errorf("static = %+v, want Address = 1.2.3.4, NetworkTier = STANDARD", static)
+	}
+	if static.Id == got.Id {
+		t.Errorf("Id of %+v and %+v are not unique", static, got)
+	}
+}
+
+func TestMockDefaultsVersionsAndScopes(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mock := NewMockGCE(&SingleProjectRouter{"proj"})
+	mock.EnableDefaults(NewMockDefaults())
+
+	bsKey := meta.GlobalKey("bs")
+	if err := mock.AlphaBackendServices().Insert(ctx, bsKey, &alpha.BackendService{}); err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+	bs, err := mock.BackendServices().Get(ctx, bsKey)
+	if err != nil {
+		t.Fatalf("Get() = %v, want nil", err)
+	}
+	if bs.Kind != "compute#backendService" || bs.Protocol != "HTTP" || bs.TimeoutSec != 30 || bs.Fingerprint == "" {
+		t.Errorf("BackendService = %+v, want defaults", bs)
+	}
+	if bs.Region != "" {
+		t.Errorf("Region = %q, want empty for global resource", bs.Region)
+	}
+
+	negKey := meta.ZonalKey("neg", "us-central1-b")
+	if err := mock.NetworkEndpointGroups().Insert(ctx, negKey, &ga.NetworkEndpointGroup{}); err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+	neg, _ := mock.NetworkEndpointGroups().Get(ctx, negKey)
+	if want := "https://www.googleapis.com/compute/v1/projects/proj/zones/us-central1-b"; neg.Zone != want {
+		t.Errorf("Zone = %q, want %q", neg.Zone, want)
+	}
+	if neg.NetworkEndpointType != "GCE_VM_IP_PORT" {
+		t.Errorf("NetworkEndpointType = %q, want GCE_VM_IP_PORT", neg.NetworkEndpointType)
+	}
+}
+
+func TestMockDefaultsCustom(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mock := NewMockGCE(&SingleProjectRouter{"proj"})
+	d := NewMockDefaults()
+	d.Resources["urlMaps"] = func(projectID string, key *meta.Key, obj interface{}) error {
+		SetMockDefault(obj, "Description", "defaulted")
+		return nil
+	}
+	mock.EnableDefaults(d)
+
+	key := meta.GlobalKey("um")
+	if err := mock.UrlMaps().Insert(ctx, key, &ga.UrlMap{}); err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+	got, _ := mock.UrlMaps().Get(ctx, key)
+	if got.Description != "defaulted" || got.Kind != "compute#urlMap" {
+		t.Errorf("UrlMap = %+v, want Description = defaulted, Kind = compute#urlMap", got)
+	}
+}
+
+func TestSetMockDefault(t *testing.T) {
+	t.Parallel()
+
+	obj := &ga.HealthCheck{Name: "hc"}
+	for _, tc := range []struct {
+		field string
+		value interface{}
+		want  bool
+	}{
+		{"Description", "desc", true},
+		{"Name", "other", false},    // Already set.
+		{"NoSuchField", "x", false}, // Does not exist.
+		{"TimeoutSec", 5, true},     // Converted from int to int64.
+		{"Type", 5, false},          // Type mismatch.
+	} {
+		if got := SetMockDefault(obj, tc.field, tc.value); got != tc.want {
+			t.Errorf("SetMockDefault(%q, %v) = %t, want %t", tc.field, tc.value, got, tc.want)
+		}
+	}
+	if obj.Description != "desc" || obj.Name != "hc" || obj.TimeoutSec != 5 {
+		t.Errorf("obj = %+v, want Description = desc, Name = hc, TimeoutSec = 5", obj)
+	}
+}
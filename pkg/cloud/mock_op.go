@@ -0,0 +1,443 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ga "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	"k8s.io/klog/v2"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+)
+
+const (
+	operationStatusPending = "PENDING"
+	operationStatusRunning = "RUNNING"
+)
+
+// MockOperationKey identifies the mutation that created an operation. It is
+// used to inject operation-level errors.
+type MockOperationKey struct {
+	// Service is the name of the service, e.g. "BackendServices".
+	Service string
+	// Method is the name of the method, e.g. "Insert", "Delete" or "Update".
+	Method string
+	// Key of the resource being mutated.
+	Key meta.Key
+}
+
+// MockOperationError is injected as the result of an operation. The operation
+// will finish (Status = DONE) with the error; the mutation will not be applied.
+type MockOperationError struct {
+	// HTTPStatusCode is returned in Operation.HttpErrorStatusCode.
+	HTTPStatusCode int
+	// Code is the error code, e.g. "RESOURCE_IN_USE_BY_ANOTHER_RESOURCE".
+	Code string
+	// Message is the human readable error.
+	Message string
+}
+
+// NewMockOperations returns a new operation model with no latency.
+func NewMockOperations() *MockOperations {
+	return &MockOperations{
+		Objects: map[meta.Key]*MockOperation{},
+		Errors:  map[MockOperationKey]*MockOperationError{},
+	}
+}
+
+// MockOperations models GCE long-running operations for the mocks. Use
+// MockGCE.EnableOperations() to have mutating mock methods (Insert, Delete and
+// the additional operation methods) create an operation for each call. The
+// mutation is applied to the mock when the operation completes.
+//
+// This object is thread-safe.
+type MockOperations struct {
+	Lock sync.Mutex
+
+	// PendingDuration is how long operations stay in the PENDING state before
+	// becoming RUNNING.
+	PendingDuration time.Duration
+	// Latency is the time from operation creation to DONE. Latency should be
+	// >= PendingDuration.
+	Latency time.Duration
+
+	// Objects are the operations that have been created, indexed by the key
+	// of the operation (i.e. the operation name, in the same location as the
+	// resource).
+	Objects map[meta.Key]*MockOperation
+	// Errors to inject into operations. If an entry exists for the key, the
+	// operation will fail with the error.
+	Errors map[MockOperationKey]*MockOperationError
+
+	count int
+}
+
+// MockOperation is a single operation.
+type MockOperation struct {
+	// ProjectID of the operation.
+	ProjectID string
+	// Key is the mutation that created this operation.
+	Key MockOperationKey
+	// Op is the state of the operation. Status is not updated in Op; use
+	// MockOperations.Get() to get the current state.
+	Op *ga.Operation
+
+	seq   int
+	opKey meta.Key
+	start time.Time
+	done  chan struct{}
+}
+
+// Done returns true if the operation has finished.
+func (op *MockOperation) Done() bool {
+	select {
+	case <-op.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// snapshot returns a copy of the operation with the status at the time now.
+// Caller must hold the MockOperations lock.
+func (op *MockOperation) snapshot(o *MockOperations, now time.Time) *ga.Operation {
+	ret := *op.Op
+	switch {
+	case op.Done():
+		ret.Status = operationStatusDone
+		ret.Progress = 100
+	case now.Sub(op.start) < o.PendingDuration:
+		ret.Status = operationStatusPending
+	default:
+		ret.Status = operationStatusRunning
+		ret.StartTime = op.start.Add(o.PendingDuration).Format(time.RFC3339)
+	}
+	return &ret
+}
+
+// Get the operation, similar to {Global,Region,Zone}Operations.Get(). The
+// scope of the key determines the type of the operation.
+func (o *MockOperations) Get(ctx context.Context, projectID string, key *meta.Key) (*ga.Operation, error) {
+	o.Lock.Lock()
+	defer o.Lock.Unlock()
+
+	op, ok := o.Objects[*key]
+	if !ok || op.ProjectID != projectID {
+		err := &googleapi.Error{
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("MockOperations %v not found", key),
+		}
+		klog.V(5).Infof("MockOperations.Get(%v, %q, %v) = nil, %v", ctx, projectID, key, err)
+		return nil, err
+	}
+	ret := op.snapshot(o, time.Now())
+	klog.V(5).Infof("MockOperations.Get(%v, %q, %v) = %+v, nil", ctx, projectID, key, ret)
+	return ret, nil
+}
+
+// Wait for the operation to be DONE, similar to
+// {Global,Region,Zone}Operations.Wait().
+func (o *MockOperations) Wait(ctx context.Context, projectID string, key *meta.Key) (*ga.Operation, error) {
+	o.Lock.Lock()
+	op, ok := o.Objects[*key]
+	o.Lock.Unlock()
+
+	if !ok || op.ProjectID != projectID {
+		return o.Get(ctx, projectID, key)
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-op.done:
+	}
+	return o.Get(ctx, projectID, key)
+}
+
+// List the operations in the scope of key (the name of key is ignored) that
+// match fl, similar to {Global,Region,Zone}Operations.List().
+func (o *MockOperations) List(ctx context.Context, projectID string, key *meta.Key, fl *filter.F) ([]*ga.Operation, error) {
+	o.Lock.Lock()
+	defer o.Lock.Unlock()
+
+	now := time.Now()
+	var ret []*ga.Operation
+	for k, op := range o.Objects {
+		if op.ProjectID != projectID || k.Region != key.Region || k.Zone != key.Zone {
+			continue
+		}
+		if snapshot := op.snapshot(o, now); fl.Match(snapshot) {
+			ret = append(ret, snapshot)
+		}
+	}
+	klog.V(5).Infof("MockOperations.List(%v, %q, %v, %v) = [%v items], nil", ctx, projectID, key, fl, len(ret))
+	return ret, nil
+}
+
+// Find returns the current state of all of the operations created for the
+// mutation opKey, ordered from oldest to newest.
+func (o *MockOperations) Find(projectID string, opKey MockOperationKey) []*ga.Operation {
+	o.Lock.Lock()
+	defer o.Lock.Unlock()
+
+	var ops []*MockOperation
+	for _, op := range o.Objects {
+		if op.ProjectID == projectID && op.Key == opKey {
+			ops = append(ops, op)
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].seq < ops[j].seq })
+
+	now := time.Now()
+	var ret []*ga.Operation
+	for _, op := range ops {
+		ret = append(ret, op.snapshot(o, now))
+	}
+	return ret
+}
+
+// run an operation for the mutation. apply is called when the operation
+// completes and any error returned becomes the error of the operation. run
+// blocks until the operation is DONE (or ctx is cancelled) and returns the
+// same error that Service.WaitForCompletion() would return.
+//
+// If run is called from one of the Async methods (see mockAsync()), the
+// operation is attached to the handle and run returns immediately.
+//
+// The caller must not hold any mock locks that apply needs, as apply is called
+// from a different goroutine.
+func (o *MockOperations) run(ctx context.Context, projectID string, opKey MockOperationKey, version meta.Version, resource string, apply func() error) error {
+	op := o.start(projectID, opKey, version, resource, apply)
+	if h, ok := ctx.Value(mockAsyncKey).(*mockOperation); ok {
+		h.ops, h.op = o, op
+		h.ref.Key = op.opKey
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-op.done:
+	}
+	o.Lock.Lock()
+	defer o.Lock.Unlock()
+	return gaOperationErr(op.Op)
+}
+
+func (o *MockOperations) start(projectID string, opKey MockOperationKey, version meta.Version, resource string, apply func() error) *MockOperation {
+	o.Lock.Lock()
+	defer o.Lock.Unlock()
+
+	now := time.Now()
+	o.count++
+	name := fmt.Sprintf("operation-%d-%d", now.UnixNano(), o.count)
+
+	var key *meta.Key
+	gaOp := &ga.Operation{
+		Kind:          "compute#operation",
+		Name:          name,
+		OperationType: lowerFirst(opKey.Method),
+		TargetLink:    SelfLink(version, projectID, resource, &opKey.Key),
+		InsertTime:    now.Format(time.RFC3339),
+	}
+	switch opKey.Key.Type() {
+	case meta.Regional:
+		key = meta.RegionalKey(name, opKey.Key.Region)
+		gaOp.Region = SelfLink(meta.VersionGA, projectID, "regions", meta.GlobalKey(opKey.Key.Region))
+	case meta.Zonal:
+		key = meta.ZonalKey(name, opKey.Key.Zone)
+		gaOp.Zone = SelfLink(meta.VersionGA, projectID, "zones", meta.GlobalKey(opKey.Key.Zone))
+	default:
+		key = meta.GlobalKey(name)
+	}
+	gaOp.SelfLink = SelfLink(version, projectID, "operations", key)
+
+	op := &MockOperation{
+		ProjectID: projectID,
+		Key:       opKey,
+		Op:        gaOp,
+		seq:       o.count,
+		opKey:     *key,
+		start:     now,
+		done:      make(chan struct{}),
+	}
+	o.Objects[*key] = op
+
+	var injected *MockOperationError
+	if e, ok := o.Errors[opKey]; ok {
+		injected = e
+	}
+
+	time.AfterFunc(o.Latency, func() {
+		var mErr *MockOperationError
+		if injected != nil {
+			mErr = injected
+		} else if apply != nil {
+			if err := apply(); err != nil {
+				mErr = toMockOperationError(err)
+			}
+		}
+
+		o.Lock.Lock()
+		defer o.Lock.Unlock()
+
+		end := time.Now()
+		gaOp.Status = operationStatusDone
+		gaOp.Progress = 100
+		gaOp.StartTime = op.start.Add(o.PendingDuration).Format(time.RFC3339)
+		gaOp.EndTime = end.Format(time.RFC3339)
+		if mErr != nil {
+			gaOp.HttpErrorStatusCode = int64(mErr.HTTPStatusCode)
+			gaOp.HttpErrorMessage = strings.ToUpper(http.StatusText(mErr.HTTPStatusCode))
+			gaOp.Error = &ga.OperationError{
+				Errors: []*ga.OperationErrorErrors{{Code: mErr.Code, Message: mErr.Message}},
+			}
+		}
+		close(op.done)
+		klog.V(5).Infof("MockOperations: %v done (err = %+v)", key, mErr)
+	})
+	klog.V(5).Infof("MockOperations: started %v for %+v", key, opKey)
+
+	return op
+}
+
+// resume returns the handle for the operation in ref.
+func (o *MockOperations) resume(ref *OperationRef) (Operation, error) {
+	o.Lock.Lock()
+	defer o.Lock.Unlock()
+
+	op, ok := o.Objects[ref.Key]
+	if !ok || op.ProjectID != ref.ProjectID {
+		return nil, &googleapi.Error{
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("MockOperations %v not found", ref.Key),
+		}
+	}
+	return &mockOperation{ops: o, op: op, ref: *ref}, nil
+}
+
+// ResumeOperation returns the handle for the operation referred to by ref.
+// Operations must be enabled (see EnableOperations()) for the mock to track
+// them.
+func (mock *MockGCE) ResumeOperation(ref *OperationRef) (Operation, error) {
+	if mock.Operations == nil {
+		return nil, &googleapi.Error{
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("MockOperations %v not found (operations are not enabled)", ref.Key),
+		}
+	}
+	return mock.Operations.resume(ref)
+}
+
+type mockAsyncKeyType struct{}
+
+// mockAsyncKey is the context key for the *mockOperation handle used by the
+// Async methods.
+var mockAsyncKey = mockAsyncKeyType{}
+
+// mockAsync calls the mutation f (e.g. Insert()) for an Async method. If
+// operations are enabled, f returns as soon as the operation has been
+// started and the returned handle tracks it. Otherwise the mutation has
+// already been applied by f and the handle is done.
+func mockAsync(ctx context.Context, version meta.Version, target *ResourceID, f func(ctx context.Context) error) (Operation, error) {
+	h := &mockOperation{ref: OperationRef{ProjectID: target.ProjectID, Version: version, Target: target}}
+	if err := f(context.WithValue(ctx, mockAsyncKey, h)); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// mockOperation implements Operation for the mocks.
+type mockOperation struct {
+	// ops and op are nil if no operation was created for the mutation.
+	ops *MockOperations
+	op  *MockOperation
+	ref OperationRef
+}
+
+// Wait implements Operation.
+func (o *mockOperation) Wait(ctx context.Context) error {
+	if o.op == nil {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-o.op.done:
+	}
+	return o.Err()
+}
+
+// Done implements Operation.
+func (o *mockOperation) Done(ctx context.Context) (bool, error) {
+	return o.op == nil || o.op.Done(), nil
+}
+
+// Err implements Operation.
+func (o *mockOperation) Err() error {
+	if o.op == nil || !o.op.Done() {
+		return nil
+	}
+	o.ops.Lock.Lock()
+	defer o.ops.Lock.Unlock()
+	return gaOperationErr(o.op.Op)
+}
+
+// ResourceID implements Operation.
+func (o *mockOperation) ResourceID() *ResourceID {
+	return o.ref.Target
+}
+
+// Ref implements Operation.
+func (o *mockOperation) Ref() *OperationRef {
+	ret := o.ref
+	return &ret
+}
+
+// toMockOperationError converts the error from a mock mutation into an
+// operation error.
+func toMockOperationError(err error) *MockOperationError {
+	ret := &MockOperationError{
+		HTTPStatusCode: http.StatusBadRequest,
+		Code:           "MOCK_ERROR",
+		Message:        err.Error(),
+	}
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		ret.HTTPStatusCode = gerr.Code
+		ret.Message = gerr.Message
+		if len(gerr.Errors) > 0 {
+			ret.Code = gerr.Errors[0].Reason
+		}
+	}
+	return ret
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
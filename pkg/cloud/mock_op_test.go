@@ -0,0 +1,394 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	ga "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/google/go-cmp/cmp"
+)
+
+// onlyOperation returns the single operation in ops.
+func onlyOperation(t *testing.T, ops *MockOperations) (meta.Key, *MockOperation) {
+	t.Helper()
+
+	ops.Lock.Lock()
+	defer ops.Lock.Unlock()
+
+	if len(ops.Objects) != 1 {
+		t.Fatalf("len(ops.Objects) = %d, want 1", len(ops.Objects))
+	}
+	for k, op := range ops.Objects {
+		return k, op
+	}
+	return meta.Key{}, nil
+}
+
+func TestMockOperationsInsertDelete(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mock := NewMockGCE(&SingleProjectRouter{"proj"})
+	ops := NewMockOperations()
+	mock.EnableOperations(ops)
+
+	key := meta.RegionalKey("addr", "us-central1")
+	if err := mock.Addresses().Insert(ctx, key, &ga.Address{}); err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+	if _, err := mock.Addresses().Get(ctx, key); err != nil {
+		t.Errorf("Get() = %v, want nil", err)
+	}
+
+	opKey, _ := onlyOperation(t, ops)
+	if opKey.Region != key.Region {
+		t.Errorf("opKey = %v, want region %q", opKey, key.Region)
+	}
+	op, err := ops.Get(ctx, "proj", &opKey)
+	if err != nil {
+		t.Fatalf("ops.Get() = %v, want nil", err)
+	}
+	if op.Status != operationStatusDone || op.OperationType != "insert" || op.Error != nil {
+		t.Errorf("ops.Get() = %+v, want DONE insert without error", op)
+	}
+	if want := SelfLink(meta.VersionGA, "proj", "addresses", key); op.TargetLink != want {
+		t.Errorf("op.TargetLink = %q, want %q", op.TargetLink, want)
+	}
+	if _, err := ops.Get(ctx, "other-proj", &opKey); err == nil {
+		t.Errorf("ops.Get(other-proj) = nil, want error")
+	}
+
+	if err := mock.Addresses().Delete(ctx, key); err != nil {
+		t.Fatalf("Delete() = %v, want nil", err)
+	}
+	if _, err := mock.Addresses().Get(ctx, key); err == nil {
+		t.Errorf("Get() = nil, want error after Delete()")
+	}
+}
+
+func TestMockOperationsStates(t *testing.T) {
+	t.Parallel()
+
+	mock := NewMockGCE(&SingleProjectRouter{"proj"})
+	ops := NewMockOperations()
+	ops.PendingDuration = 50 * time.Millisecond
+	ops.Latency = time.Hour
+	mock.EnableOperations(ops)
+
+	key := meta.GlobalKey("hc")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := mock.HealthChecks().Insert(ctx, key, &ga.HealthCheck{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Insert() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	// The object is not created until the operation completes.
+	if _, err := mock.HealthChecks().Get(context.Background(), key); err == nil {
+		t.Errorf("Get() = nil, want error for pending operation")
+	}
+
+	opKey, _ := onlyOperation(t, ops)
+	op, err := ops.Get(context.Background(), "proj", &opKey)
+	if err != nil {
+		t.Fatalf("ops.Get() = %v, want nil", err)
+	}
+	if op.Status != operationStatusPending {
+		t.Errorf("op.Status = %q, want %q", op.Status, operationStatusPending)
+	}
+
+	time.Sleep(ops.PendingDuration)
+	op, err = ops.Get(context.Background(), "proj", &opKey)
+	if err != nil {
+		t.Fatalf("ops.Get() = %v, want nil", err)
+	}
+	if op.Status != operationStatusRunning {
+		t.Errorf("op.Status = %q, want %q", op.Status, operationStatusRunning)
+	}
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer waitCancel()
+	if _, err := ops.Wait(waitCtx, "proj", &opKey); err == nil {
+		t.Errorf("ops.Wait() = nil, want error")
+	}
+}
+
+func TestMockOperationsLatency(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mock := NewMockGCE(&SingleProjectRouter{"proj"})
+	ops := NewMockOperations()
+	ops.Latency = 20 * time.Millisecond
+	mock.EnableOperations(ops)
+
+	start := time.Now()
+	if err := mock.Networks().Insert(ctx, meta.GlobalKey("net"), &ga.Network{}); err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+	if elapsed := time.Since(start); elapsed < ops.Latency {
+		t.Errorf("Insert() took %v, want >= %v", elapsed, ops.Latency)
+	}
+	opKey, _ := onlyOperation(t, ops)
+	op, err := ops.Wait(ctx, "proj", &opKey)
+	if err != nil || op.Status != operationStatusDone {
+		t.Errorf("ops.Wait() = %+v, %v; want DONE, nil", op, err)
+	}
+}
+
+func TestMockOperationsInjectedError(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mock := NewMockGCE(&SingleProjectRouter{"proj"})
+	ops := NewMockOperations()
+	mock.EnableOperations(ops)
+
+	key := meta.GlobalKey("bs")
+	ops.Errors[MockOperationKey{Service: "BackendServices", Method: "Delete", Key: *key}] = &MockOperationError{
+		HTTPStatusCode: http.StatusBadRequest,
+		Code:           "RESOURCE_IN_USE_BY_ANOTHER_RESOURCE",
+		Message:        "in use",
+	}
+	if err := mock.BackendServices().Insert(ctx, key, &ga.BackendService{}); err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+	err := mock.BackendServices().Delete(ctx, key)
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) || gerr.Code != http.StatusBadRequest {
+		t.Fatalf("Delete() = %v, want googleapi.Error with code %d", err, http.StatusBadRequest)
+	}
+	if _, err := mock.BackendServices().Get(ctx, key); err != nil {
+		t.Errorf("Get() = %v, want nil (Delete should not have been applied)", err)
+	}
+
+	// The operation records the error in the same form as GCE.
+	var failed *ga.Operation
+	for k := range ops.Objects {
+		k := k
+		op, err := ops.Get(ctx, "proj", &k)
+		if err != nil {
+			t.Fatalf("ops.Get() = %v, want nil", err)
+		}
+		if op.OperationType == "delete" {
+			failed = op
+		}
+	}
+	if failed == nil || failed.HttpErrorStatusCode != http.StatusBadRequest || failed.Error == nil ||
+		failed.Error.Errors[0].Code != "RESOURCE_IN_USE_BY_ANOTHER_RESOURCE" {
+		t.Errorf("delete operation = %+v, want injected error", failed)
+	}
+}
+
+func TestMockOperationsAdditionalMethod(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mock := NewMockGCE(&SingleProjectRouter{"proj"})
+	ops := NewMockOperations()
+	mock.EnableOperations(ops)
+
+	var called bool
+	mock.MockBackendServices.UpdateHook = func(context.Context, *meta.Key, *ga.BackendService, *MockBackendServices) error {
+		called = true
+		return &googleapi.Error{Code: http.StatusPreconditionFailed, Message: "fingerprint"}
+	}
+	key := meta.GlobalKey("bs")
+	err := mock.BackendServices().Update(ctx, key, &ga.BackendService{})
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) || gerr.Code != http.StatusPreconditionFailed {
+		t.Errorf("Update() = %v, want googleapi.Error with code %d", err, http.StatusPreconditionFailed)
+	}
+	if !called {
+		t.Errorf("UpdateHook was not called")
+	}
+	_, op := onlyOperation(t, ops)
+	if op.Op.OperationType != "update" {
+		t.Errorf("op.OperationType = %q, want \"update\"", op.Op.OperationType)
+	}
+}
+
+func TestMockOperationsAsync(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mock := NewMockGCE(&SingleProjectRouter{"proj"})
+	ops := NewMockOperations()
+	ops.Latency = 50 * time.Millisecond
+	mock.EnableOperations(ops)
+
+	// Start the operations concurrently and then wait for all of them.
+	start := time.Now()
+	var handles []Operation
+	for _, name := range []string{"a", "b", "c"} {
+		key := meta.ZonalKey(name, "us-central1-b")
+		op, err := mock.NetworkEndpointGroups().InsertAsync(ctx, key, &ga.NetworkEndpointGroup{})
+		if err != nil {
+			t.Fatalf("InsertAsync(%v) = %v, want nil", key, err)
+		}
+		if done, err := op.Done(ctx); done || err != nil {
+			t.Errorf("Done() = %t, %v; want false, nil", done, err)
+		}
+		if want := NewNetworkEndpointGroupsResourceID("proj", "us-central1-b", name); !op.ResourceID().Equal(want) {
+			t.Errorf("ResourceID() = %v, want %v", op.ResourceID(), want)
+		}
+		handles = append(handles, op)
+	}
+	if elapsed := time.Since(start); elapsed >= ops.Latency {
+		t.Errorf("InsertAsync() took %v, want < %v", elapsed, ops.Latency)
+	}
+	for _, op := range handles {
+		if err := op.Wait(ctx); err != nil {
+			t.Errorf("Wait() = %v, want nil", err)
+		}
+		if done, err := op.Done(ctx); !done || err != nil {
+			t.Errorf("Done() = %t, %v; want true, nil", done, err)
+		}
+		if _, err := mock.NetworkEndpointGroups().Get(ctx, op.ResourceID().Key); err != nil {
+			t.Errorf("Get(%v) = %v, want nil", op.ResourceID().Key, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= 2*ops.Latency {
+		t.Errorf("InsertAsync() + Wait() took %v, want < %v", elapsed, 2*ops.Latency)
+	}
+}
+
+func TestMockOperationsAsyncError(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mock := NewMockGCE(&SingleProjectRouter{"proj"})
+	ops := NewMockOperations()
+	mock.EnableOperations(ops)
+
+	key := meta.GlobalKey("bs")
+	if err := mock.BackendServices().Insert(ctx, key, &ga.BackendService{}); err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+	ops.Errors[MockOperationKey{Service: "BackendServices", Method: "Delete", Key: *key}] = &MockOperationError{
+		HTTPStatusCode: http.StatusBadRequest,
+		Code:           "RESOURCE_IN_USE_BY_ANOTHER_RESOURCE",
+		Message:        "in use",
+	}
+	op, err := mock.BackendServices().DeleteAsync(ctx, key)
+	if err != nil {
+		t.Fatalf("DeleteAsync() = %v, want nil", err)
+	}
+	err = op.Wait(ctx)
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) || gerr.Code != http.StatusBadRequest {
+		t.Errorf("Wait() = %v, want googleapi.Error with code %d", err, http.StatusBadRequest)
+	}
+	if err := op.Err(); !errors.As(err, &gerr) || gerr.Code != http.StatusBadRequest {
+		t.Errorf("Err() = %v, want googleapi.Error with code %d", err, http.StatusBadRequest)
+	}
+
+	// Errors that occur before the operation is created are returned
+	// directly.
+	key2 := meta.GlobalKey("bs2")
+	mock.MockBackendServices.InsertError[*key2] = &googleapi.Error{Code: http.StatusForbidden}
+	if op, err := mock.BackendServices().InsertAsync(ctx, key2, &ga.BackendService{}); err == nil {
+		t.Errorf("InsertAsync() = %v, nil; want error", op)
+	}
+}
+
+func TestMockOperationsAsyncWithoutOperations(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mock := NewMockGCE(&SingleProjectRouter{"proj"})
+
+	var called bool
+	mock.MockBackendServices.UpdateHook = func(context.Context, *meta.Key, *ga.BackendService, *MockBackendServices) error {
+		called = true
+		return nil
+	}
+	op, err := mock.BackendServices().UpdateAsync(ctx, meta.GlobalKey("bs"), &ga.BackendService{})
+	if err != nil {
+		t.Fatalf("UpdateAsync() = %v, want nil", err)
+	}
+	// The mutation is applied synchronously.
+	if !called {
+		t.Errorf("UpdateHook was not called")
+	}
+	if done, err := op.Done(ctx); !done || err != nil {
+		t.Errorf("Done() = %t, %v; want true, nil", done, err)
+	}
+	if err := op.Wait(ctx); err != nil {
+		t.Errorf("Wait() = %v, want nil", err)
+	}
+}
+
+func TestMockOperationsResume(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mock := NewMockGCE(&SingleProjectRouter{"proj"})
+	ops := NewMockOperations()
+	ops.Latency = 20 * time.Millisecond
+	mock.EnableOperations(ops)
+
+	key := meta.RegionalKey("addr", "us-central1")
+	op, err := mock.Addresses().InsertAsync(ctx, key, &ga.Address{})
+	if err != nil {
+		t.Fatalf("InsertAsync() = %v, want nil", err)
+	}
+
+	// Serialize the reference and resume from it.
+	b, err := json.Marshal(op.Ref())
+	if err != nil {
+		t.Fatalf("json.Marshal() = %v, want nil", err)
+	}
+	var ref OperationRef
+	if err := json.Unmarshal(b, &ref); err != nil {
+		t.Fatalf("json.Unmarshal(%s) = %v, want nil", b, err)
+	}
+	if diff := cmp.Diff(&ref, op.Ref()); diff != "" {
+		t.Errorf("OperationRef diff after JSON round trip: -got,+want: %s", diff)
+	}
+	if ref.Key.Region != key.Region || ref.Key.Name == key.Name {
+		t.Errorf("ref.Key = %v, want operation key in region %q", ref.Key, key.Region)
+	}
+
+	resumed, err := mock.ResumeOperation(&ref)
+	if err != nil {
+		t.Fatalf("ResumeOperation() = %v, want nil", err)
+	}
+	if err := resumed.Wait(ctx); err != nil {
+		t.Errorf("Wait() = %v, want nil", err)
+	}
+	if !resumed.ResourceID().Equal(NewAddressesResourceID("proj", "us-central1", "addr")) {
+		t.Errorf("ResourceID() = %v, want addr", resumed.ResourceID())
+	}
+	if _, err := mock.Addresses().Get(ctx, key); err != nil {
+		t.Errorf("Get() = %v, want nil", err)
+	}
+
+	ref.ProjectID = "other-proj"
+	if _, err := mock.ResumeOperation(&ref); err == nil {
+		t.Errorf("ResumeOperation(%+v) = nil, want error", ref)
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"google.golang.org/api/googleapi"
+)
+
+// mockDefaultPageSize is the number of items in a page returned by the mocks
+// if ListOptions.MaxResults is not set. This is the same as the GCE default.
+const mockDefaultPageSize = 500
+
+// newMockPageIterator returns an iterator over the items returned by list in
+// pages of at most opts.MaxResults items. list is called when the first page
+// is fetched; the following pages are taken from the same result. As with
+// GCE, the page tokens are opaque strings; an invalid token results in a 400
+// error.
+func newMockPageIterator[T any](ctx context.Context, opts *ListOptions, list func() ([]T, error)) *PageIterator[[]T] {
+	size := int(opts.maxResults())
+	if size <= 0 {
+		size = mockDefaultPageSize
+	}
+	var all []T
+	return newPageIterator(ctx, func(ctx context.Context, pageToken string) ([]T, string, error) {
+		var offset int
+		if pageToken == "" {
+			var err error
+			if all, err = list(); err != nil {
+				return nil, "", err
+			}
+		} else {
+			var err error
+			offset, err = strconv.Atoi(pageToken)
+			if err != nil || offset <= 0 || offset >= len(all) {
+				msg := fmt.Sprintf("Invalid value for page token: %q", pageToken)
+				return nil, "", &googleapi.Error{
+					Code:    http.StatusBadRequest,
+					Message: msg,
+					Errors:  []googleapi.ErrorItem{{Reason: "invalid", Message: msg}},
+				}
+			}
+		}
+		end := offset + size
+		if end >= len(all) {
+			return all[offset:], "", nil
+		}
+		return all[offset:end], strconv.Itoa(end), nil
+	})
+}
+
+// newMockAggregatedPageIterator is the same as newMockPageIterator() for
+// AggregatedList. The items are paged in order of their location.
+func newMockAggregatedPageIterator[T any](ctx context.Context, opts *ListOptions, list func() (map[string][]*T, error)) *PageIterator[map[string][]*T] {
+	type item struct {
+		location string
+		obj      *T
+	}
+	items := newMockPageIterator(ctx, opts, func() ([]item, error) {
+		objs, err := list()
+		if err != nil {
+			return nil, err
+		}
+		var locations []string
+		for l := range objs {
+			locations = append(locations, l)
+		}
+		sort.Strings(locations)
+		var ret []item
+		for _, l := range locations {
+			for _, obj := range objs[l] {
+				ret = append(ret, item{location: l, obj: obj})
+			}
+		}
+		return ret, nil
+	})
+	return newPageIterator(ctx, func(ctx context.Context, pageToken string) (map[string][]*T, string, error) {
+		page, next, err := items.fetch(ctx, pageToken)
+		if err != nil {
+			return nil, "", err
+		}
+		ret := map[string][]*T{}
+		for _, it := range page {
+			ret[it.location] = append(ret[it.location], it.obj)
+		}
+		return ret, next, nil
+	})
+}
@@ -0,0 +1,268 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/googleapi"
+	"k8s.io/klog/v2"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+)
+
+const (
+	// mockReasonInUse is the error reason returned by GCE when deleting a
+	// resource that is referenced by another resource.
+	mockReasonInUse = "resourceInUseByAnotherResource"
+	// mockReasonNotFound is the error reason returned by GCE when a resource
+	// (or a resource it references) does not exist.
+	mockReasonNotFound = "notFound"
+)
+
+var (
+	// mockRefSkipFields are fields that contain resource URLs but are not
+	// references to other resources.
+	mockRefSkipFields = map[string]bool{
+		"region":         true,
+		"selfLink":       true,
+		"selfLinkWithId": true,
+		"users":          true,
+		"zone":           true,
+	}
+	// mockRefSkipResources are locations rather than resources that can be
+	// created and deleted.
+	mockRefSkipResources = map[string]bool{
+		"projects": true,
+		"regions":  true,
+		"zones":    true,
+	}
+)
+
+// mockRefKey identifies a resource tracked by MockReferences.
+type mockRefKey struct {
+	projectID string
+	resource  string
+	key       meta.Key
+}
+
+func (k mockRefKey) String() string {
+	return RelativeResourceName(k.projectID, k.resource, &k.key)
+}
+
+// NewMockReferences returns a new, empty reference tracker.
+func NewMockReferences() *MockReferences {
+	return &MockReferences{
+		objects: map[mockRefKey]map[mockRefKey]bool{},
+	}
+}
+
+// MockReferences enforces referential integrity between the objects in the
+// mocks. Use MockGCE.EnableReferences() to have the mocks:
+//
+//   - return 404 "notFound" on Insert() if the object references a resource
+//     that does not exist (e.g. a UrlMap with a missing default BackendService).
+//   - return 400 "resourceInUseByAnotherResource" on Delete() if the object is
+//     still referenced by another object (e.g. a HealthCheck that is used by a
+//     BackendService).
+//
+// References are any fields that contain a resource URL of a type that is
+// managed by the mocks (e.g. ForwardingRule.Target, UrlMap.DefaultService,
+// BackendService.HealthChecks, Backend.Group, Subnetwork.Network).
+// References to resources in other projects are not checked.
+//
+// Only objects created via Insert() are tracked; objects that are added
+// directly to the Objects map of a mock will not be visible to
+// MockReferences. Hooks that change the references of an object (e.g. an
+// UpdateHook) should call Update() to keep the tracking consistent.
+//
+// This object is thread-safe.
+type MockReferences struct {
+	lock sync.Mutex
+	// objects that exist, with the set of objects that they reference.
+	objects map[mockRefKey]map[mockRefKey]bool
+}
+
+// Update the references from the object identified by (projectID, resource,
+// key) to be the ones contained in obj. This should be called if the
+// references of an object are changed by a hook. Returns a 404 error if obj
+// references a resource that does not exist.
+func (r *MockReferences) Update(projectID, resource string, key *meta.Key, obj interface{}) error {
+	return r.insert(projectID, resource, key, obj)
+}
+
+// checkInsert returns an error if obj references objects that do not exist.
+func (r *MockReferences) checkInsert(projectID, resource string, key *meta.Key, obj interface{}) error {
+	self := mockRefKey{projectID: projectID, resource: resource, key: *key}
+	refs, err := mockReferencesOf(self, obj)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.checkRefs(refs)
+}
+
+// insert records obj and the objects it references. The references are
+// validated first.
+func (r *MockReferences) insert(projectID, resource string, key *meta.Key, obj interface{}) error {
+	self := mockRefKey{projectID: projectID, resource: resource, key: *key}
+	refs, err := mockReferencesOf(self, obj)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if err := r.checkRefs(refs); err != nil {
+		return err
+	}
+	r.objects[self] = refs
+	klog.V(5).Infof("MockReferences: %v references %v", self, refs)
+	return nil
+}
+
+// checkDelete returns an error if the object is referenced by another object.
+func (r *MockReferences) checkDelete(projectID, resource string, key *meta.Key) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.checkReferrers(mockRefKey{projectID: projectID, resource: resource, key: *key})
+}
+
+// delete the object if it is not referenced by another object.
+func (r *MockReferences) delete(projectID, resource string, key *meta.Key) error {
+	self := mockRefKey{projectID: projectID, resource: resource, key: *key}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if err := r.checkReferrers(self); err != nil {
+		return err
+	}
+	delete(r.objects, self)
+	return nil
+}
+
+// checkRefs returns a 404 error if any of refs do not exist. Caller must hold
+// the lock.
+func (r *MockReferences) checkRefs(refs map[mockRefKey]bool) error {
+	var missing []string
+	for ref := range refs {
+		if _, ok := r.objects[ref]; !ok {
+			missing = append(missing, ref.String())
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	msg := fmt.Sprintf("The resource '%s' was not found", missing[0])
+	return &googleapi.Error{
+		Code:    http.StatusNotFound,
+		Message: msg,
+		Errors:  []googleapi.ErrorItem{{Reason: mockReasonNotFound, Message: msg}},
+	}
+}
+
+// checkReferrers returns a 400 error if self is referenced by another object.
+// Caller must hold the lock.
+func (r *MockReferences) checkReferrers(self mockRefKey) error {
+	var referrers []string
+	for k, refs := range r.objects {
+		if refs[self] {
+			referrers = append(referrers, k.String())
+		}
+	}
+	if len(referrers) == 0 {
+		return nil
+	}
+	sort.Strings(referrers)
+	msg := fmt.Sprintf("The resource '%s' is already being used by '%s'", self, referrers[0])
+	return &googleapi.Error{
+		Code:    http.StatusBadRequest,
+		Message: msg,
+		Errors:  []googleapi.ErrorItem{{Reason: mockReasonInUse, Message: msg}},
+	}
+}
+
+// mockRefResources are the resources that are managed by the mocks.
+var mockRefResources = func() map[string]bool {
+	ret := map[string]bool{}
+	for _, s := range meta.AllServices {
+		if !mockRefSkipResources[s.Resource] {
+			ret[s.Resource] = true
+		}
+	}
+	return ret
+}()
+
+// mockReferencesOf returns the set of resources referenced by obj. obj may be
+// any API version of the resource.
+func mockReferencesOf(self mockRefKey, obj interface{}) (map[mockRefKey]bool, error) {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var fields interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+
+	ret := map[mockRefKey]bool{}
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for name, fv := range v {
+				if !mockRefSkipFields[name] {
+					walk(fv)
+				}
+			}
+		case []interface{}:
+			for _, ev := range v {
+				walk(ev)
+			}
+		case string:
+			if !strings.Contains(v, "/") {
+				return
+			}
+			id, err := ParseResourceURL(v)
+			if err != nil || id.Key == nil || !mockRefResources[id.Resource] {
+				return
+			}
+			ref := mockRefKey{projectID: id.ProjectID, resource: id.Resource, key: *id.Key}
+			if ref.projectID == "" {
+				ref.projectID = self.projectID
+			}
+			if ref.projectID == self.projectID && ref != self {
+				ret[ref] = true
+			}
+		}
+	}
+	walk(fields)
+
+	return ret, nil
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	alpha "google.golang.org/api/compute/v0.alpha"
+	ga "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/google/go-cmp/cmp"
+)
+
+// checkMockRefErr checks that err is a googleapi.Error with the code and
+// reason. wantCode == 0 means err should be nil.
+func checkMockRefErr(t *testing.T, name string, err error, wantCode int, wantReason string) {
+	t.Helper()
+
+	if wantCode == 0 {
+		if err != nil {
+			t.Errorf("%s = %v, want nil", name, err)
+		}
+		return
+	}
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) {
+		t.Errorf("%s = %v, want *googleapi.Error", name, err)
+		return
+	}
+	if gerr.Code != wantCode || len(gerr.Errors) == 0 || gerr.Errors[0].Reason != wantReason {
+		t.Errorf("%s = %v, want code %d, reason %q", name, err, wantCode, wantReason)
+	}
+}
+
+func TestMockReferencesLoadBalancer(t *testing.T) {
+	t.Parallel()
+
+	for _, withOps := range []bool{false, true} {
+		ctx := context.Background()
+		mock := NewMockGCE(&SingleProjectRouter{"proj"})
+		mock.EnableReferences(NewMockReferences())
+		if withOps {
+			mock.EnableOperations(NewMockOperations())
+		}
+
+		hcKey := meta.GlobalKey("hc")
+		bsKey := meta.GlobalKey("bs")
+		umKey := meta.GlobalKey("um")
+		tpKey := meta.GlobalKey("tp")
+		frKey := meta.GlobalKey("fr")
+
+		hcLink := SelfLink(meta.VersionGA, "proj", "healthChecks", hcKey)
+		bs := &ga.BackendService{HealthChecks: []string{hcLink}}
+		um := &ga.UrlMap{DefaultService: SelfLink(meta.VersionGA, "proj", "backendServices", bsKey)}
+		// Relative and alpha references are also recognized.
+		tp := &alpha.TargetHttpProxy{UrlMap: "projects/proj/global/urlMaps/um"}
+		fr := &ga.ForwardingRule{Target: SelfLink(meta.VersionAlpha, "proj", "targetHttpProxies", tpKey)}
+
+		// Insert in the wrong order.
+		checkMockRefErr(t, "Insert(bs)", mock.BackendServices().Insert(ctx, bsKey, bs), http.StatusNotFound, "notFound")
+		if _, err := mock.BackendServices().Get(ctx, bsKey); err == nil {
+			t.Errorf("Get(bs) = nil, want error")
+		}
+
+		// Insert in dependency order.
+		checkMockRefErr(t, "Insert(hc)", mock.HealthChecks().Insert(ctx, hcKey, &ga.HealthCheck{}), 0, "")
+		checkMockRefErr(t, "Insert(bs)", mock.BackendServices().Insert(ctx, bsKey, bs), 0, "")
+		checkMockRefErr(t, "Insert(um)", mock.UrlMaps().Insert(ctx, umKey, um), 0, "")
+		checkMockRefErr(t, "Insert(tp)", mock.AlphaTargetHttpProxies().Insert(ctx, tpKey, tp), 0, "")
+		checkMockRefErr(t, "Insert(fr)", mock.GlobalForwardingRules().Insert(ctx, frKey, fr), 0, "")
+
+		// Delete in the wrong order.
+		checkMockRefErr(t, "Delete(hc)", mock.HealthChecks().Delete(ctx, hcKey), http.StatusBadRequest, "resourceInUseByAnotherResource")
+		checkMockRefErr(t, "Delete(um)", mock.UrlMaps().Delete(ctx, umKey), http.StatusBadRequest, "resourceInUseByAnotherResource")
+		if _, err := mock.HealthChecks().Get(ctx, hcKey); err != nil {
+			t.Errorf("Get(hc) = %v, want nil", err)
+		}
+
+		// Delete in dependency order.
+		checkMockRefErr(t, "Delete(fr)", mock.GlobalForwardingRules().Delete(ctx, frKey), 0, "")
+		checkMockRefErr(t, "Delete(tp)", mock.TargetHttpProxies().Delete(ctx, tpKey), 0, "")
+		checkMockRefErr(t, "Delete(um)", mock.UrlMaps().Delete(ctx, umKey), 0, "")
+		checkMockRefErr(t, "Delete(bs)", mock.BackendServices().Delete(ctx, bsKey), 0, "")
+		checkMockRefErr(t, "Delete(hc)", mock.HealthChecks().Delete(ctx, hcKey), 0, "")
+	}
+}
+
+func TestMockReferencesScope(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mock := NewMockGCE(&SingleProjectRouter{"proj"})
+	mock.EnableReferences(NewMockReferences())
+
+	netKey := meta.GlobalKey("net")
+	subnetKey := meta.RegionalKey("subnet", "us-central1")
+	subnet := &ga.Subnetwork{
+		Network: SelfLink(meta.VersionGA, "proj", "networks", netKey),
+		// Region is not a reference.
+		Region: "https://www.googleapis.com/compute/v1/projects/proj/regions/us-central1",
+	}
+	checkMockRefErr(t, "Insert(subnet)", mock.Subnetworks().Insert(ctx, subnetKey, subnet), http.StatusNotFound, "notFound")
+	checkMockRefErr(t, "Insert(net)", mock.Networks().Insert(ctx, netKey, &ga.Network{}), 0, "")
+	checkMockRefErr(t, "Insert(subnet)", mock.Subnetworks().Insert(ctx, subnetKey, subnet), 0, "")
+	checkMockRefErr(t, "Delete(net)", mock.Networks().Delete(ctx, netKey), http.StatusBadRequest, "resourceInUseByAnotherResource")
+
+	// References to other projects (e.g. Shared VPC) are not checked.
+	sharedKey := meta.RegionalKey("shared", "us-central1")
+	shared := &ga.Subnetwork{Network: SelfLink(meta.VersionGA, "host-proj", "networks", netKey)}
+	checkMockRefErr(t, "Insert(shared)", mock.Subnetworks().Insert(ctx, sharedKey, shared), 0, "")
+
+	// Regional and global resources with the same name are different.
+	bsKey := meta.RegionalKey("bs", "us-central1")
+	bs := &ga.BackendService{HealthChecks: []string{"projects/proj/global/healthChecks/hc"}}
+	checkMockRefErr(t, "Insert(hc)", mock.RegionHealthChecks().Insert(ctx, meta.RegionalKey("hc", "us-central1"), &ga.HealthCheck{}), 0, "")
+	checkMockRefErr(t, "Insert(bs)", mock.RegionBackendServices().Insert(ctx, bsKey, bs), http.StatusNotFound, "notFound")
+}
+
+func TestMockReferencesUpdate(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mock := NewMockGCE(&SingleProjectRouter{"proj"})
+	refs := NewMockReferences()
+	mock.EnableReferences(refs)
+
+	for _, name := range []string{"bs1", "bs2"} {
+		checkMockRefErr(t, "Insert("+name+")", mock.BackendServices().Insert(ctx, meta.GlobalKey(name), &ga.BackendService{}), 0, "")
+	}
+	umKey := meta.GlobalKey("um")
+	um := &ga.UrlMap{DefaultService: "projects/proj/global/backendServices/bs1"}
+	checkMockRefErr(t, "Insert(um)", mock.UrlMaps().Insert(ctx, umKey, um), 0, "")
+
+	// Simulate an UpdateHook changing the reference.
+	um.DefaultService = "projects/proj/global/backendServices/bs2"
+	checkMockRefErr(t, "Update(um)", refs.Update("proj", "urlMaps", umKey, um), 0, "")
+	checkMockRefErr(t, "Delete(bs1)", mock.BackendServices().Delete(ctx, meta.GlobalKey("bs1")), 0, "")
+	checkMockRefErr(t, "Delete(bs2)", mock.BackendServices().Delete(ctx, meta.GlobalKey("bs2")), http.StatusBadRequest, "resourceInUseByAnotherResource")
+
+	um.DefaultService = "projects/proj/global/backendServices/does-not-exist"
+	checkMockRefErr(t, "Update(um)", refs.Update("proj", "urlMaps", umKey, um), http.StatusNotFound, "notFound")
+}
+
+func TestMockReferencesOf(t *testing.T) {
+	t.Parallel()
+
+	self := mockRefKey{projectID: "proj", resource: "backendServices", key: *meta.GlobalKey("bs")}
+	obj := &ga.BackendService{
+		SelfLink:     SelfLink(meta.VersionGA, "proj", "backendServices", meta.GlobalKey("bs")),
+		Description:  "not/a/reference",
+		HealthChecks: []string{"global/healthChecks/hc"},
+		Backends: []*ga.Backend{
+			{Group: "https://www.googleapis.com/compute/v1/projects/proj/zones/us-central1-b/instanceGroups/ig"},
+			{Group: "projects/proj/zones/us-central1-b/networkEndpointGroups/neg"},
+		},
+		Network: "projects/other/global/networks/net",
+	}
+	got, err := mockReferencesOf(self, obj)
+	if err != nil {
+		t.Fatalf("mockReferencesOf() = %v, want nil", err)
+	}
+	want := map[mockRefKey]bool{
+		{projectID: "proj", resource: "healthChecks", key: *meta.GlobalKey("hc")}:                           true,
+		{projectID: "proj", resource: "instanceGroups", key: *meta.ZonalKey("ig", "us-central1-b")}:         true,
+		{projectID: "proj", resource: "networkEndpointGroups", key: *meta.ZonalKey("neg", "us-central1-b")}: true,
+	}
+	if diff := cmp.Diff(got, want, cmp.AllowUnexported(mockRefKey{})); diff != "" {
+		t.Errorf("mockReferencesOf(): -got,+want: %s", diff)
+	}
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// mockReasonConditionNotMet is the error reason returned by GCE when the
+// fingerprint in a request does not match the resource.
+const mockReasonConditionNotMet = "conditionNotMet"
+
+// mockOutputOnlyFields are preserved from the stored object on Update() if
+// they are not set in the request.
+var mockOutputOnlyFields = []string{
+	"CreationTimestamp",
+	"Id",
+	"Kind",
+	"Name",
+	"Region",
+	"SelfLink",
+	"Zone",
+}
+
+var mockFingerprintCount uint64
+
+// newMockFingerprint returns a new, unique fingerprint.
+func newMockFingerprint() string {
+	n := atomic.AddUint64(&mockFingerprintCount, 1)
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(time.Now().UnixNano())^n)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// mockApplyUpdate implements the default behavior of the Update, Patch and
+// SetLabels methods of the mocks. cur is the stored object, arg is the
+// argument of the method and the result is written to dest (which must be a
+// pointer to the same type as cur).
+//
+//   - Update replaces the object with arg.
+//   - Patch merges the fields set in arg into the object (JSON merge patch).
+//   - SetLabels replaces the Labels of the object.
+//
+// If arg has a non-empty Fingerprint (LabelFingerprint for SetLabels) that
+// does not match the stored object, a 412 "conditionNotMet" error is
+// returned, as is done by GCE. A new fingerprint is assigned to the updated
+// object.
+func mockApplyUpdate(method string, cur, arg, dest interface{}) error {
+	fingerprintField := "Fingerprint"
+	if method == "SetLabels" {
+		fingerprintField = "LabelFingerprint"
+	}
+	if want := mockStringField(arg, fingerprintField); want != "" || method == "SetLabels" {
+		if got := mockStringField(cur, fingerprintField); got != want {
+			msg := fmt.Sprintf("Invalid %s: got %q, want %q", lowerFirst(fingerprintField), want, got)
+			return &googleapi.Error{
+				Code:    http.StatusPreconditionFailed,
+				Message: msg,
+				Errors:  []googleapi.ErrorItem{{Reason: mockReasonConditionNotMet, Message: msg}},
+			}
+		}
+	}
+
+	switch method {
+	case "Update":
+		if err := copyViaJSON(dest, arg); err != nil {
+			return err
+		}
+		for _, f := range mockOutputOnlyFields {
+			if v := mockField(cur, f); v != nil {
+				SetMockDefault(dest, f, v)
+			}
+		}
+	case "Patch":
+		patched, err := mockMergePatch(cur, arg)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(patched, dest); err != nil {
+			return err
+		}
+	case "SetLabels":
+		if err := copyViaJSON(dest, cur); err != nil {
+			return err
+		}
+		var labels struct {
+			Labels map[string]string `json:"labels"`
+		}
+		if err := copyViaJSON(&labels, arg); err != nil {
+			return err
+		}
+		b, err := json.Marshal(labels)
+		if err != nil {
+			return err
+		}
+		// Clear the existing labels before replacing them.
+		mockClearField(dest, "Labels")
+		if err := json.Unmarshal(b, dest); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("mockApplyUpdate: unsupported method %q", method)
+	}
+
+	mockClearField(dest, fingerprintField)
+	SetMockDefault(dest, fingerprintField, newMockFingerprint())
+	return nil
+}
+
+// mockMergePatch applies the JSON merge patch (RFC 7386) of patch to cur.
+// Only fields that are set in patch are changed.
+func mockMergePatch(cur, patch interface{}) ([]byte, error) {
+	toMap := func(obj interface{}) (map[string]interface{}, error) {
+		b, err := json.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		ret := map[string]interface{}{}
+		if err := json.Unmarshal(b, &ret); err != nil {
+			return nil, err
+		}
+		return ret, nil
+	}
+	curMap, err := toMap(cur)
+	if err != nil {
+		return nil, err
+	}
+	patchMap, err := toMap(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	var merge func(dest, src map[string]interface{})
+	merge = func(dest, src map[string]interface{}) {
+		for k, v := range src {
+			srcMap, srcOK := v.(map[string]interface{})
+			destMap, destOK := dest[k].(map[string]interface{})
+			if srcOK && destOK {
+				merge(destMap, srcMap)
+				continue
+			}
+			dest[k] = v
+		}
+	}
+	merge(curMap, patchMap)
+
+	return json.Marshal(curMap)
+}
+
+// mockField returns the value of the field in the struct pointed to by obj or
+// nil if the field does not exist.
+func mockField(obj interface{}, field string) interface{} {
+	f, ok := mockFieldValue(obj, field)
+	if !ok {
+		return nil
+	}
+	return f.Interface()
+}
+
+// mockClearField sets the field in the struct pointed to by obj to the zero
+// value.
+func mockClearField(obj interface{}, field string) {
+	if f, ok := mockFieldValue(obj, field); ok && f.CanSet() {
+		f.Set(reflect.Zero(f.Type()))
+	}
+}
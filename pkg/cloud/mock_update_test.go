@@ -0,0 +1,186 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	alpha "google.golang.org/api/compute/v0.alpha"
+	ga "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/google/go-cmp/cmp"
+)
+
+func isPreconditionFailed(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == http.StatusPreconditionFailed
+}
+
+func TestMockDefaultUpdate(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mock := NewMockGCE(&SingleProjectRouter{"proj"})
+	mock.EnableDefaults(NewMockDefaults())
+
+	key := meta.GlobalKey("bs")
+	if err := mock.BackendServices().Insert(ctx, key, &ga.BackendService{Description: "v1"}); err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+	orig, _ := mock.BackendServices().Get(ctx, key)
+
+	// Update with the current fingerprint succeeds and bumps the fingerprint.
+	bs, _ := mock.BackendServices().Get(ctx, key)
+	bs.Description = "v2"
+	bs.Id = 0
+	if err := mock.BackendServices().Update(ctx, key, bs); err != nil {
+		t.Fatalf("Update() = %v, want nil", err)
+	}
+	got, _ := mock.BackendServices().Get(ctx, key)
+	if got.Description != "v2" {
+		t.Errorf("Description = %q, want v2", got.Description)
+	}
+	if got.Fingerprint == "" || got.Fingerprint == orig.Fingerprint {
+		t.Errorf("Fingerprint = %q, want new fingerprint (was %q)", got.Fingerprint, orig.Fingerprint)
+	}
+	// Output-only fields are preserved.
+	if got.Id != orig.Id || got.SelfLink != orig.SelfLink || got.CreationTimestamp != orig.CreationTimestamp {
+		t.Errorf("Update() = %+v, did not preserve output-only fields of %+v", got, orig)
+	}
+
+	// Stale fingerprint is rejected.
+	bs.Description = "v3"
+	if err := mock.BackendServices().Update(ctx, key, bs); !isPreconditionFailed(err) {
+		t.Errorf("Update(stale) = %v, want HTTP %d", err, http.StatusPreconditionFailed)
+	}
+	// Empty fingerprint is not checked.
+	bs.Fingerprint = ""
+	if err := mock.BackendServices().Update(ctx, key, bs); err != nil {
+		t.Errorf("Update(no fingerprint) = %v, want nil", err)
+	}
+
+	if err := mock.BackendServices().Update(ctx, meta.GlobalKey("missing"), bs); err == nil {
+		t.Errorf("Update(missing) = nil, want error")
+	}
+}
+
+func TestMockDefaultPatch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mock := NewMockGCE(&SingleProjectRouter{"proj"})
+
+	key := meta.GlobalKey("fw")
+	fw := &ga.Firewall{
+		Description: "desc",
+		Network:     "net",
+		Allowed:     []*ga.FirewallAllowed{{IPProtocol: "tcp", Ports: []string{"80"}}},
+	}
+	if err := mock.Firewalls().Insert(ctx, key, fw); err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+	patch := &alpha.Firewall{
+		Description: "patched",
+		Allowed:     []*alpha.FirewallAllowed{{IPProtocol: "udp"}},
+	}
+	if err := mock.AlphaFirewalls().Patch(ctx, key, patch); err != nil {
+		t.Fatalf("Patch() = %v, want nil", err)
+	}
+	got, _ := mock.Firewalls().Get(ctx, key)
+	want := &ga.Firewall{
+		Name:        "fw",
+		SelfLink:    SelfLink(meta.VersionGA, "proj", "firewalls", key),
+		Description: "patched",
+		Network:     "net",
+		Allowed:     []*ga.FirewallAllowed{{IPProtocol: "udp"}},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Patch(): -got,+want: %s", diff)
+	}
+}
+
+func TestMockDefaultSetLabels(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mock := NewMockGCE(&SingleProjectRouter{"proj"})
+	mock.EnableDefaults(NewMockDefaults())
+
+	key := meta.RegionalKey("fr", "us-central1")
+	if err := mock.ForwardingRules().Insert(ctx, key, &ga.ForwardingRule{Labels: map[string]string{"a": "1"}}); err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+	fr, _ := mock.ForwardingRules().Get(ctx, key)
+
+	req := &ga.RegionSetLabelsRequest{Labels: map[string]string{"b": "2"}, LabelFingerprint: fr.LabelFingerprint}
+	if err := mock.ForwardingRules().SetLabels(ctx, key, req); err != nil {
+		t.Fatalf("SetLabels() = %v, want nil", err)
+	}
+	got, _ := mock.ForwardingRules().Get(ctx, key)
+	if diff := cmp.Diff(got.Labels, map[string]string{"b": "2"}); diff != "" {
+		t.Errorf("Labels: -got,+want: %s", diff)
+	}
+	if got.LabelFingerprint == fr.LabelFingerprint || got.IPAddress != fr.IPAddress {
+		t.Errorf("SetLabels() = %+v, want new LabelFingerprint and unchanged IPAddress", got)
+	}
+
+	// The label fingerprint is required to match.
+	if err := mock.ForwardingRules().SetLabels(ctx, key, req); !isPreconditionFailed(err) {
+		t.Errorf("SetLabels(stale) = %v, want HTTP %d", err, http.StatusPreconditionFailed)
+	}
+}
+
+func TestMockDefaultUpdateWithHook(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mock := NewMockGCE(&SingleProjectRouter{"proj"})
+	mock.EnableOperations(NewMockOperations())
+	mock.EnableReferences(NewMockReferences())
+
+	for _, name := range []string{"bs1", "bs2"} {
+		if err := mock.BackendServices().Insert(ctx, meta.GlobalKey(name), &ga.BackendService{}); err != nil {
+			t.Fatalf("Insert(%s) = %v, want nil", name, err)
+		}
+	}
+	key := meta.GlobalKey("um")
+	if err := mock.UrlMaps().Insert(ctx, key, &ga.UrlMap{DefaultService: "global/backendServices/bs1"}); err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+	// The default implementation keeps the references up to date.
+	if err := mock.UrlMaps().Update(ctx, key, &ga.UrlMap{DefaultService: "global/backendServices/bs2"}); err != nil {
+		t.Fatalf("Update() = %v, want nil", err)
+	}
+	if err := mock.BackendServices().Delete(ctx, meta.GlobalKey("bs1")); err != nil {
+		t.Errorf("Delete(bs1) = %v, want nil", err)
+	}
+
+	// Hooks take precedence over the default implementation.
+	mock.MockUrlMaps.UpdateHook = func(context.Context, *meta.Key, *ga.UrlMap, *MockUrlMaps) error { return nil }
+	if err := mock.UrlMaps().Update(ctx, key, &ga.UrlMap{Description: "ignored"}); err != nil {
+		t.Fatalf("Update() = %v, want nil", err)
+	}
+	got, _ := mock.UrlMaps().Get(ctx, key)
+	if got.Description != "" {
+		t.Errorf("Description = %q, want \"\" (hook should have been called)", got.Description)
+	}
+}
@@ -18,26 +18,89 @@ package cloud
 
 import (
 	"context"
-	"fmt"
+	"time"
 )
 
 // CallObserver is called between the start and end of the operation.
+//
+// Observers can be added to a Service (Service.CallObservers) and to the
+// context of the calls (WithCallObserver()). The observers of the Service
+// are called first, followed by the observers in the context in the order
+// in which they were added.
+//
+// A CallObserver can also implement any of the optional interfaces
+// OperationObserver, RateLimitObserver, OperationStartObserver and
+// OperationPollObserver to receive more events.
 type CallObserver interface {
 	// Start event for a call to the API. This happens before the
 	// RateLimiter.Accept().
 	Start(ctx context.Context, key *RateLimitKey)
 
 	// End event for a call to the API. This happens after the
-	// operation is finished.
+	// operation is finished, or after RateLimiter.Accept() if it returns
+	// an error. For Insert, Delete and the <Method>Async variants, this
+	// happens when the long-running operation has been started (see
+	// OperationObserver). For the other methods that start an operation
+	// (e.g. SetLabels), this happens when the operation is done and err
+	// is the error of the operation.
 	End(ctx context.Context, key *RateLimitKey, err error)
 }
 
+// OperationObserver is an optional interface of a CallObserver. If the
+// CallObserver implements it, OperationEnd is called when Operation.Wait()
+// returns, i.e. also when the synchronous methods such as Insert() have
+// waited for their operation.
+type OperationObserver interface {
+	// OperationEnd event for a wait for the operation started by the call
+	// key. wait is the time spent in Operation.Wait() and err is the
+	// result of the wait. The Operation and Service of the key are empty
+	// for operations resumed with ResumeOperation().
+	OperationEnd(ctx context.Context, key *CallContextKey, wait time.Duration, err error)
+}
+
+// RateLimitObserver is an optional interface of a CallObserver. If the
+// CallObserver implements it, RateLimitEnd is called when
+// RateLimiter.Accept() returns for a call, including the calls that poll
+// operations.
+type RateLimitObserver interface {
+	// RateLimitEnd event for the call key. wait is the time spent in
+	// RateLimiter.Accept() and err is the error it returned.
+	RateLimitEnd(ctx context.Context, key *RateLimitKey, wait time.Duration, err error)
+}
+
+// OperationStartObserver is an optional interface of a CallObserver. If the
+// CallObserver implements it, OperationStart is called when a call has
+// started a long-running operation.
+type OperationStartObserver interface {
+	// OperationStart event for the operation ref, started by the call key.
+	// ref.Key.Name is the name of the operation.
+	OperationStart(ctx context.Context, key *CallContextKey, ref *OperationRef)
+}
+
+// OperationPollObserver is an optional interface of a CallObserver. If the
+// CallObserver implements it, OperationPoll is called each time an
+// operation has been polled.
+type OperationPollObserver interface {
+	// OperationPoll event for the operation ref. attempt is the number of
+	// the poll within the wait, starting at 1. done is true if the
+	// operation is done, with the result of the operation in err;
+	// otherwise err is the error of the poll, if any. With
+	// OperationModeBatch, the operations are polled together by the
+	// shared poller; a single event with attempt 0 is reported when the
+	// operation is found done.
+	OperationPoll(ctx context.Context, ref *OperationRef, attempt int, done bool, err error)
+}
+
 type contextKey string
 
 var callObserverContextKey = contextKey("call observer")
 
+// callObservers is the value stored in the context by WithCallObserver().
+type callObservers []CallObserver
+
 // WithCallObserver adds a CallObserver that will be called on the
-// operation being called.
+// operation being called. The observers already in ctx are also called,
+// i.e. WithCallObserver() can be used multiple times to stack observers.
 //
 //	type obs struct{}
 //	func (o *obs) Start(...) { fmt.Println("start") }
@@ -46,29 +109,70 @@ var callObserverContextKey = contextKey("call observer")
 //	ctx := WithCallObserver(ctx, &obs{})
 //	g.Addresses.Insert(ctx, ...)
 func WithCallObserver(ctx context.Context, obs CallObserver) context.Context {
-	return context.WithValue(ctx, callObserverContextKey, obs)
+	existing, _ := ctx.Value(callObserverContextKey).(callObservers)
+	// Copy so that the contexts derived from the same parent do not share
+	// the backing array.
+	list := make(callObservers, 0, len(existing)+1)
+	list = append(list, existing...)
+	list = append(list, obs)
+	return context.WithValue(ctx, callObserverContextKey, list)
 }
 
-func callObserverStart(ctx context.Context, key *CallContextKey) {
-	obj := ctx.Value(callObserverContextKey)
-	if obj == nil {
-		return
+// observe calls f for each observer of a call with ctx. s may be nil.
+func (s *Service) observe(ctx context.Context, f func(CallObserver)) {
+	if s != nil {
+		for _, o := range s.CallObservers {
+			f(o)
+		}
 	}
-	co, ok := obj.(CallObserver)
-	if !ok {
-		panic(fmt.Sprintf("expected CallObserver, got %T", obj))
+	list, _ := ctx.Value(callObserverContextKey).(callObservers)
+	for _, o := range list {
+		f(o)
 	}
-	co.Start(ctx, key)
 }
 
-func callObserverEnd(ctx context.Context, key *CallContextKey, err error) {
-	obj := ctx.Value(callObserverContextKey)
-	if obj == nil {
-		return
-	}
-	co, ok := obj.(CallObserver)
-	if !ok {
-		panic(fmt.Sprintf("expected CallObserver, got %T", obj))
-	}
-	co.End(ctx, key, err)
+func (s *Service) callObserverStart(ctx context.Context, key *CallContextKey) {
+	s.observe(ctx, func(o CallObserver) { o.Start(ctx, key) })
+}
+
+func (s *Service) callObserverEnd(ctx context.Context, key *CallContextKey, err error) {
+	s.observe(ctx, func(o CallObserver) { o.End(ctx, key, err) })
+}
+
+func (s *Service) callObserverOperationEnd(ctx context.Context, key *CallContextKey, wait time.Duration, err error) {
+	s.observe(ctx, func(o CallObserver) {
+		if oo, ok := o.(OperationObserver); ok {
+			oo.OperationEnd(ctx, key, wait, err)
+		}
+	})
+}
+
+func (s *Service) callObserverRateLimitEnd(ctx context.Context, key *RateLimitKey, wait time.Duration, err error) {
+	s.observe(ctx, func(o CallObserver) {
+		if ro, ok := o.(RateLimitObserver); ok {
+			ro.RateLimitEnd(ctx, key, wait, err)
+		}
+	})
+}
+
+func (s *Service) callObserverOperationStart(ctx context.Context, key *CallContextKey, ref *OperationRef) {
+	s.observe(ctx, func(o CallObserver) {
+		if oo, ok := o.(OperationStartObserver); ok {
+			oo.OperationStart(ctx, key, ref)
+		}
+	})
+}
+
+func (s *Service) callObserverOperationPoll(ctx context.Context, op operation, attempt int, done bool, err error) {
+	var ref *OperationRef
+	s.observe(ctx, func(o CallObserver) {
+		po, ok := o.(OperationPollObserver)
+		if !ok {
+			return
+		}
+		if ref == nil {
+			ref = operationRef(op)
+		}
+		po.OperationPoll(ctx, ref, attempt, done, err)
+	})
 }
@@ -20,6 +20,9 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 type fakeCO struct {
@@ -35,6 +38,8 @@ func (f *fakeCO) End(ctx context.Context, _ *CallContextKey, err error) {
 }
 
 func TestCallObserver(t *testing.T) {
+	t.Parallel()
+
 	errInjected := errors.New("injected")
 
 	for _, tc := range []struct {
@@ -44,14 +49,17 @@ func TestCallObserver(t *testing.T) {
 		{name: "no error", wantErr: nil},
 		{name: "err", wantErr: errInjected},
 	} {
+		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
 			ctx := context.Background()
 
 			obs := &fakeCO{}
 			ctx = WithCallObserver(ctx, obs)
 
-			callObserverStart(ctx, nil)
-			callObserverEnd(ctx, nil, tc.wantErr)
+			var s *Service
+			s.callObserverStart(ctx, nil)
+			s.callObserverEnd(ctx, nil, tc.wantErr)
 
 			if !obs.startCalled || !obs.endCalled {
 				t.Errorf("startCalled = %t, endCalled = %t; want true, true", obs.startCalled, obs.endCalled)
@@ -62,3 +70,54 @@ func TestCallObserver(t *testing.T) {
 		})
 	}
 }
+
+// namedCO records the events of all observers in events.
+type namedCO struct {
+	name   string
+	events *[]string
+}
+
+func (o *namedCO) Start(context.Context, *CallContextKey) {
+	*o.events = append(*o.events, o.name+".Start")
+}
+
+func (o *namedCO) End(context.Context, *CallContextKey, error) {
+	*o.events = append(*o.events, o.name+".End")
+}
+
+// rateLimitCO also implements RateLimitObserver.
+type rateLimitCO struct{ namedCO }
+
+func (o *rateLimitCO) RateLimitEnd(context.Context, *RateLimitKey, time.Duration, error) {
+	*o.events = append(*o.events, o.name+".RateLimitEnd")
+}
+
+func TestCallObserverOrder(t *testing.T) {
+	t.Parallel()
+
+	var events []string
+	s := &Service{
+		CallObservers: []CallObserver{
+			&namedCO{name: "svc1", events: &events},
+			&rateLimitCO{namedCO{name: "svc2", events: &events}},
+		},
+	}
+	parent := WithCallObserver(context.Background(), &namedCO{name: "ctx1", events: &events})
+	ctx := WithCallObserver(parent, &rateLimitCO{namedCO{name: "ctx2", events: &events}})
+	// Adding to the same parent does not change ctx.
+	WithCallObserver(parent, &namedCO{name: "other", events: &events})
+
+	key := &CallContextKey{}
+	s.callObserverStart(ctx, key)
+	s.callObserverRateLimitEnd(ctx, key, 0, nil)
+	s.callObserverEnd(ctx, key, nil)
+
+	want := []string{
+		"svc1.Start", "svc2.Start", "ctx1.Start", "ctx2.Start",
+		"svc2.RateLimitEnd", "ctx2.RateLimitEnd",
+		"svc1.End", "svc2.End", "ctx1.End", "ctx2.End",
+	}
+	if diff := cmp.Diff(events, want); diff != "" {
+		t.Errorf("events; -got,+want: %s", diff)
+	}
+}
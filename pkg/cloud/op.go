@@ -25,7 +25,6 @@ import (
 	alpha "google.golang.org/api/compute/v0.alpha"
 	beta "google.golang.org/api/compute/v0.beta"
 	ga "google.golang.org/api/compute/v1"
-	"google.golang.org/api/googleapi"
 
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 )
@@ -38,13 +37,18 @@ var (
 	// OperationsUseWait set to true to switch to using /Wait vs /Get. This should be a
 	// transparent change to the clients and this option will be removed once we have
 	// confidence that there are no issues with switching to the new method.
+	//
+	// This only applies to Services with OperationModeDefault. Prefer setting
+	// Service.OperationMode.
 	OperationsUseWait = true
 )
 
 // operation is a GCE operation that can be watied on.
 type operation interface {
-	// isDone queries GCE for the done status. This call can block.
-	isDone(ctx context.Context) (bool, error)
+	// isDone queries GCE for the done status. If wait is true, the
+	// operations Wait method is used, which blocks until the operation is
+	// done or a server-side timeout; otherwise the status is fetched with Get.
+	isDone(ctx context.Context, wait bool) (bool, error)
 	// error returns the resulting error of the operation. This may be nil if the operations
 	// was successful.
 	error() error
@@ -52,6 +56,12 @@ type operation interface {
 	// This rate limit will govern how fast the server will be polled for
 	// operation completion status.
 	rateLimitKey() *RateLimitKey
+	// id returns the project, API version and key of the operation. key is
+	// nil if the operation cannot be listed (it is then polled individually).
+	id() (projectID string, version meta.Version, key *meta.Key)
+	// setDone records the result of an operation that was found to be done
+	// by the operationPoller.
+	setDone(err error)
 }
 
 type gaOperation struct {
@@ -65,13 +75,13 @@ func (o *gaOperation) String() string {
 	return fmt.Sprintf("gaOperation{%q, %v}", o.projectID, o.key)
 }
 
-func (o *gaOperation) isDone(ctx context.Context) (bool, error) {
+func (o *gaOperation) isDone(ctx context.Context, wait bool) (bool, error) {
 	var (
 		op  *ga.Operation
 		err error
 	)
 
-	if OperationsUseWait {
+	if wait {
 		switch o.key.Type() {
 		case meta.Regional:
 			op, err = o.s.GA.RegionOperations.Wait(o.projectID, o.key.Region, o.key.Name).Context(ctx).Do()
@@ -108,10 +118,7 @@ func (o *gaOperation) isDone(ctx context.Context) (bool, error) {
 		return false, nil
 	}
 
-	if op.Error != nil && len(op.Error.Errors) > 0 && op.Error.Errors[0] != nil {
-		e := op.Error.Errors[0]
-		o.err = &googleapi.Error{Code: int(op.HttpErrorStatusCode), Message: fmt.Sprintf("%v - %v", e.Code, e.Message)}
-	}
+	o.err = gaOperationErr(op)
 	return true, nil
 }
 
@@ -121,6 +128,7 @@ func (o *gaOperation) rateLimitKey() *RateLimitKey {
 		Operation: "Get",
 		Service:   "Operations",
 		Version:   meta.VersionGA,
+		Key:       *o.key,
 	}
 }
 
@@ -128,6 +136,14 @@ func (o *gaOperation) error() error {
 	return o.err
 }
 
+func (o *gaOperation) id() (string, meta.Version, *meta.Key) {
+	return o.projectID, meta.VersionGA, o.key
+}
+
+func (o *gaOperation) setDone(err error) {
+	o.err = err
+}
+
 type alphaOperation struct {
 	s         *Service
 	projectID string
@@ -139,13 +155,13 @@ func (o *alphaOperation) String() string {
 	return fmt.Sprintf("alphaOperation{%q, %v}", o.projectID, o.key)
 }
 
-func (o *alphaOperation) isDone(ctx context.Context) (bool, error) {
+func (o *alphaOperation) isDone(ctx context.Context, wait bool) (bool, error) {
 	var (
 		op  *alpha.Operation
 		err error
 	)
 
-	if OperationsUseWait {
+	if wait {
 		switch o.key.Type() {
 		case meta.Regional:
 			op, err = o.s.Alpha.RegionOperations.Wait(o.projectID, o.key.Region, o.key.Name).Context(ctx).Do()
@@ -182,10 +198,7 @@ func (o *alphaOperation) isDone(ctx context.Context) (bool, error) {
 		return false, nil
 	}
 
-	if op.Error != nil && len(op.Error.Errors) > 0 && op.Error.Errors[0] != nil {
-		e := op.Error.Errors[0]
-		o.err = &googleapi.Error{Code: int(op.HttpErrorStatusCode), Message: fmt.Sprintf("%v - %v", e.Code, e.Message)}
-	}
+	o.err = alphaOperationErr(op)
 	return true, nil
 }
 
@@ -195,6 +208,7 @@ func (o *alphaOperation) rateLimitKey() *RateLimitKey {
 		Operation: "Get",
 		Service:   "Operations",
 		Version:   meta.VersionAlpha,
+		Key:       *o.key,
 	}
 }
 
@@ -202,6 +216,14 @@ func (o *alphaOperation) error() error {
 	return o.err
 }
 
+func (o *alphaOperation) id() (string, meta.Version, *meta.Key) {
+	return o.projectID, meta.VersionAlpha, o.key
+}
+
+func (o *alphaOperation) setDone(err error) {
+	o.err = err
+}
+
 type betaOperation struct {
 	s         *Service
 	projectID string
@@ -213,13 +235,13 @@ func (o *betaOperation) String() string {
 	return fmt.Sprintf("betaOperation{%q, %v}", o.projectID, o.key)
 }
 
-func (o *betaOperation) isDone(ctx context.Context) (bool, error) {
+func (o *betaOperation) isDone(ctx context.Context, wait bool) (bool, error) {
 	var (
 		op  *beta.Operation
 		err error
 	)
 
-	if OperationsUseWait {
+	if wait {
 		switch o.key.Type() {
 		case meta.Regional:
 			op, err = o.s.Beta.RegionOperations.Wait(o.projectID, o.key.Region, o.key.Name).Context(ctx).Do()
@@ -255,10 +277,7 @@ func (o *betaOperation) isDone(ctx context.Context) (bool, error) {
 		return false, nil
 	}
 
-	if op.Error != nil && len(op.Error.Errors) > 0 && op.Error.Errors[0] != nil {
-		e := op.Error.Errors[0]
-		o.err = &googleapi.Error{Code: int(op.HttpErrorStatusCode), Message: fmt.Sprintf("%v - %v", e.Code, e.Message)}
-	}
+	o.err = betaOperationErr(op)
 	return true, nil
 }
 
@@ -268,9 +287,18 @@ func (o *betaOperation) rateLimitKey() *RateLimitKey {
 		Operation: "Get",
 		Service:   "Operations",
 		Version:   meta.VersionBeta,
+		Key:       *o.key,
 	}
 }
 
 func (o *betaOperation) error() error {
 	return o.err
 }
+
+func (o *betaOperation) id() (string, meta.Version, *meta.Key) {
+	return o.projectID, meta.VersionBeta, o.key
+}
+
+func (o *betaOperation) setDone(err error) {
+	o.err = err
+}
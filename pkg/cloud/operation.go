@@ -0,0 +1,317 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opencensus.io/trace"
+	"k8s.io/klog/v2"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+)
+
+// Operation is a handle to a long-running operation started by one of the
+// asynchronous methods, e.g. InsertAsync(), DeleteAsync() or
+// SetTargetAsync(). The handle is safe for concurrent use.
+//
+//	var ops []Operation
+//	for _, key := range keys {
+//		op, err := gce.NetworkEndpointGroups().InsertAsync(ctx, key, neg)
+//		if err != nil {
+//			return err
+//		}
+//		ops = append(ops, op)
+//	}
+//	for _, op := range ops {
+//		if err := op.Wait(ctx); err != nil {
+//			return err
+//		}
+//	}
+type Operation interface {
+	// Wait until the operation is done or ctx is canceled. Returns the
+	// error of the operation (nil if it was successful) or the error that
+	// occurred while waiting.
+	Wait(ctx context.Context) error
+	// Done checks the status of the operation once without waiting. If it
+	// returns true, the result of the operation is available from Err().
+	Done(ctx context.Context) (bool, error)
+	// Err returns the error of the operation. This is nil if the operation
+	// was successful or has not completed yet.
+	Err() error
+	// ResourceID is the resource targeted by the operation.
+	ResourceID() *ResourceID
+	// Ref returns a serializable reference to the operation that can be
+	// used to resume waiting for the operation with ResumeOperation().
+	Ref() *OperationRef
+}
+
+// OperationRef identifies an operation. It can be serialized (e.g. to JSON)
+// and given to ResumeOperation() to continue waiting for the operation, for
+// example after a controller restart.
+type OperationRef struct {
+	// ProjectID of the operation.
+	ProjectID string `json:"projectID"`
+	// Version of the API that started the operation.
+	Version meta.Version `json:"version"`
+	// Key of the operation. Name is the name of the operation; Region and
+	// Zone give the scope of the operation, which is the same as the scope
+	// of the target resource.
+	Key meta.Key `json:"key"`
+	// Target is the resource targeted by the operation.
+	Target *ResourceID `json:"target"`
+}
+
+// ResumeOperation returns the handle for the operation referred to by ref.
+func (s *Service) ResumeOperation(ref *OperationRef) (Operation, error) {
+	key := ref.Key
+	if !key.Valid() {
+		return nil, fmt.Errorf("invalid operation key (%+v)", key)
+	}
+	var op operation
+	switch ref.Version {
+	case meta.VersionGA:
+		op = &gaOperation{s: s, projectID: ref.ProjectID, key: &key}
+	case meta.VersionAlpha:
+		op = &alphaOperation{s: s, projectID: ref.ProjectID, key: &key}
+	case meta.VersionBeta:
+		op = &betaOperation{s: s, projectID: ref.ProjectID, key: &key}
+	default:
+		return nil, fmt.Errorf("invalid operation version %q", ref.Version)
+	}
+	// The call that started the operation is not known.
+	ck := &CallContextKey{
+		ProjectID: ref.ProjectID,
+		Version:   ref.Version,
+		Mutation:  true,
+	}
+	if ref.Target != nil && ref.Target.Key != nil {
+		ck.Key = *ref.Target.Key
+	}
+	return &gceOperation{s: s, op: op, ref: *ref, ck: ck}, nil
+}
+
+// newOperation returns the handle for anyOp (one of the alpha, beta, ga
+// Operation types), which was started by the call ck for the resource
+// target.
+func (s *Service) newOperation(ctx context.Context, ck *CallContextKey, anyOp interface{}, target *ResourceID) (Operation, error) {
+	op, err := s.wrapOperation(anyOp)
+	if err != nil {
+		klog.Errorf("wrapOperation(%+v) error: %v", anyOp, err)
+		return nil, err
+	}
+	ref := OperationRef{Target: target}
+	switch o := op.(type) {
+	case *gaOperation:
+		ref.ProjectID, ref.Version, ref.Key = o.projectID, meta.VersionGA, *o.key
+	case *alphaOperation:
+		ref.ProjectID, ref.Version, ref.Key = o.projectID, meta.VersionAlpha, *o.key
+	case *betaOperation:
+		ref.ProjectID, ref.Version, ref.Key = o.projectID, meta.VersionBeta, *o.key
+	}
+	s.callObserverOperationStart(ctx, ck, &ref)
+	return &gceOperation{s: s, op: op, ref: ref, ck: ck}, nil
+}
+
+// syncCall is the state of a call made by a synchronous method that waits
+// for the operation it started, e.g. Insert() or SetLabels(). The span of
+// the call ends when the operation is done, i.e. it includes the wait for the
+// operation. If observeWait is set, the end of the call is also observed
+// (CallObserver.End() and RateLimiter.Observe()) when the operation is done,
+// with the error of the operation. The asynchronous methods (e.g.
+// InsertAsync()) use a nil *syncCall and end the call when the operation has
+// started.
+type syncCall struct {
+	observeWait bool
+
+	s   *Service
+	ctx context.Context
+	ck  *CallContextKey
+}
+
+// endCall ends the call ck that returned err. If sc is set and the call
+// started an operation, (part of) the end of the call is deferred to
+// sc.wait().
+func (s *Service) endCall(ctx context.Context, ck *CallContextKey, sc *syncCall, err error) {
+	deferred := sc != nil && err == nil
+	if deferred {
+		sc.s, sc.ctx, sc.ck = s, ctx, ck
+	}
+	if !deferred || !sc.observeWait {
+		s.callObserverEnd(ctx, ck, err)
+		s.RateLimiter.Observe(ctx, err, ck)
+	}
+	if !deferred {
+		endCallSpan(ctx, err)
+	}
+}
+
+// wait for op, which was returned with err by the call, and end the call.
+func (sc *syncCall) wait(op Operation, err error) error {
+	if sc.ck == nil {
+		// The call ended before the operation was started.
+		return err
+	}
+	if err == nil {
+		err = op.Wait(sc.ctx)
+	}
+	if sc.observeWait {
+		sc.s.callObserverEnd(sc.ctx, sc.ck, err)
+		sc.s.RateLimiter.Observe(sc.ctx, err, sc.ck)
+	}
+	endCallSpan(sc.ctx, err)
+	return err
+}
+
+// operationRef returns the reference to op.
+func operationRef(op operation) *OperationRef {
+	if o, ok := op.(*gceOperation); ok {
+		return o.Ref()
+	}
+	projectID, version, key := op.id()
+	ref := &OperationRef{ProjectID: projectID, Version: version}
+	if key != nil {
+		ref.Key = *key
+	}
+	return ref
+}
+
+// gceOperation implements Operation for the GCE API.
+type gceOperation struct {
+	s   *Service
+	op  operation
+	ref OperationRef
+	// ck is the key of the call that started the operation.
+	ck *CallContextKey
+
+	// pollLock serializes calls to op.isDone().
+	pollLock sync.Mutex
+
+	lock sync.Mutex
+	done bool
+	err  error
+}
+
+func (o *gceOperation) String() string {
+	return fmt.Sprintf("gceOperation{%v, %q, %v}", o.ref.Version, o.ref.ProjectID, o.ref.Key)
+}
+
+// isDone implements operation so that Wait() can use Service.pollOperation().
+func (o *gceOperation) isDone(ctx context.Context, wait bool) (bool, error) {
+	o.pollLock.Lock()
+	defer o.pollLock.Unlock()
+
+	done, err := o.op.isDone(ctx, wait)
+	if err != nil || !done {
+		return done, err
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.done = true
+	o.err = o.op.error()
+	return true, nil
+}
+
+func (o *gceOperation) error() error {
+	return o.Err()
+}
+
+func (o *gceOperation) rateLimitKey() *RateLimitKey {
+	return o.op.rateLimitKey()
+}
+
+func (o *gceOperation) id() (string, meta.Version, *meta.Key) {
+	return o.op.id()
+}
+
+func (o *gceOperation) setDone(err error) {
+	o.op.setDone(err)
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.done = true
+	o.err = err
+}
+
+// Wait implements Operation.
+func (o *gceOperation) Wait(ctx context.Context) error {
+	o.lock.Lock()
+	done, err := o.done, o.err
+	o.lock.Unlock()
+	if done {
+		return err
+	}
+	start := time.Now()
+	spanCtx, span := startSpan(ctx, SpanOperationWait)
+	span.AddAttributes(keyAttributes(o.ck)...)
+	span.AddAttributes(trace.StringAttribute("operationName", o.ref.Key.Name))
+	err = o.s.pollOperation(spanCtx, o)
+	endSpan(span, err)
+	o.s.callObserverOperationEnd(ctx, o.ck, time.Since(start), err)
+	return err
+}
+
+// Done implements Operation.
+func (o *gceOperation) Done(ctx context.Context) (bool, error) {
+	o.lock.Lock()
+	done := o.done
+	o.lock.Unlock()
+	if done {
+		return true, nil
+	}
+	ctx, span := startSpan(ctx, SpanOperationPoll)
+	span.AddAttributes(trace.StringAttribute("operationName", o.ref.Key.Name))
+	if err := o.s.acceptRateLimit(ctx, o.rateLimitKey()); err != nil {
+		endSpan(span, err)
+		return false, err
+	}
+	done, err := o.isDone(ctx, false)
+	o.s.RateLimiter.Observe(ctx, err, o.rateLimitKey())
+	endSpan(span, err)
+	if done {
+		o.s.callObserverOperationPoll(ctx, o, 1, true, o.Err())
+	} else {
+		o.s.callObserverOperationPoll(ctx, o, 1, false, err)
+	}
+	return done, err
+}
+
+// Err implements Operation.
+func (o *gceOperation) Err() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.err
+}
+
+// ResourceID implements Operation.
+func (o *gceOperation) ResourceID() *ResourceID {
+	return o.ref.Target
+}
+
+// Ref implements Operation.
+func (o *gceOperation) Ref() *OperationRef {
+	ret := o.ref
+	return &ret
+}
+
+// ResumeOperation returns the handle for the operation referred to by ref.
+func (gce *GCE) ResumeOperation(ref *OperationRef) (Operation, error) {
+	return gce.s.ResumeOperation(ref)
+}
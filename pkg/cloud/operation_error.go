@@ -0,0 +1,132 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"fmt"
+	"strings"
+
+	alpha "google.golang.org/api/compute/v0.alpha"
+	beta "google.golang.org/api/compute/v0.beta"
+	ga "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	"k8s.io/klog/v2"
+)
+
+// OperationError is the error of an operation that completed with errors,
+// e.g. as returned by WaitForCompletion() or Operation.Wait(). Alpha and beta
+// operations are converted to the GA types.
+//
+// OperationError wraps a *googleapi.Error, so errors.As(err, &gerr) with a
+// *googleapi.Error works the same way as for errors returned directly by
+// the API calls:
+//
+//	var opErr *OperationError
+//	if errors.As(err, &opErr) {
+//		for _, e := range opErr.Errors {
+//			// Check e.Code, e.ErrorDetails, ...
+//		}
+//	}
+type OperationError struct {
+	// Name of the operation.
+	Name string
+	// TargetLink is the URL of the resource targeted by the operation.
+	TargetLink string
+	// HTTPStatusCode of the operation, e.g. 400.
+	HTTPStatusCode int
+	// HTTPErrorMessage of the operation, e.g. "BAD REQUEST".
+	HTTPErrorMessage string
+	// Errors of the operation, including the error details (e.g. quota
+	// info).
+	Errors []*ga.OperationErrorErrors
+	// Warnings of the operation.
+	Warnings []*ga.OperationWarnings
+}
+
+// Error implements error.
+func (e *OperationError) Error() string {
+	var msgs []string
+	for _, item := range e.Errors {
+		msgs = append(msgs, fmt.Sprintf("%v - %v", item.Code, item.Message))
+	}
+	return fmt.Sprintf("operation %s on %s failed with HTTP %d: %s", e.Name, e.TargetLink, e.HTTPStatusCode, strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the error as a *googleapi.Error. The Message is taken from
+// the first error and there is an ErrorItem for each of the errors, with the
+// error code as the Reason.
+func (e *OperationError) Unwrap() error {
+	gerr := &googleapi.Error{Code: e.HTTPStatusCode}
+	for i, item := range e.Errors {
+		if i == 0 {
+			gerr.Message = fmt.Sprintf("%v - %v", item.Code, item.Message)
+		}
+		gerr.Errors = append(gerr.Errors, googleapi.ErrorItem{Reason: item.Code, Message: item.Message})
+	}
+	return gerr
+}
+
+// gaOperationErr returns the error for a completed operation, or nil if the
+// operation was successful.
+func gaOperationErr(op *ga.Operation) error {
+	if op.Error == nil {
+		return nil
+	}
+	ret := &OperationError{
+		Name:             op.Name,
+		TargetLink:       op.TargetLink,
+		HTTPStatusCode:   int(op.HttpErrorStatusCode),
+		HTTPErrorMessage: op.HttpErrorMessage,
+		Warnings:         op.Warnings,
+	}
+	for _, item := range op.Error.Errors {
+		if item != nil {
+			ret.Errors = append(ret.Errors, item)
+		}
+	}
+	if len(ret.Errors) == 0 {
+		return nil
+	}
+	return ret
+}
+
+// alphaOperationErr is the same as gaOperationErr() for alpha operations.
+func alphaOperationErr(op *alpha.Operation) error {
+	if op.Error == nil {
+		return nil
+	}
+	return operationErrViaJSON(op)
+}
+
+// betaOperationErr is the same as gaOperationErr() for beta operations.
+func betaOperationErr(op *beta.Operation) error {
+	if op.Error == nil {
+		return nil
+	}
+	return operationErrViaJSON(op)
+}
+
+// operationErrViaJSON converts anyOp to a GA operation to get the error.
+func operationErrViaJSON(anyOp interface{}) error {
+	op := &ga.Operation{}
+	if err := copyViaJSON(op, anyOp); err != nil {
+		// This should not happen as the operation was decoded from JSON.
+		klog.Errorf("Could not convert %T to *ga.Operation via JSON: %v", anyOp, err)
+		return err
+	}
+	return gaOperationErr(op)
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	alpha "google.golang.org/api/compute/v0.alpha"
+	ga "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestOperationErr(t *testing.T) {
+	t.Parallel()
+
+	quotaErr := &ga.OperationErrorErrors{
+		Code:    "QUOTA_EXCEEDED",
+		Message: "Quota 'CPUS' exceeded.",
+		ErrorDetails: []*ga.OperationErrorErrorsErrorDetails{{
+			QuotaInfo: &ga.QuotaExceededInfo{MetricName: "compute.googleapis.com/cpus", Limit: 24},
+		}},
+	}
+	otherErr := &ga.OperationErrorErrors{Code: "RESOURCE_NOT_READY", Location: "zones/us-central1-b", Message: "not ready"}
+	warning := &ga.OperationWarnings{Code: "NO_RESULTS_ON_PAGE", Message: "warning"}
+
+	for _, tc := range []struct {
+		name      string
+		op        *ga.Operation
+		want      *OperationError
+		wantGAErr *googleapi.Error
+	}{
+		{
+			name: "no error",
+			op:   &ga.Operation{Name: "op", Status: operationStatusDone},
+		},
+		{
+			name: "empty errors",
+			op:   &ga.Operation{Name: "op", Error: &ga.OperationError{Errors: []*ga.OperationErrorErrors{nil}}},
+		},
+		{
+			name: "all errors and warnings",
+			op: &ga.Operation{
+				Name:                "op",
+				TargetLink:          "https://www.googleapis.com/compute/v1/projects/p/zones/us-central1-b/instances/i",
+				HttpErrorStatusCode: http.StatusForbidden,
+				HttpErrorMessage:    "FORBIDDEN",
+				Error:               &ga.OperationError{Errors: []*ga.OperationErrorErrors{quotaErr, otherErr}},
+				Warnings:            []*ga.OperationWarnings{warning},
+			},
+			want: &OperationError{
+				Name:             "op",
+				TargetLink:       "https://www.googleapis.com/compute/v1/projects/p/zones/us-central1-b/instances/i",
+				HTTPStatusCode:   http.StatusForbidden,
+				HTTPErrorMessage: "FORBIDDEN",
+				Errors:           []*ga.OperationErrorErrors{quotaErr, otherErr},
+				Warnings:         []*ga.OperationWarnings{warning},
+			},
+			wantGAErr: &googleapi.Error{
+				Code:    http.StatusForbidden,
+				Message: "QUOTA_EXCEEDED - Quota 'CPUS' exceeded.",
+				Errors: []googleapi.ErrorItem{
+					{Reason: "QUOTA_EXCEEDED", Message: "Quota 'CPUS' exceeded."},
+					{Reason: "RESOURCE_NOT_READY", Message: "not ready"},
+				},
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := gaOperationErr(tc.op)
+			if tc.want == nil {
+				if err != nil {
+					t.Fatalf("gaOperationErr() = %v, want nil", err)
+				}
+				return
+			}
+			var opErr *OperationError
+			if !errors.As(err, &opErr) {
+				t.Fatalf("gaOperationErr() = %v, want *OperationError", err)
+			}
+			if diff := cmp.Diff(opErr, tc.want); diff != "" {
+				t.Errorf("gaOperationErr() diff -got,+want: %s", diff)
+			}
+			var gerr *googleapi.Error
+			if !errors.As(err, &gerr) {
+				t.Fatalf("errors.As(%v, *googleapi.Error) = false, want true", err)
+			}
+			if diff := cmp.Diff(gerr, tc.wantGAErr, cmpopts.IgnoreUnexported(googleapi.Error{})); diff != "" {
+				t.Errorf("googleapi.Error diff -got,+want: %s", diff)
+			}
+
+			// Alpha operations result in the same error.
+			alphaOp := &alpha.Operation{}
+			if err := copyViaJSON(alphaOp, tc.op); err != nil {
+				t.Fatalf("copyViaJSON() = %v", err)
+			}
+			if diff := cmp.Diff(alphaOperationErr(alphaOp), err); diff != "" {
+				t.Errorf("alphaOperationErr() diff -got,+want: %s", diff)
+			}
+		})
+	}
+}
+
+func TestOperationErrorMock(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mock := NewMockGCE(&SingleProjectRouter{"proj"})
+	ops := NewMockOperations()
+	mock.EnableOperations(ops)
+
+	key := meta.GlobalKey("net")
+	ops.Errors[MockOperationKey{Service: "Networks", Method: "Insert", Key: *key}] = &MockOperationError{
+		HTTPStatusCode: http.StatusBadRequest,
+		Code:           "INVALID_USAGE",
+		Message:        "bad",
+	}
+	err := mock.Networks().Insert(ctx, key, &ga.Network{})
+	var opErr *OperationError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("Insert() = %v, want *OperationError", err)
+	}
+	if want := SelfLink(meta.VersionGA, "proj", "networks", key); opErr.TargetLink != want {
+		t.Errorf("TargetLink = %q, want %q", opErr.TargetLink, want)
+	}
+	if opErr.Name == "" || opErr.HTTPStatusCode != http.StatusBadRequest || opErr.HTTPErrorMessage != "BAD REQUEST" {
+		t.Errorf("Insert() = %+v, want named operation with HTTP 400 BAD REQUEST", opErr)
+	}
+	if want := "operation " + opErr.Name + " on " + opErr.TargetLink + " failed with HTTP 400: INVALID_USAGE - bad"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/api/iterator"
+)
+
+// ErrStopPaging can be returned by the callback of the ListPages methods
+// (e.g. ListPages(), AggregatedListPages()) to stop fetching pages. The
+// ListPages method returns nil in this case.
+var ErrStopPaging = errors.New("stop paging")
+
+// ListOptions are options for the paged List methods.
+type ListOptions struct {
+	// MaxResults is the maximum number of items in a page. If zero, the
+	// server default is used (500 for GCE).
+	MaxResults int64
+}
+
+func (o *ListOptions) maxResults() int64 {
+	if o == nil {
+		return 0
+	}
+	return o.MaxResults
+}
+
+// pageFetcher fetches the page for pageToken ("" for the first page). It
+// returns the items in the page and the token of the next page ("" if there
+// are no more pages).
+type pageFetcher[P any] func(ctx context.Context, pageToken string) (P, string, error)
+
+// PageIterator iterates over the pages of a List call. Only a single page is
+// fetched for each call to Next(), i.e. the results of the List are never
+// held in memory all at once. P is the type of the page, e.g.
+// []*ga.Firewall.
+//
+//	it := gce.Firewalls().ListIterator(ctx, filter.None, &ListOptions{MaxResults: 100})
+//	for {
+//		page, err := it.Next()
+//		if err == iterator.Done {
+//			break
+//		}
+//		if err != nil {
+//			return err
+//		}
+//		// Process page.
+//	}
+type PageIterator[P any] struct {
+	ctx   context.Context
+	fetch pageFetcher[P]
+	token string
+	done  bool
+}
+
+func newPageIterator[P any](ctx context.Context, fetch pageFetcher[P]) *PageIterator[P] {
+	return &PageIterator[P]{ctx: ctx, fetch: fetch}
+}
+
+// Next returns the next page. iterator.Done is returned if there are no
+// more pages. If an error is returned while fetching a page, the page can be
+// retried by calling Next() again.
+func (it *PageIterator[P]) Next() (P, error) {
+	var zero P
+	if it.done {
+		return zero, iterator.Done
+	}
+	if err := it.ctx.Err(); err != nil {
+		return zero, err
+	}
+	page, next, err := it.fetch(it.ctx, it.token)
+	if err != nil {
+		return zero, err
+	}
+	it.token = next
+	it.done = next == ""
+	return page, nil
+}
+
+// listPages calls f for each page returned by it. If f returns
+// ErrStopPaging, no more pages are fetched and nil is returned.
+func listPages[P any](it *PageIterator[P], f func(P) error) error {
+	for {
+		page, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := f(page); err != nil {
+			if err == ErrStopPaging {
+				return nil
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"testing"
+
+	alpha "google.golang.org/api/compute/v0.alpha"
+	ga "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMockListPages(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mock := NewMockGCE(&SingleProjectRouter{"proj"})
+	for i := 0; i < 5; i++ {
+		key := meta.RegionalKey(fmt.Sprintf("addr-%d", i), "us-central1")
+		if err := mock.Addresses().Insert(ctx, key, &ga.Address{}); err != nil {
+			t.Fatalf("Insert(%v) = %v, want nil", key, err)
+		}
+	}
+	if err := mock.Addresses().Insert(ctx, meta.RegionalKey("other", "us-east1"), &ga.Address{}); err != nil {
+		t.Fatalf("Insert() = %v, want nil", err)
+	}
+
+	for _, tc := range []struct {
+		name      string
+		fl        *filter.F
+		opts      *ListOptions
+		stopAfter int
+		wantSizes []int
+	}{
+		{name: "default page size", fl: filter.None, wantSizes: []int{5}},
+		{name: "max results", fl: filter.None, opts: &ListOptions{MaxResults: 2}, wantSizes: []int{2, 2, 1}},
+		{name: "exact pages", fl: filter.None, opts: &ListOptions{MaxResults: 5}, wantSizes: []int{5}},
+		{name: "filter", fl: filter.Regexp("name", "addr-[0-2]"), opts: &ListOptions{MaxResults: 2}, wantSizes: []int{2, 1}},
+		{name: "no results", fl: filter.Regexp("name", "none"), wantSizes: []int{0}},
+		{name: "stop", fl: filter.None, opts: &ListOptions{MaxResults: 2}, stopAfter: 2, wantSizes: []int{2, 2}},
+	} {
+		var sizes []int
+		var names []string
+		err := mock.Addresses().ListPages(ctx, "us-central1", tc.fl, tc.opts, func(page []*ga.Address) error {
+			sizes = append(sizes, len(page))
+			for _, a := range page {
+				names = append(names, a.Name)
+			}
+			if len(sizes) == tc.stopAfter {
+				return ErrStopPaging
+			}
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: ListPages() = %v, want nil", tc.name, err)
+			continue
+		}
+		if diff := cmp.Diff(sizes, tc.wantSizes); diff != "" {
+			t.Errorf("%s: page sizes: -got,+want: %s", tc.name, diff)
+		}
+		// Pages do not overlap.
+		sort.Strings(names)
+		for i := 1; i < len(names); i++ {
+			if names[i] == names[i-1] {
+				t.Errorf("%s: %q returned more than once", tc.name, names[i])
+			}
+		}
+	}
+
+	// Errors returned by the callback are returned by ListPages.
+	errTest := errors.New("test")
+	if err := mock.Addresses().ListPages(ctx, "us-central1", filter.None, nil, func([]*ga.Address) error { return errTest }); err != errTest {
+		t.Errorf("ListPages() = %v, want %v", err, errTest)
+	}
+	// Errors from List are returned.
+	var listErr error = &googleapi.Error{Code: http.StatusInternalServerError}
+	mock.MockAddresses.ListError = &listErr
+	if err := mock.Addresses().ListPages(ctx, "us-central1", filter.None, nil, func([]*ga.Address) error { return nil }); err == nil {
+		t.Errorf("ListPages() = nil, want error")
+	}
+}
+
+func TestMockListIterator(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mock := NewMockGCE(&SingleProjectRouter{"proj"})
+	for i := 0; i < 3; i++ {
+		if err := mock.Firewalls().Insert(ctx, meta.GlobalKey(fmt.Sprintf("fw-%d", i)), &ga.Firewall{}); err != nil {
+			t.Fatalf("Insert() = %v, want nil", err)
+		}
+	}
+
+	it := mock.Firewalls().ListIterator(ctx, filter.None, &ListOptions{MaxResults: 2})
+	var total int
+	for {
+		page, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() = %v, want nil", err)
+		}
+		total += len(page)
+	}
+	if total != 3 {
+		t.Errorf("got %d items, want 3", total)
+	}
+	if _, err := it.Next(); err != iterator.Done {
+		t.Errorf("Next() = %v, want iterator.Done", err)
+	}
+
+	// The iterator stops when the context is canceled.
+	it = mock.Firewalls().ListIterator(ctx, filter.None, &ListOptions{MaxResults: 2})
+	if _, err := it.Next(); err != nil {
+		t.Fatalf("Next() = %v, want nil", err)
+	}
+	cancel()
+	if _, err := it.Next(); err != context.Canceled {
+		t.Errorf("Next() = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestMockAggregatedListPages(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mock := NewMockGCE(&SingleProjectRouter{"proj"})
+	for _, key := range []*meta.Key{
+		meta.RegionalKey("a", "us-central1"),
+		meta.RegionalKey("b", "us-central1"),
+		meta.RegionalKey("c", "us-east1"),
+	} {
+		if err := mock.Addresses().Insert(ctx, key, &ga.Address{}); err != nil {
+			t.Fatalf("Insert(%v) = %v, want nil", key, err)
+		}
+	}
+
+	var pages []map[string]int
+	err := mock.AlphaAddresses().AggregatedListPages(ctx, filter.None, &ListOptions{MaxResults: 2}, func(page map[string][]*alpha.Address) error {
+		counts := map[string]int{}
+		for k, v := range page {
+			counts[k] = len(v)
+		}
+		pages = append(pages, counts)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("AggregatedListPages() = %v, want nil", err)
+	}
+	want := []map[string]int{{"regions/us-central1": 2}, {"regions/us-east1": 1}}
+	if diff := cmp.Diff(pages, want); diff != "" {
+		t.Errorf("AggregatedListPages(): -got,+want: %s", diff)
+	}
+}
+
+func TestMockPageToken(t *testing.T) {
+	t.Parallel()
+
+	it := newMockPageIterator(context.Background(), &ListOptions{MaxResults: 1}, func() ([]int, error) { return []int{1, 2, 3}, nil })
+	if _, _, err := it.fetch(context.Background(), ""); err != nil {
+		t.Fatalf("fetch() = %v, want nil", err)
+	}
+	for _, tc := range []struct {
+		token   string
+		want    []int
+		wantErr bool
+	}{
+		{token: "1", want: []int{2}},
+		{token: "2", want: []int{3}},
+		{token: "3", wantErr: true},
+		{token: "0", wantErr: true},
+		{token: "abc", wantErr: true},
+	} {
+		got, _, err := it.fetch(context.Background(), tc.token)
+		if gotErr := err != nil; gotErr != tc.wantErr {
+			t.Errorf("fetch(%q) = %v, %v; gotErr = %t, want %t", tc.token, got, err, gotErr, tc.wantErr)
+			continue
+		}
+		if diff := cmp.Diff(got, tc.want); err == nil && diff != "" {
+			t.Errorf("fetch(%q): -got,+want: %s", tc.token, diff)
+		}
+	}
+}
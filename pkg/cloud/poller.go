@@ -0,0 +1,352 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opencensus.io/trace"
+	alpha "google.golang.org/api/compute/v0.alpha"
+	beta "google.golang.org/api/compute/v0.beta"
+	ga "google.golang.org/api/compute/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+)
+
+// OperationMode selects how a Service waits for operations to complete.
+type OperationMode int
+
+const (
+	// OperationModeDefault uses OperationModeWait if the OperationsUseWait
+	// variable is true and OperationModeGet otherwise.
+	OperationModeDefault OperationMode = iota
+	// OperationModeWait polls each operation separately with
+	// {Global,Region,Zone}Operations.Wait, which returns when the operation
+	// is done or after a server-side timeout.
+	OperationModeWait
+	// OperationModeGet polls each operation separately with
+	// {Global,Region,Zone}Operations.Get.
+	OperationModeGet
+	// OperationModeBatch polls the pending operations in the same project
+	// and scope (global, region or zone) together, with a filtered
+	// {Global,Region,Zone}Operations.List call every
+	// OperationPollerConfig.Interval. This uses far fewer calls (and rate
+	// limit tokens) than polling each operation when many operations are in
+	// flight at the same time. Operations that take longer than
+	// OperationPollerConfig.StragglerTimeout or that are not returned by the
+	// List are polled separately with Wait.
+	OperationModeBatch
+)
+
+const (
+	defaultPollerInterval         = time.Second
+	defaultPollerStragglerTimeout = 5 * time.Minute
+	defaultPollerMaxBatchSize     = 50
+
+	// pollerListTimeout is the timeout for a single List call by the poller.
+	pollerListTimeout = time.Minute
+)
+
+// OperationPollerConfig configures the poller for OperationModeBatch. Zero
+// values select the defaults.
+type OperationPollerConfig struct {
+	// Interval between the List calls for a scope. Default: 1s.
+	Interval time.Duration
+	// StragglerTimeout is how long an operation is polled in a batch before
+	// it is polled separately. Default: 5m.
+	StragglerTimeout time.Duration
+	// MaxBatchSize is the maximum number of operations queried in a single
+	// List call. Default: 50.
+	MaxBatchSize int
+}
+
+// pollScope is the set of operations that can be returned by a single List
+// call. region and zone are both empty for global operations.
+type pollScope struct {
+	projectID string
+	version   meta.Version
+	region    string
+	zone      string
+}
+
+// pollWaiter is an operation waiting for the poller.
+type pollWaiter struct {
+	name string
+	// done is closed when the poller is done with the operation. found and
+	// err are valid after done is closed.
+	done chan struct{}
+	// found is false if the operation was not returned by the List.
+	found bool
+	// err is the error of the operation.
+	err error
+}
+
+// pollResult is the state of an operation returned by a List call.
+type pollResult struct {
+	done bool
+	err  error
+}
+
+// operationPoller polls operations in batches for OperationModeBatch. A
+// goroutine runs for each scope that has pending operations; it exits when
+// there are no more operations to wait for.
+type operationPoller struct {
+	s   *Service
+	cfg OperationPollerConfig
+
+	lock    sync.Mutex
+	waiters map[pollScope]map[*pollWaiter]bool
+}
+
+func newOperationPoller(s *Service, cfg OperationPollerConfig) *operationPoller {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultPollerInterval
+	}
+	if cfg.StragglerTimeout <= 0 {
+		cfg.StragglerTimeout = defaultPollerStragglerTimeout
+	}
+	if cfg.MaxBatchSize <= 0 {
+		cfg.MaxBatchSize = defaultPollerMaxBatchSize
+	}
+	return &operationPoller{
+		s:       s,
+		cfg:     cfg,
+		waiters: map[pollScope]map[*pollWaiter]bool{},
+	}
+}
+
+// wait for op to complete. Returns the error of the operation or the error
+// that occurred while waiting.
+func (p *operationPoller) wait(ctx context.Context, op operation) error {
+	projectID, version, key := op.id()
+	if key == nil {
+		return p.s.pollSingleOperation(ctx, op, true)
+	}
+	scope := pollScope{projectID: projectID, version: version, region: key.Region, zone: key.Zone}
+	w := &pollWaiter{name: key.Name, done: make(chan struct{})}
+	p.add(scope, w)
+	defer p.remove(scope, w)
+
+	// The List calls are made by the poller goroutine; this span covers the
+	// time waiting for them.
+	_, span := startSpan(ctx, SpanOperationPoll)
+	span.AddAttributes(trace.BoolAttribute("batched", true))
+
+	timer := time.NewTimer(p.cfg.StragglerTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		endSpan(span, ctx.Err())
+		return ctx.Err()
+	case <-w.done:
+		if w.found {
+			klog.V(5).Infof("operationPoller: %v done, err = %v", op, w.err)
+			endSpan(span, w.err)
+			op.setDone(w.err)
+			p.s.callObserverOperationPoll(ctx, op, 0, true, w.err)
+			return w.err
+		}
+		klog.V(4).Infof("operationPoller: %v was not listed, polling separately", op)
+	case <-timer.C:
+		klog.V(4).Infof("operationPoller: %v not done after %v, polling separately", op, p.cfg.StragglerTimeout)
+	}
+	span.End()
+	return p.s.pollSingleOperation(ctx, op, true)
+}
+
+func (p *operationPoller) add(scope pollScope, w *pollWaiter) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	ws, ok := p.waiters[scope]
+	if !ok {
+		ws = map[*pollWaiter]bool{}
+		p.waiters[scope] = ws
+		go p.run(scope)
+	}
+	ws[w] = true
+}
+
+func (p *operationPoller) remove(scope pollScope, w *pollWaiter) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if ws, ok := p.waiters[scope]; ok {
+		delete(ws, w)
+	}
+}
+
+// run polls the operations in scope until there are none left.
+func (p *operationPoller) run(scope pollScope) {
+	klog.V(5).Infof("operationPoller: started polling %+v", scope)
+
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		p.lock.Lock()
+		ws := p.waiters[scope]
+		if len(ws) == 0 {
+			delete(p.waiters, scope)
+			p.lock.Unlock()
+			klog.V(5).Infof("operationPoller: stopped polling %+v", scope)
+			return
+		}
+		var pending []*pollWaiter
+		for w := range ws {
+			pending = append(pending, w)
+		}
+		p.lock.Unlock()
+
+		p.poll(scope, pending)
+	}
+}
+
+// poll lists the pending operations in batches and signals the waiters for
+// the operations that are done or were not found. If a List call fails, the
+// operations are polled again in the next interval.
+func (p *operationPoller) poll(scope pollScope, pending []*pollWaiter) {
+	byName := map[string][]*pollWaiter{}
+	for _, w := range pending {
+		byName[w.name] = append(byName[w.name], w)
+	}
+	var names []string
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for len(names) > 0 {
+		n := len(names)
+		if n > p.cfg.MaxBatchSize {
+			n = p.cfg.MaxBatchSize
+		}
+		batch := names[:n]
+		names = names[n:]
+
+		results, err := p.list(scope, batch)
+		if err != nil {
+			klog.V(4).Infof("operationPoller: list(%+v, %v) = %v, retrying", scope, batch, err)
+			continue
+		}
+
+		p.lock.Lock()
+		for _, name := range batch {
+			res, found := results[name]
+			if found && !res.done {
+				continue
+			}
+			for _, w := range byName[name] {
+				w.found, w.err = found, res.err
+				delete(p.waiters[scope], w)
+				close(w.done)
+			}
+		}
+		p.lock.Unlock()
+	}
+}
+
+// list returns the state of the named operations in scope.
+func (p *operationPoller) list(scope pollScope, names []string) (map[string]pollResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pollerListTimeout)
+	defer cancel()
+
+	rlk := &RateLimitKey{
+		ProjectID: scope.projectID,
+		Operation: "List",
+		Service:   "Operations",
+		Version:   scope.version,
+		Key:       meta.Key{Region: scope.region, Zone: scope.zone},
+	}
+	if err := p.s.acceptRateLimit(ctx, rlk); err != nil {
+		return nil, err
+	}
+
+	var quoted []string
+	for _, name := range names {
+		quoted = append(quoted, regexp.QuoteMeta(name))
+	}
+	fl := filter.Regexp("name", strings.Join(quoted, "|")).String()
+
+	ret := map[string]pollResult{}
+	var err error
+	switch scope.version {
+	case meta.VersionGA:
+		f := func(l *ga.OperationList) error {
+			for _, op := range l.Items {
+				ret[op.Name] = pollResult{done: op.Status == operationStatusDone, err: gaOperationErr(op)}
+			}
+			return nil
+		}
+		switch {
+		case scope.zone != "":
+			err = p.s.GA.ZoneOperations.List(scope.projectID, scope.zone).Filter(fl).Pages(ctx, f)
+		case scope.region != "":
+			err = p.s.GA.RegionOperations.List(scope.projectID, scope.region).Filter(fl).Pages(ctx, f)
+		default:
+			err = p.s.GA.GlobalOperations.List(scope.projectID).Filter(fl).Pages(ctx, f)
+		}
+	case meta.VersionAlpha:
+		f := func(l *alpha.OperationList) error {
+			for _, op := range l.Items {
+				ret[op.Name] = pollResult{done: op.Status == operationStatusDone, err: alphaOperationErr(op)}
+			}
+			return nil
+		}
+		switch {
+		case scope.zone != "":
+			err = p.s.Alpha.ZoneOperations.List(scope.projectID, scope.zone).Filter(fl).Pages(ctx, f)
+		case scope.region != "":
+			err = p.s.Alpha.RegionOperations.List(scope.projectID, scope.region).Filter(fl).Pages(ctx, f)
+		default:
+			err = p.s.Alpha.GlobalOperations.List(scope.projectID).Filter(fl).Pages(ctx, f)
+		}
+	case meta.VersionBeta:
+		f := func(l *beta.OperationList) error {
+			for _, op := range l.Items {
+				ret[op.Name] = pollResult{done: op.Status == operationStatusDone, err: betaOperationErr(op)}
+			}
+			return nil
+		}
+		switch {
+		case scope.zone != "":
+			err = p.s.Beta.ZoneOperations.List(scope.projectID, scope.zone).Filter(fl).Pages(ctx, f)
+		case scope.region != "":
+			err = p.s.Beta.RegionOperations.List(scope.projectID, scope.region).Filter(fl).Pages(ctx, f)
+		default:
+			err = p.s.Beta.GlobalOperations.List(scope.projectID).Filter(fl).Pages(ctx, f)
+		}
+	default:
+		err = fmt.Errorf("invalid operation version %q", scope.version)
+	}
+	p.s.RateLimiter.Observe(ctx, err, rlk)
+	klog.V(5).Infof("operationPoller: list(%+v, %d operations) = [%d items], %v", scope, len(names), len(ret), err)
+
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
@@ -18,8 +18,14 @@ package cloud
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 )
 
 type FakeAcceptor struct{ accept func() }
@@ -78,3 +84,332 @@ func TestMinimumRateLimiter(t *testing.T) {
 		t.Errorf("`called` = true, want false")
 	}
 }
+
+// fakeClock is a clock that only advances when Advance() is called.
+type fakeClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	timers map[*fakeTimer]bool
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), timers: map[*fakeTimer]bool{}}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) clockTimer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	t := &fakeTimer{c: c, at: c.now.Add(d), ch: make(chan time.Time, 1)}
+	c.timers[t] = true
+	return t
+}
+
+// Advance the clock by d, firing the timers that expire.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+	for t := range c.timers {
+		if !t.at.After(c.now) {
+			t.ch <- c.now
+			delete(c.timers, t)
+		}
+	}
+}
+
+// pendingTimers returns the number of timers that have not fired or been
+// stopped.
+func (c *fakeClock) pendingTimers() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.timers)
+}
+
+// WaitForTimers waits until there are n pending timers.
+func (c *fakeClock) WaitForTimers(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		got := c.pendingTimers()
+		if got == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d timers (got %d)", n, got)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type fakeTimer struct {
+	c  *fakeClock
+	at time.Time
+	ch chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTimer) Stop() bool {
+	t.c.lock.Lock()
+	defer t.c.lock.Unlock()
+	ok := t.c.timers[t]
+	delete(t.c.timers, t)
+	return ok
+}
+
+func newTestTokenBucketRateLimiter(t *testing.T, rules ...TokenBucketRule) (*TokenBucketRateLimiter, *fakeClock) {
+	t.Helper()
+	rl, err := NewTokenBucketRateLimiter(rules...)
+	if err != nil {
+		t.Fatalf("NewTokenBucketRateLimiter() = %v, want nil", err)
+	}
+	fc := newFakeClock()
+	rl.clock = fc
+	return rl, fc
+}
+
+func TestNewTokenBucketRateLimiter(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		rule    TokenBucketRule
+		wantErr bool
+	}{
+		{name: "default", rule: TokenBucketRule{QPS: 1, Burst: 1}},
+		{name: "unlimited", rule: TokenBucketRule{Key: CallContextKey{ProjectID: "p*"}}},
+		{name: "pattern", rule: TokenBucketRule{Key: CallContextKey{Operation: "List*", Service: "[A-Z]*"}, QPS: 1, Burst: 1}},
+		{name: "bad pattern", rule: TokenBucketRule{Key: CallContextKey{Service: "[a-"}, QPS: 1, Burst: 1}, wantErr: true},
+		{name: "negative QPS", rule: TokenBucketRule{QPS: -1, Burst: 1}, wantErr: true},
+		{name: "zero burst", rule: TokenBucketRule{QPS: 1}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewTokenBucketRateLimiter(tc.rule)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("NewTokenBucketRateLimiter(%+v) = %v; gotErr = %t, want %t", tc.rule, err, gotErr, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestTokenBucketRateLimiterBurst(t *testing.T) {
+	rl, fc := newTestTokenBucketRateLimiter(t, TokenBucketRule{QPS: 2, Burst: 3})
+	ctx := context.Background()
+	key := &CallContextKey{ProjectID: "proj", Operation: "Get", Version: "ga", Service: "Addresses"}
+
+	for i := 0; i < 3; i++ {
+		if err := rl.Accept(ctx, key); err != nil {
+			t.Fatalf("Accept() = %v, want nil", err)
+		}
+	}
+
+	done := make(chan error)
+	go func() { done <- rl.Accept(ctx, key) }()
+	fc.WaitForTimers(t, 1)
+	if got := rl.QueueDepth(key); got != 1 {
+		t.Errorf("QueueDepth() = %d, want 1", got)
+	}
+	if diff := cmp.Diff(rl.QueueDepths(), map[CallContextKey]int{*key: 1}); diff != "" {
+		t.Errorf("QueueDepths(); -got,+want: %s", diff)
+	}
+
+	// The next token is available after 1/QPS.
+	fc.Advance(400 * time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("Accept() = %v before the token was available", err)
+	default:
+	}
+	fc.Advance(100 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Errorf("Accept() = %v, want nil", err)
+	}
+	if got := rl.QueueDepth(key); got != 0 {
+		t.Errorf("QueueDepth() = %d, want 0", got)
+	}
+
+	// The bucket refills up to Burst.
+	fc.Advance(time.Minute)
+	for i := 0; i < 3; i++ {
+		if err := rl.Accept(ctx, key); err != nil {
+			t.Fatalf("Accept() = %v, want nil", err)
+		}
+	}
+	fc.WaitForTimers(t, 0)
+}
+
+func TestTokenBucketRateLimiterQueueDepthNoBucket(t *testing.T) {
+	rl, _ := newTestTokenBucketRateLimiter(t, TokenBucketRule{QPS: 1, Burst: 1})
+	for i := 0; i < 10; i++ {
+		key := &CallContextKey{ProjectID: fmt.Sprintf("proj-%d", i)}
+		if got := rl.QueueDepth(key); got != 0 {
+			t.Errorf("QueueDepth(%+v) = %d, want 0", key, got)
+		}
+	}
+	if got := len(rl.buckets); got != 0 {
+		t.Errorf("len(buckets) = %d after QueueDepth(), want 0", got)
+	}
+}
+
+func TestTokenBucketRateLimiterCancel(t *testing.T) {
+	rl, fc := newTestTokenBucketRateLimiter(t, TokenBucketRule{QPS: 1, Burst: 1})
+	key := &CallContextKey{ProjectID: "proj"}
+
+	if err := rl.Accept(context.Background(), key); err != nil {
+		t.Fatalf("Accept() = %v, want nil", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- rl.Accept(ctx, key) }()
+	fc.WaitForTimers(t, 1)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Accept() = %v, want %v", err, context.Canceled)
+	}
+	// The timer is stopped and the call no longer waits.
+	fc.WaitForTimers(t, 0)
+	if got := rl.QueueDepth(key); got != 0 {
+		t.Errorf("QueueDepth() = %d, want 0", got)
+	}
+
+	// The canceled call returned its token, so the next token is available
+	// after 1s.
+	go func() { done <- rl.Accept(context.Background(), key) }()
+	fc.WaitForTimers(t, 1)
+	fc.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Errorf("Accept() = %v, want nil", err)
+	}
+
+	// Already canceled contexts fail without taking a token.
+	if err := rl.Accept(ctx, key); err != context.Canceled {
+		t.Errorf("Accept() = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestTokenBucketRateLimiterRules(t *testing.T) {
+	rl, fc := newTestTokenBucketRateLimiter(t,
+		TokenBucketRule{Key: CallContextKey{ProjectID: "unlimited"}},
+		TokenBucketRule{Key: CallContextKey{Operation: "List*"}, QPS: 1, Burst: 1},
+		TokenBucketRule{Key: CallContextKey{ProjectID: "shared"}, QPS: 1, Burst: 1, Shared: true},
+		TokenBucketRule{Key: CallContextKey{ProjectID: "regional", Key: meta.Key{Region: "us-*"}}, QPS: 1, Burst: 1},
+		TokenBucketRule{Key: CallContextKey{ProjectID: "regional", Mutation: true}, QPS: 1, Burst: 1},
+		TokenBucketRule{Key: CallContextKey{ProjectID: "regional"}},
+		TokenBucketRule{Key: CallContextKey{ProjectID: "p"}, QPS: 1, Burst: 2},
+	)
+
+	// waits returns the number of calls out of n that wait for a token. The
+	// calls that wait are canceled, which returns their tokens.
+	waits := func(key *CallContextKey, n int) int {
+		t.Helper()
+		var ret int
+		for i := 0; i < n; i++ {
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() { done <- rl.Accept(ctx, key) }()
+			var finished bool
+			for !finished && fc.pendingTimers() == 0 {
+				select {
+				case err := <-done:
+					if err != nil {
+						t.Fatalf("Accept(%+v) = %v, want nil", key, err)
+					}
+					finished = true
+				default:
+					time.Sleep(time.Millisecond)
+				}
+			}
+			cancel()
+			if !finished {
+				ret++
+				<-done
+				fc.WaitForTimers(t, 0)
+			}
+		}
+		return ret
+	}
+
+	for _, tc := range []struct {
+		name string
+		key  *CallContextKey
+		n    int
+		want int
+	}{
+		{name: "unlimited", key: &CallContextKey{ProjectID: "unlimited", Operation: "List"}, n: 10, want: 0},
+		{name: "List", key: &CallContextKey{ProjectID: "p", Operation: "List", Version: "ga"}, n: 2, want: 1},
+		{name: "ListUsable", key: &CallContextKey{ProjectID: "p", Operation: "ListUsable", Version: "ga"}, n: 2, want: 1},
+		{name: "shared 1", key: &CallContextKey{ProjectID: "shared", Operation: "Get", Version: "ga"}, n: 1, want: 0},
+		{name: "shared 2", key: &CallContextKey{ProjectID: "shared", Operation: "Insert", Version: "beta"}, n: 1, want: 1},
+		{name: "region", key: &CallContextKey{ProjectID: "regional", Operation: "Get", Key: *meta.RegionalKey("a", "us-central1")}, n: 2, want: 1},
+		// The calls for the resources in the same location share a bucket.
+		{name: "same region", key: &CallContextKey{ProjectID: "regional", Operation: "Get", Key: *meta.RegionalKey("b", "us-central1")}, n: 1, want: 1},
+		{name: "other region", key: &CallContextKey{ProjectID: "regional", Operation: "Get", Key: *meta.RegionalKey("a", "us-east1")}, n: 2, want: 1},
+		{name: "unmatched region", key: &CallContextKey{ProjectID: "regional", Operation: "Get", Key: *meta.RegionalKey("a", "europe-west1")}, n: 10, want: 0},
+		{name: "mutation", key: &CallContextKey{ProjectID: "regional", Operation: "Insert", Key: *meta.GlobalKey("a"), Mutation: true}, n: 2, want: 1},
+		{name: "not mutation", key: &CallContextKey{ProjectID: "regional", Operation: "Get", Key: *meta.GlobalKey("a")}, n: 10, want: 0},
+		{name: "project", key: &CallContextKey{ProjectID: "p", Operation: "Get", Version: "ga"}, n: 3, want: 1},
+		{name: "no match", key: &CallContextKey{ProjectID: "other", Operation: "Get"}, n: 10, want: 0},
+		{name: "nil key", n: 10, want: 0},
+	} {
+		if got := waits(tc.key, tc.n); got != tc.want {
+			t.Errorf("%s: %d of %d calls waited, want %d", tc.name, got, tc.n, tc.want)
+		}
+	}
+	fc.WaitForTimers(t, 0)
+}
+
+func TestTokenBucketRateLimiterQueueDepths(t *testing.T) {
+	rl, fc := newTestTokenBucketRateLimiter(t,
+		TokenBucketRule{Key: CallContextKey{ProjectID: "shared"}, QPS: 1, Burst: 1, Shared: true},
+		TokenBucketRule{QPS: 1, Burst: 1},
+	)
+	keys := []*CallContextKey{
+		{ProjectID: "shared", Service: "Addresses"},
+		{ProjectID: "shared", Service: "Networks"},
+		{ProjectID: "p1", Key: *meta.RegionalKey("a", "us-central1")},
+		{ProjectID: "p2"},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func(key *CallContextKey) {
+				defer wg.Done()
+				rl.Accept(ctx, key)
+			}(key)
+		}
+	}
+	// 2 of the calls for each non-shared key and 5 of the calls for the
+	// shared keys are waiting.
+	fc.WaitForTimers(t, 9)
+
+	want := map[CallContextKey]int{
+		{ProjectID: "shared"}: 5,
+		// The name is not part of the key of the bucket.
+		{ProjectID: "p1", Key: meta.Key{Region: "us-central1"}}: 2,
+		{ProjectID: "p2"}: 2,
+	}
+	if diff := cmp.Diff(rl.QueueDepths(), want); diff != "" {
+		t.Errorf("QueueDepths(); -got,+want: %s", diff)
+	}
+	if got := rl.QueueDepth(keys[0]); got != 5 {
+		t.Errorf("QueueDepth(%+v) = %d, want 5", keys[0], got)
+	}
+	if got := rl.QueueDepth(&CallContextKey{ProjectID: "p3"}); got != 0 {
+		t.Errorf("QueueDepth(p3) = %d, want 0", got)
+	}
+
+	cancel()
+	wg.Wait()
+	if diff := cmp.Diff(rl.QueueDepths(), map[CallContextKey]int{}); diff != "" {
+		t.Errorf("QueueDepths(); -got,+want: %s", diff)
+	}
+}
@@ -0,0 +1,290 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package recorder records the HTTP requests made to the GCE compute API into
+// cassettes and replays them offline. This allows a run against the real API
+// (e.g. the e2e tests) to be turned into hermetic tests of the cloud.GCE
+// implementation, including the operation polling and the error handling.
+//
+// Record:
+//
+//	client, err := google.DefaultClient(ctx, compute.ComputeScope)
+//	rec := recorder.NewRecorder(client.Transport)
+//	svc, err := recorder.NewService(ctx, rec, "", pr)
+//	gce := cloud.NewGCE(svc)
+//	... // make the calls.
+//	err = rec.Save("testdata/insert.json")
+//
+// Replay:
+//
+//	c, err := recorder.Load("testdata/insert.json")
+//	rep := recorder.NewReplayer(c, recorder.Strict)
+//	svc, err := recorder.NewService(ctx, rep, "", pr)
+//	gce := cloud.NewGCE(svc)
+//	... // make the same calls.
+//	if unused := rep.Unused(); len(unused) > 0 { ... }
+//
+// The credentials (the Authorization and Cookie headers, API keys, etc.) are
+// not recorded. The polls of an operation are recorded once, with the last
+// (i.e. DONE) response; when replaying, the operations are done on the first
+// poll and can be polled any number of times. See IsOperationPoll().
+//
+// The names of the resources must be the same when recording and replaying,
+// i.e. not random.
+package recorder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+)
+
+// DefaultEndpoint is the endpoint of the GCE compute API.
+const DefaultEndpoint = "https://compute.googleapis.com"
+
+// Cassette is a recording of HTTP interactions.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is a request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded HTTP request.
+type Request struct {
+	Method string `json:"method"`
+	// URL of the request, without the scheme and host, e.g.
+	// "/compute/v1/projects/p/global/addresses?alt=json".
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// Response is a recorded HTTP response.
+type Response struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Load reads a Cassette from the file at path.
+func Load(path string) (*Cassette, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("recorder: invalid cassette %q: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Save writes c to the file at path.
+func (c *Cassette) Save(path string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// ScrubbedHeaders are the headers that are not recorded.
+var ScrubbedHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Proxy-Authorization",
+	"Set-Cookie",
+	"X-Goog-Api-Key",
+}
+
+// ScrubbedParams are the query parameters that are not recorded.
+var ScrubbedParams = []string{
+	"access_token",
+	"key",
+}
+
+func scrubHeader(h http.Header) http.Header {
+	if len(h) == 0 {
+		return nil
+	}
+	h = h.Clone()
+	for _, k := range ScrubbedHeaders {
+		h.Del(k)
+	}
+	return h
+}
+
+// requestURL returns the URL of the request without the scheme, host and
+// scrubbed parameters.
+func requestURL(u *url.URL) string {
+	q := u.Query()
+	for _, p := range ScrubbedParams {
+		q.Del(p)
+	}
+	ret := &url.URL{Path: u.Path, RawPath: u.RawPath, RawQuery: q.Encode()}
+	return ret.String()
+}
+
+// IsOperationPoll returns true if the request polls operations, i.e. it is a
+// Get, Wait or List of the {Global,Region,Zone}Operations.
+func IsOperationPoll(method, path string) bool {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, p := range parts {
+		if p != "operations" {
+			continue
+		}
+		global := i >= 1 && parts[i-1] == "global"
+		scoped := i >= 2 && (parts[i-2] == "regions" || parts[i-2] == "zones")
+		if !global && !scoped {
+			continue
+		}
+		switch rest := parts[i+1:]; len(rest) {
+		case 0, 1:
+			return method == http.MethodGet
+		case 2:
+			return method == http.MethodPost && rest[1] == "wait"
+		}
+	}
+	return false
+}
+
+func (in *Interaction) isOperationPoll() bool {
+	u, err := url.Parse(in.Request.URL)
+	return err == nil && IsOperationPoll(in.Request.Method, u.Path)
+}
+
+// readBody reads and replaces the body of a request or response.
+func readBody(body *io.ReadCloser) (string, error) {
+	if *body == nil || *body == http.NoBody {
+		return "", nil
+	}
+	b, err := io.ReadAll(*body)
+	(*body).Close()
+	*body = io.NopCloser(bytes.NewReader(b))
+	return string(b), err
+}
+
+// NewRecorder returns a Recorder that makes the requests with transport. If
+// transport is nil, http.DefaultTransport is used.
+func NewRecorder(transport http.RoundTripper) *Recorder {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Recorder{transport: transport}
+}
+
+// Recorder is an http.RoundTripper that records the requests and responses.
+//
+// This object is thread-safe.
+type Recorder struct {
+	transport http.RoundTripper
+
+	lock     sync.Mutex
+	cassette Cassette
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	in := &Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    requestURL(req.URL),
+			Header: scrubHeader(req.Header),
+		},
+	}
+	if req.Body != nil {
+		// The request must not be modified by a RoundTripper.
+		req = req.Clone(req.Context())
+		body, err := readBody(&req.Body)
+		if err != nil {
+			return nil, err
+		}
+		in.Request.Body = body
+	}
+
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		// Transport errors are not recorded.
+		return nil, err
+	}
+	body, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	in.Response = Response{
+		StatusCode: resp.StatusCode,
+		Header:     scrubHeader(resp.Header),
+		Body:       body,
+	}
+	r.add(in)
+	return resp, nil
+}
+
+// add appends in to the cassette. Only the last poll of an operation is
+// kept, i.e. the previous polls with the same request are removed.
+func (r *Recorder) add(in *Interaction) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if in.isOperationPoll() {
+		var kept []*Interaction
+		for _, old := range r.cassette.Interactions {
+			if old.Request.Method == in.Request.Method && old.Request.URL == in.Request.URL {
+				continue
+			}
+			kept = append(kept, old)
+		}
+		r.cassette.Interactions = kept
+	}
+	r.cassette.Interactions = append(r.cassette.Interactions, in)
+}
+
+// Cassette returns the interactions recorded so far.
+func (r *Recorder) Cassette() *Cassette {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return &Cassette{Interactions: append([]*Interaction{}, r.cassette.Interactions...)}
+}
+
+// Save writes the interactions recorded so far to the file at path.
+func (r *Recorder) Save(path string) error {
+	return r.Cassette().Save(path)
+}
+
+// NewService returns a cloud.Service with GA, Alpha and Beta clients that
+// make the requests with rt (e.g. a Recorder or a Replayer) to the API at
+// endpoint, e.g. fakeserver.Server.URL(). If endpoint is empty,
+// DefaultEndpoint is used.
+func NewService(ctx context.Context, rt http.RoundTripper, endpoint string, pr cloud.ProjectRouter) (*cloud.Service, error) {
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	return cloud.NewServiceForEndpoint(ctx, endpoint, &http.Client{Transport: rt}, pr)
+}
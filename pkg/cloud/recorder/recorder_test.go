@@ -0,0 +1,359 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package recorder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	ga "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/fakeserver"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+)
+
+const project = "proj"
+
+func TestIsOperationPoll(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		method string
+		path   string
+		want   bool
+	}{
+		{method: "GET", path: "/compute/v1/projects/p/global/operations/op", want: true},
+		{method: "GET", path: "/compute/v1/projects/p/regions/r/operations/op", want: true},
+		{method: "GET", path: "/compute/beta/projects/p/zones/z/operations/op", want: true},
+		{method: "POST", path: "/compute/v1/projects/p/global/operations/op/wait", want: true},
+		{method: "GET", path: "/compute/v1/projects/p/zones/z/operations", want: true},
+		{method: "DELETE", path: "/compute/v1/projects/p/global/operations/op"},
+		{method: "GET", path: "/compute/v1/projects/p/global/addresses/a"},
+		{method: "GET", path: "/compute/v1/projects/p/global/addresses/operations"},
+		{method: "GET", path: "/compute/v1/projects/p/global/addresses/operations/x"},
+	} {
+		if got := IsOperationPoll(tc.method, tc.path); got != tc.want {
+			t.Errorf("IsOperationPoll(%q, %q) = %t, want %t", tc.method, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	t.Parallel()
+
+	var polls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Set-Cookie", "secret")
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(req.URL.Path, "/operations/") {
+			polls++
+			fmt.Fprintf(w, `{"name":"op","status":%q}`, map[bool]string{true: "DONE", false: "RUNNING"}[polls == 3])
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		fmt.Fprintf(w, `{"echo":%q}`, body)
+	}))
+	t.Cleanup(ts.Close)
+
+	rec := NewRecorder(nil)
+	client := &http.Client{Transport: rec}
+
+	do := func(method, path, body string) string {
+		t.Helper()
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("http.NewRequest() = %v, want nil", err)
+		}
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("X-Goog-User-Project", "billing")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("client.Do(%s %s) = %v, want nil", method, path, err)
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("io.ReadAll() = %v, want nil", err)
+		}
+		return string(b)
+	}
+
+	if got, want := do("POST", "/compute/v1/projects/p/global/addresses?key=secret&alt=json", `{"name":"a"}`), `{"echo":"{\"name\":\"a\"}"}`; got != want {
+		t.Errorf("response = %q, want %q", got, want)
+	}
+	for i := 0; i < 3; i++ {
+		do("GET", "/compute/v1/projects/p/global/operations/op", "")
+	}
+
+	c := rec.Cassette()
+	var got []string
+	for _, in := range c.Interactions {
+		got = append(got, fmt.Sprintf("%s %s %s = %d %s", in.Request.Method, in.Request.URL, in.Request.Body, in.Response.StatusCode, in.Response.Body))
+		for _, h := range []http.Header{in.Request.Header, in.Response.Header} {
+			for _, k := range []string{"Authorization", "Set-Cookie"} {
+				if v := h.Get(k); v != "" {
+					t.Errorf("header %s = %q was recorded", k, v)
+				}
+			}
+		}
+		if v := in.Request.Header.Get("X-Goog-User-Project"); v != "billing" {
+			t.Errorf("header X-Goog-User-Project = %q, want %q", v, "billing")
+		}
+	}
+	want := []string{
+		`POST /compute/v1/projects/p/global/addresses?alt=json {"name":"a"} = 200 {"echo":"{\"name\":\"a\"}"}`,
+		`GET /compute/v1/projects/p/global/operations/op  = 200 {"name":"op","status":"DONE"}`,
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("interactions; -got,+want: %s", diff)
+	}
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if err := rec.Save(path); err != nil {
+		t.Fatalf("Save() = %v, want nil", err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() = %v, want nil", err)
+	}
+	if diff := cmp.Diff(loaded, c); diff != "" {
+		t.Errorf("Load(); -got,+want: %s", diff)
+	}
+}
+
+func TestReplayer(t *testing.T) {
+	t.Parallel()
+
+	interaction := func(method, url, body string) *Interaction {
+		return &Interaction{
+			Request:  Request{Method: method, URL: url, Body: body},
+			Response: Response{StatusCode: http.StatusOK, Body: method + " " + url},
+		}
+	}
+	c := &Cassette{Interactions: []*Interaction{
+		interaction("POST", "/v1/addresses?alt=json", `{"name":"a","region":"r"}`),
+		interaction("GET", "/v1/global/operations/op", ""),
+		interaction("GET", "/v1/addresses/a?alt=json", ""),
+		interaction("GET", "/v1/addresses/a?alt=json", ""),
+	}}
+
+	type request struct {
+		method, url, body string
+	}
+	for _, tc := range []struct {
+		name       string
+		matching   Matching
+		requests   []request
+		want       []string
+		wantUnused int
+	}{
+		{
+			name:     "strict",
+			matching: Strict,
+			requests: []request{
+				// JSON bodies are compared by value.
+				{"POST", "/v1/addresses?alt=json", `{"region": "r", "name": "a"}`},
+				{"GET", "/v1/global/operations/op", ""},
+				{"GET", "/v1/global/operations/op", ""},
+				{"GET", "/v1/addresses/a?alt=json", ""},
+			},
+			want: []string{
+				"POST /v1/addresses?alt=json",
+				"GET /v1/global/operations/op",
+				"GET /v1/global/operations/op",
+				"GET /v1/addresses/a?alt=json",
+			},
+			wantUnused: 1,
+		},
+		{
+			name:     "strict wrong body",
+			matching: Strict,
+			requests: []request{{"POST", "/v1/addresses?alt=json", `{"name":"b"}`}},
+			want:     []string{"error"},
+		},
+		{
+			name:     "strict wrong order",
+			matching: Strict,
+			requests: []request{{"GET", "/v1/addresses/a?alt=json", ""}},
+			want:     []string{"error"},
+		},
+		{
+			name:     "strict wrong query",
+			matching: Strict,
+			requests: []request{{"POST", "/v1/addresses?alt=proto", `{"name":"a","region":"r"}`}},
+			want:     []string{"error"},
+		},
+		{
+			name:     "strict too many requests",
+			matching: Strict,
+			requests: []request{
+				{"POST", "/v1/addresses?alt=json", `{"name":"a","region":"r"}`},
+				{"GET", "/v1/addresses/a?alt=json", ""},
+				{"GET", "/v1/addresses/a?alt=json", ""},
+				{"GET", "/v1/addresses/a?alt=json", ""},
+			},
+			want: []string{
+				"POST /v1/addresses?alt=json",
+				"GET /v1/addresses/a?alt=json",
+				"GET /v1/addresses/a?alt=json",
+				"error",
+			},
+		},
+		{
+			name:     "lenient",
+			matching: Lenient,
+			requests: []request{
+				{"GET", "/v1/addresses/a", ""},
+				{"POST", "/v1/addresses", `{"name":"b"}`},
+				{"GET", "/v1/addresses/a?alt=json", ""},
+				{"GET", "/v1/addresses/a?alt=json", ""},
+			},
+			want: []string{
+				"GET /v1/addresses/a?alt=json",
+				"POST /v1/addresses?alt=json",
+				"GET /v1/addresses/a?alt=json",
+				"error",
+			},
+		},
+		{
+			name:       "unknown operation",
+			matching:   Lenient,
+			requests:   []request{{"GET", "/v1/global/operations/other", ""}},
+			want:       []string{"error"},
+			wantUnused: 3,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewReplayer(c, tc.matching)
+			client := &http.Client{Transport: r}
+			var got []string
+			for _, req := range tc.requests {
+				var body io.Reader
+				if req.body != "" {
+					body = strings.NewReader(req.body)
+				}
+				hreq, err := http.NewRequest(req.method, "https://example.com"+req.url, body)
+				if err != nil {
+					t.Fatalf("http.NewRequest() = %v, want nil", err)
+				}
+				resp, err := client.Do(hreq)
+				if err != nil {
+					got = append(got, "error")
+					continue
+				}
+				b, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				got = append(got, string(b))
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("responses; -got,+want: %s", diff)
+			}
+			if tc.want[len(tc.want)-1] != "error" {
+				if got := len(r.Unused()); got != tc.wantUnused {
+					t.Errorf("len(Unused()) = %d, want %d", got, tc.wantUnused)
+				}
+			}
+		})
+	}
+}
+
+// run makes the calls of TestRecordReplay and returns their results.
+func run(t *testing.T, gce *cloud.GCE) []string {
+	t.Helper()
+	ctx := context.Background()
+	var ret []string
+	add := func(format string, args ...interface{}) {
+		ret = append(ret, fmt.Sprintf(format, args...))
+	}
+
+	key := meta.RegionalKey("addr", "us-central1")
+	add("Insert: %v", gce.Addresses().Insert(ctx, key, &ga.Address{Description: "d"}))
+	if a, err := gce.Addresses().Get(ctx, key); err != nil {
+		add("Get: %v", err)
+	} else {
+		add("Get: %s %s", a.Name, a.Description)
+	}
+	_, err := gce.Addresses().Get(ctx, meta.RegionalKey("other", "us-central1"))
+	var gerr *googleapi.Error
+	add("Get(other): %t", errors.As(err, &gerr) && gerr.Code == http.StatusNotFound)
+	l, err := gce.Addresses().List(ctx, "us-central1", filter.None)
+	add("List: %d, %v", len(l), err)
+	add("Delete: %v", gce.Addresses().Delete(ctx, key))
+	return ret
+}
+
+func TestRecordReplay(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	pr := &cloud.SingleProjectRouter{ID: project}
+
+	srv := fakeserver.New(cloud.NewMockGCE(pr))
+	t.Cleanup(srv.Close)
+	srv.Mock.Operations.Latency = 20 * time.Millisecond
+	rec := NewRecorder(nil)
+	svc, err := NewService(ctx, rec, srv.URL(), pr)
+	if err != nil {
+		t.Fatalf("NewService() = %v, want nil", err)
+	}
+	svc.OperationMode = cloud.OperationModeGet
+	want := run(t, cloud.NewGCE(svc))
+	srv.Close()
+
+	c := rec.Cassette()
+	var polls int
+	for _, in := range c.Interactions {
+		if in.isOperationPoll() {
+			polls++
+		}
+	}
+	// One poll for each of the Insert and Delete operations.
+	if polls != 2 {
+		t.Errorf("%d operation polls recorded, want 2", polls)
+	}
+
+	for _, m := range []Matching{Strict, Lenient} {
+		rep := NewReplayer(c, m)
+		// The requests are replayed without the server.
+		svc, err := NewService(ctx, rep, "", pr)
+		if err != nil {
+			t.Fatalf("NewService() = %v, want nil", err)
+		}
+		svc.OperationMode = cloud.OperationModeGet
+		if diff := cmp.Diff(run(t, cloud.NewGCE(svc)), want); diff != "" {
+			t.Errorf("%v: replayed results; -got,+want: %s", m, diff)
+		}
+		if unused := rep.Unused(); len(unused) != 0 {
+			t.Errorf("%v: %d unused interactions, want 0", m, len(unused))
+		}
+	}
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package recorder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+// Matching selects how a Replayer matches the requests with the recorded
+// interactions.
+type Matching int
+
+const (
+	// Strict matching requires the requests to be made in the recorded
+	// order, with the same method, URL (path and query) and body. JSON
+	// bodies are compared by value.
+	Strict Matching = iota
+	// Lenient matching replays the first unused interaction with the same
+	// method and path as the request, in any order. The query and body of
+	// the request are ignored.
+	Lenient
+)
+
+func (m Matching) String() string {
+	switch m {
+	case Strict:
+		return "Strict"
+	case Lenient:
+		return "Lenient"
+	}
+	return fmt.Sprintf("Matching(%d)", int(m))
+}
+
+// NewReplayer returns a Replayer for the interactions in c.
+func NewReplayer(c *Cassette, m Matching) *Replayer {
+	r := &Replayer{matching: m}
+	for _, in := range c.Interactions {
+		if in.isOperationPoll() {
+			r.polls = append(r.polls, in)
+		} else {
+			r.interactions = append(r.interactions, in)
+		}
+	}
+	r.used = make([]bool, len(r.interactions))
+	return r
+}
+
+// Replayer is an http.RoundTripper that replays the responses recorded in a
+// Cassette. Requests that do not match an interaction fail with an error.
+//
+// The operation polls (see IsOperationPoll()) are matched separately from
+// the other requests: they can be made at any point, any number of times.
+//
+// This object is thread-safe.
+type Replayer struct {
+	matching Matching
+
+	lock         sync.Mutex
+	interactions []*Interaction
+	used         []bool
+	// next is the index of the next interaction for Strict matching.
+	next  int
+	polls []*Interaction
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	got := Request{Method: req.Method, URL: requestURL(req.URL)}
+	if rc := req.Body; rc != nil {
+		body, err := readBody(&rc)
+		if err != nil {
+			return nil, err
+		}
+		got.Body = body
+	}
+
+	in, err := r.match(&got, IsOperationPoll(req.Method, req.URL.Path))
+	if err != nil {
+		klog.V(2).Infof("Replayer: %v", err)
+		return nil, err
+	}
+	klog.V(5).Infof("Replayer: %s %s = %d", got.Method, got.URL, in.Response.StatusCode)
+
+	header := in.Response.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", in.Response.StatusCode, http.StatusText(in.Response.StatusCode)),
+		StatusCode:    in.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader([]byte(in.Response.Body))),
+		ContentLength: int64(len(in.Response.Body)),
+		Request:       req,
+	}, nil
+}
+
+// match returns the interaction for the request got.
+func (r *Replayer) match(got *Request, poll bool) (*Interaction, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if poll {
+		for _, in := range r.polls {
+			if r.matches(&in.Request, got) {
+				return in, nil
+			}
+		}
+		return nil, fmt.Errorf("recorder: no recorded operation poll matches %s %s", got.Method, got.URL)
+	}
+
+	if r.matching == Strict {
+		if r.next >= len(r.interactions) {
+			return nil, fmt.Errorf("recorder: unexpected request %s %s after the last recorded interaction", got.Method, got.URL)
+		}
+		want := &r.interactions[r.next].Request
+		if !r.matches(want, got) {
+			return nil, fmt.Errorf("recorder: request %d is %s %s (body %q), want %s %s (body %q)", r.next, got.Method, got.URL, got.Body, want.Method, want.URL, want.Body)
+		}
+		r.used[r.next] = true
+		r.next++
+		return r.interactions[r.next-1], nil
+	}
+
+	for i, in := range r.interactions {
+		if !r.used[i] && r.matches(&in.Request, got) {
+			r.used[i] = true
+			return in, nil
+		}
+	}
+	return nil, fmt.Errorf("recorder: no unused interaction matches %s %s", got.Method, got.URL)
+}
+
+// matches returns true if the request got matches the recorded request want.
+func (r *Replayer) matches(want, got *Request) bool {
+	if want.Method != got.Method {
+		return false
+	}
+	wantURL, err := url.Parse(want.URL)
+	if err != nil {
+		return false
+	}
+	gotURL, err := url.Parse(got.URL)
+	if err != nil {
+		return false
+	}
+	if wantURL.Path != gotURL.Path {
+		return false
+	}
+	if r.matching == Lenient {
+		return true
+	}
+	return reflect.DeepEqual(wantURL.Query(), gotURL.Query()) && sameBody(want.Body, got.Body)
+}
+
+// sameBody returns true if the bodies a and b are the same, comparing JSON
+// bodies by value.
+func sameBody(a, b string) bool {
+	if a == b {
+		return true
+	}
+	var av, bv interface{}
+	if json.Unmarshal([]byte(a), &av) != nil || json.Unmarshal([]byte(b), &bv) != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
+
+// Unused returns the interactions that have not been replayed, excluding the
+// operation polls.
+func (r *Replayer) Unused() []*Interaction {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var ret []*Interaction
+	for i, in := range r.interactions {
+		if !r.used[i] {
+			ret = append(ret, in)
+		}
+	}
+	return ret
+}
@@ -26,4 +26,7 @@ limitations under the License.
 // - CTP does not have dependencies.
 //
 // Then the execution trace will be CTP -> TPE -> CFR.
+//
+// ValidatePlan can be used to detect Actions that will never run (e.g. due to
+// cycles or Events that are never signaled) before executing the plan.
 package exec
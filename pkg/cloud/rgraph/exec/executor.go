@@ -76,10 +76,17 @@ func ErrorStrategyOption(s ErrorStrategy) Option {
 	return func(c *ExecutorConfig) { c.ErrorStrategy = s }
 }
 
+// WorkerCountOption sets the maximum number of Actions that will be run
+// concurrently. This is ignored by the serial Executor.
+func WorkerCountOption(n int) Option {
+	return func(c *ExecutorConfig) { c.WorkerCount = n }
+}
+
 func defaultExecutorConfig() *ExecutorConfig {
 	return &ExecutorConfig{
 		DryRun:        false,
 		ErrorStrategy: StopOnError,
+		WorkerCount:   10,
 	}
 }
 
@@ -88,6 +95,11 @@ type ExecutorConfig struct {
 	Tracer        Tracer
 	DryRun        bool
 	ErrorStrategy ErrorStrategy
+	// WorkerCount is the maximum number of Actions that will be run
+	// concurrently by the parallel Executor.
+	WorkerCount int
+	// RetryPolicy for failed Actions. If nil, Actions are not retried.
+	RetryPolicy *RetryPolicy
 }
 
 func (c *ExecutorConfig) validate() error {
@@ -96,5 +108,13 @@ func (c *ExecutorConfig) validate() error {
 	default:
 		return fmt.Errorf("invalid ErrorStrategy: %q", c.ErrorStrategy)
 	}
+	if c.WorkerCount < 1 {
+		return fmt.Errorf("invalid WorkerCount: %d", c.WorkerCount)
+	}
+	if c.RetryPolicy != nil {
+		if err := c.RetryPolicy.validate(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
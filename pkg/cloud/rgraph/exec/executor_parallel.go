@@ -0,0 +1,182 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+)
+
+// NewParallelExecutor returns a new Executor that runs Actions concurrently,
+// using at most WorkerCount goroutines.
+//
+// Actions are run in parallel, but all bookkeeping (signaling Events, updating
+// the Result and calling the Tracer) is done from a single goroutine, so
+// Action.Signal() and Tracer implementations do not need to be thread-safe with
+// respect to the Executor.
+func NewParallelExecutor(pending []Action, opts ...Option) (*parallelExecutor, error) {
+	ret := &parallelExecutor{
+		config: defaultExecutorConfig(),
+		result: &Result{Pending: pending},
+	}
+	for _, opt := range opts {
+		opt(ret.config)
+	}
+
+	if err := ret.config.validate(); err != nil {
+		return nil, err
+	}
+
+	if ret.config.DryRun {
+		ret.runFunc = func(ctx context.Context, c cloud.Cloud, a Action) ([]Event, error) {
+			return a.DryRun(), nil
+		}
+	} else {
+		ret.runFunc = func(ctx context.Context, c cloud.Cloud, a Action) ([]Event, error) {
+			return a.Run(ctx, c)
+		}
+	}
+
+	return ret, nil
+}
+
+type parallelExecutor struct {
+	config *ExecutorConfig
+
+	runFunc func(context.Context, cloud.Cloud, Action) ([]Event, error)
+	result  *Result
+}
+
+var _ Executor = (*parallelExecutor)(nil)
+
+// parallelResult is sent from a worker back to the scheduling loop when an
+// Action finishes.
+type parallelResult struct {
+	te     *TraceEntry
+	events []Event
+	err    error
+}
+
+func (ex *parallelExecutor) Run(ctx context.Context, c cloud.Cloud) (*Result, error) {
+	done := make(chan parallelResult, ex.config.WorkerCount)
+
+	var (
+		active  int
+		stopErr error
+	)
+	for {
+		// Schedule as many runnable Actions as we have free workers for.
+		for stopErr == nil && active < ex.config.WorkerCount {
+			if ctx.Err() != nil {
+				stopErr = fmt.Errorf("parallelExecutor: stopping execution (got %w)", ctx.Err())
+				break
+			}
+			a := ex.next()
+			if a == nil {
+				break
+			}
+			active++
+			go ex.runAction(ctx, c, a, done)
+		}
+		if active == 0 {
+			break
+		}
+
+		r := <-done
+		active--
+		if err := ex.complete(r); err != nil && stopErr == nil {
+			stopErr = err
+		}
+	}
+
+	if stopErr != nil {
+		return ex.result, stopErr
+	}
+	if ex.config.Tracer != nil {
+		ex.config.Tracer.Finish(ex.result.Pending)
+	}
+	if len(ex.result.Errors) > 0 {
+		return ex.result, fmt.Errorf("parallelExecutor: errors in execution %v", ex.result.Errors)
+	}
+
+	return ex.result, nil
+}
+
+// runAction is called from the worker goroutine.
+func (ex *parallelExecutor) runAction(ctx context.Context, c cloud.Cloud, a Action, done chan<- parallelResult) {
+	te := &TraceEntry{
+		Action: a,
+		Start:  time.Now(),
+	}
+	events, err := runWithRetry(ctx, ex.config, ex.runFunc, c, a, te)
+	te.End = time.Now()
+	te.Err = err
+
+	done <- parallelResult{te: te, events: events, err: err}
+}
+
+// complete processes the result of an Action. This is only called from the
+// scheduling loop. Returns non-nil if execution should stop.
+func (ex *parallelExecutor) complete(r parallelResult) error {
+	var ret error
+
+	if r.err == nil {
+		ex.result.Completed = append(ex.result.Completed, r.te.Action)
+	} else {
+		ex.result.Errors = append(ex.result.Errors, ActionWithErr{Action: r.te.Action, Err: r.err})
+		switch ex.config.ErrorStrategy {
+		case ContinueOnError:
+		case StopOnError:
+			ret = fmt.Errorf("parallelExecutor: stopping execution (got %v)", r.err)
+		default:
+			ret = fmt.Errorf("parallelExecutor: invalid ErrorStrategy %q", ex.config.ErrorStrategy)
+		}
+	}
+	// Events are signaled even when stopping so that the Pending Actions
+	// reflect the state of the execution.
+	for _, ev := range r.events {
+		r.te.Signaled = append(r.te.Signaled, ex.signal(ev)...)
+	}
+	if ex.config.Tracer != nil {
+		ex.config.Tracer.Record(r.te, r.err)
+	}
+
+	return ret
+}
+
+func (ex *parallelExecutor) next() Action {
+	for i, a := range ex.result.Pending {
+		if a.CanRun() {
+			ex.result.Pending = append(ex.result.Pending[0:i], ex.result.Pending[i+1:]...)
+			return a
+		}
+	}
+	return nil
+}
+
+func (ex *parallelExecutor) signal(ev Event) []TraceSignal {
+	var ret []TraceSignal
+	for _, a := range ex.result.Pending {
+		if a.Signal(ev) {
+			ret = append(ret, TraceSignal{Event: ev, SignaledAction: a})
+		}
+	}
+	return ret
+}
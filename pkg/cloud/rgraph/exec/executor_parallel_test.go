@@ -0,0 +1,270 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParallelExecutor(t *testing.T) {
+	for _, dryRun := range []string{"dry run", "normal run"} {
+		t.Run(dryRun, func(t *testing.T) {
+			for _, tc := range []struct {
+				name  string
+				graph string
+				// pending should be sorted alphabetically for comparison.
+				pending []string
+				errs    []string
+				wantErr bool
+			}{
+				{
+					name:  "empty graph",
+					graph: "",
+				},
+				{
+					name:  "one action",
+					graph: "A",
+				},
+				{
+					name:  "action and dependency",
+					graph: "A -> B",
+				},
+				{
+					name:  "chain of 3 actions",
+					graph: "A -> B -> C",
+				},
+				{
+					name:  "two chains with common root",
+					graph: "A -> B -> C; A -> C",
+				},
+				{
+					name:  "wide fan out",
+					graph: "A -> B; A -> C; A -> D; A -> E; A -> F; A -> G",
+				},
+				{
+					name:    "two node cycle",
+					graph:   "A -> B -> A",
+					pending: []string{"A", "B"},
+				},
+				{
+					name:  "complex fan in",
+					graph: "A -> Z; B -> Z; C -> D -> B",
+				},
+				{
+					name:    "cycle in larger graph",
+					graph:   "A -> B -> C -> D -> C; X -> Y",
+					pending: []string{"C", "D"},
+				},
+				{
+					name:    "error in action",
+					graph:   "A -> B -> !C -> D",
+					pending: []string{"D"},
+					errs:    []string{"C([C])"},
+					wantErr: true,
+				},
+			} {
+				if dryRun == "dry run" && tc.wantErr {
+					// Dry run assumes no errors happen, so skip these test cases.
+					continue
+				}
+				t.Run(tc.name, func(t *testing.T) {
+					t.Logf("Graph: %q", tc.graph)
+					actions := actionsFromGraphStr(tc.graph)
+
+					tr := NewGraphvizTracer()
+					ex, err := NewParallelExecutor(actions,
+						ErrorStrategyOption(StopOnError),
+						TracerOption(tr),
+						WorkerCountOption(3),
+						DryRunOption(dryRun == "dry run"))
+					if err != nil {
+						t.Fatalf("NewParallelExecutor() = %v, want nil", err)
+					}
+					result, err := ex.Run(context.Background(), nil)
+					if gotErr := err != nil; gotErr != tc.wantErr {
+						t.Fatalf("Run() = %v; gotErr = %t, want %t", err, gotErr, tc.wantErr)
+					}
+					got := sortedStrings(result.Pending, func(a Action) string { return a.(*testAction).name })
+					if diff := cmp.Diff(got, tc.pending); diff != "" {
+						t.Errorf("pending: diff -got,+want: %s", diff)
+					}
+
+					var errNames []string
+					for _, ae := range result.Errors {
+						errNames = append(errNames, ae.Action.Metadata().Name)
+					}
+					if diff := cmp.Diff(sortedStrings(errNames, func(s string) string { return s }), tc.errs); diff != "" {
+						t.Errorf("errors: diff -got,+want: %s", diff)
+					}
+
+					t.Log(tr.String())
+				})
+			}
+		})
+	}
+}
+
+func TestParallelExecutorErrorStrategy(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		graph    string
+		strategy ErrorStrategy
+		// pending should be sorted alphabetically for comparison.
+		pending []string
+		errs    []string
+		wantErr bool
+	}{
+		{
+			name:     "stop on error",
+			graph:    "A -> !B -> C -> D -> E",
+			strategy: StopOnError,
+			pending:  []string{"C", "D", "E"},
+			errs:     []string{"B"},
+			wantErr:  true,
+		},
+		{
+			name:     "continue on error",
+			graph:    "A -> !B -> C -> D -> E",
+			strategy: ContinueOnError,
+			pending:  nil,
+			errs:     []string{"B"},
+			wantErr:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Logf("Graph: %q", tc.graph)
+			actions := actionsFromGraphStr(tc.graph)
+
+			var tr GraphvizTracer
+			ex, err := NewParallelExecutor(actions,
+				ErrorStrategyOption(tc.strategy),
+				TracerOption(&tr),
+				DryRunOption(false))
+			if err != nil {
+				t.Fatalf("NewParallelExecutor() = %v, want nil", err)
+			}
+			result, err := ex.Run(context.Background(), nil)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("Run() = %v; gotErr = %t, want %t", err, gotErr, tc.wantErr)
+			}
+			got := sortedStrings(result.Pending, func(a Action) string { return a.(*testAction).name })
+			if diff := cmp.Diff(got, tc.pending); diff != "" {
+				t.Errorf("pending: diff -got,+want: %s", diff)
+			}
+			got = sortedStrings(result.Errors, func(a ActionWithErr) string { return a.Action.(*testAction).name })
+			if diff := cmp.Diff(got, tc.errs); diff != "" {
+				t.Errorf("errors: diff -got,+want: %s", diff)
+			}
+			t.Log(tr.String())
+		})
+	}
+}
+
+// blockingAction tracks the number of concurrently running Actions.
+type blockingAction struct {
+	testAction
+	c *concurrencyCounter
+}
+
+type concurrencyCounter struct {
+	lock    sync.Mutex
+	current int
+	max     int
+}
+
+func (a *blockingAction) Run(context.Context, cloud.Cloud) ([]Event, error) {
+	a.c.lock.Lock()
+	a.c.current++
+	if a.c.current > a.c.max {
+		a.c.max = a.c.current
+	}
+	a.c.lock.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	a.c.lock.Lock()
+	a.c.current--
+	a.c.lock.Unlock()
+
+	return a.events, nil
+}
+
+func TestParallelExecutorWorkerCount(t *testing.T) {
+	const (
+		numActions = 20
+		workers    = 4
+	)
+	counter := &concurrencyCounter{}
+	var actions []Action
+	for i := 0; i < numActions; i++ {
+		name := fmt.Sprintf("A%d", i)
+		actions = append(actions, &blockingAction{
+			testAction: testAction{name: name, events: []Event{StringEvent(name)}},
+			c:          counter,
+		})
+	}
+
+	ex, err := NewParallelExecutor(actions, WorkerCountOption(workers))
+	if err != nil {
+		t.Fatalf("NewParallelExecutor() = %v, want nil", err)
+	}
+	result, err := ex.Run(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Run() = %v, want nil", err)
+	}
+	if len(result.Completed) != numActions {
+		t.Errorf("len(result.Completed) = %d, want %d", len(result.Completed), numActions)
+	}
+	if counter.max > workers {
+		t.Errorf("max concurrent actions = %d, want <= %d", counter.max, workers)
+	}
+	if counter.max < 2 {
+		t.Errorf("max concurrent actions = %d, want actions to run in parallel", counter.max)
+	}
+}
+
+func TestParallelExecutorInvalidConfig(t *testing.T) {
+	_, err := NewParallelExecutor(nil, WorkerCountOption(0))
+	if err == nil {
+		t.Fatalf("NewParallelExecutor(WorkerCountOption(0)) = nil, want error")
+	}
+}
+
+func TestParallelExecutorContextCancelled(t *testing.T) {
+	actions := actionsFromGraphStr("A -> B -> C")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ex, err := NewParallelExecutor(actions)
+	if err != nil {
+		t.Fatalf("NewParallelExecutor() = %v, want nil", err)
+	}
+	result, err := ex.Run(ctx, nil)
+	if err == nil {
+		t.Fatalf("Run() = nil, want error")
+	}
+	if len(result.Pending) != 3 {
+		t.Errorf("len(result.Pending) = %d, want 3", len(result.Pending))
+	}
+}
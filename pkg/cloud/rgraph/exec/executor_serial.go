@@ -82,8 +82,9 @@ func (ex *serialExecutor) runAction(ctx context.Context, c cloud.Cloud, a Action
 		Action: a,
 		Start:  time.Now(),
 	}
-	events, runErr := ex.runFunc(ctx, c, a)
+	events, runErr := runWithRetry(ctx, ex.config, ex.runFunc, c, a, te)
 	te.End = time.Now()
+	te.Err = runErr
 
 	if runErr == nil {
 		ex.result.Completed = append(ex.result.Completed, a)
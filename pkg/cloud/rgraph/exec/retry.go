@@ -0,0 +1,141 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	cerrors "github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/errors"
+)
+
+// RetryPolicy controls how an Executor retries Actions that return an error.
+// The backoff between attempts grows exponentially from InitialBackoff by
+// Multiplier up to MaxBackoff, with a random Jitter applied.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times an Action will be run,
+	// including the first attempt.
+	MaxAttempts int
+	// InitialBackoff is the delay before the second attempt.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts.
+	MaxBackoff time.Duration
+	// Multiplier is applied to the backoff after each attempt. Must be >= 1.
+	Multiplier float64
+	// Jitter is the fraction of the backoff, in [0, 1], that is randomized.
+	// For example, a Jitter of 0.2 with a backoff of 10s will wait between 8s
+	// and 10s.
+	Jitter float64
+	// IsRetryable classifies errors returned by Action.Run(). If nil,
+	// IsRetryableError is used.
+	IsRetryable func(error) bool
+}
+
+// DefaultRetryPolicy returns a RetryPolicy suitable for transient GCE API
+// errors.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 1 * time.Second,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		IsRetryable:    IsRetryableError,
+	}
+}
+
+// RetryPolicyOption sets the policy for retrying failed Actions. A nil policy
+// disables retries (the default).
+func RetryPolicyOption(p *RetryPolicy) Option {
+	return func(c *ExecutorConfig) { c.RetryPolicy = p }
+}
+
+func (p *RetryPolicy) validate() error {
+	switch {
+	case p.MaxAttempts < 1:
+		return fmt.Errorf("invalid RetryPolicy.MaxAttempts: %d", p.MaxAttempts)
+	case p.InitialBackoff < 0:
+		return fmt.Errorf("invalid RetryPolicy.InitialBackoff: %v", p.InitialBackoff)
+	case p.MaxBackoff < p.InitialBackoff:
+		return fmt.Errorf("invalid RetryPolicy.MaxBackoff: %v (less than InitialBackoff %v)", p.MaxBackoff, p.InitialBackoff)
+	case p.Multiplier < 1:
+		return fmt.Errorf("invalid RetryPolicy.Multiplier: %v", p.Multiplier)
+	case p.Jitter < 0 || p.Jitter > 1:
+		return fmt.Errorf("invalid RetryPolicy.Jitter: %v", p.Jitter)
+	}
+	return nil
+}
+
+func (p *RetryPolicy) isRetryable(err error) bool {
+	if p.IsRetryable != nil {
+		return p.IsRetryable(err)
+	}
+	return IsRetryableError(err)
+}
+
+// backoff returns the delay after the given attempt (1-based).
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	if d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	d -= d * p.Jitter * rand.Float64()
+	return time.Duration(d)
+}
+
+// IsRetryableError returns true if err is a transient GCE API error: HTTP 429,
+// 5xx or an error with a transient reason such as "resourceNotReady". See
+// errors.IsRetryable() in pkg/cloud/errors.
+func IsRetryableError(err error) bool {
+	return cerrors.IsRetryable(err)
+}
+
+// runWithRetry runs the Action, retrying according to the configured
+// RetryPolicy. Each attempt is appended to te.Attempts.
+func runWithRetry(
+	ctx context.Context,
+	config *ExecutorConfig,
+	runFunc func(context.Context, cloud.Cloud, Action) ([]Event, error),
+	c cloud.Cloud,
+	a Action,
+	te *TraceEntry,
+) ([]Event, error) {
+	p := config.RetryPolicy
+	for attempt := 1; ; attempt++ {
+		ta := TraceAttempt{Start: time.Now()}
+		events, err := runFunc(ctx, c, a)
+		ta.End = time.Now()
+		ta.Err = err
+		te.Attempts = append(te.Attempts, ta)
+
+		if err == nil || p == nil || attempt >= p.MaxAttempts || !p.isRetryable(err) {
+			return events, err
+		}
+
+		timer := time.NewTimer(p.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%w (retry cancelled: %v)", err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,261 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"google.golang.org/api/googleapi"
+)
+
+// flakyAction fails with err for the first failures runs.
+type flakyAction struct {
+	testAction
+	failures int
+	runs     int
+}
+
+func (a *flakyAction) Run(context.Context, cloud.Cloud) ([]Event, error) {
+	a.runs++
+	if a.runs <= a.failures {
+		return nil, a.err
+	}
+	return a.events, nil
+}
+
+// recordingTracer saves all of the TraceEntries.
+type recordingTracer struct {
+	lock    sync.Mutex
+	entries []*TraceEntry
+}
+
+func (tr *recordingTracer) Record(entry *TraceEntry, err error) {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	tr.entries = append(tr.entries, entry)
+}
+
+func (tr *recordingTracer) Finish([]Action) {}
+
+func TestRetryPolicy(t *testing.T) {
+	retryableErr := &googleapi.Error{Code: http.StatusServiceUnavailable}
+	policy := &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     2 * time.Millisecond,
+		Multiplier:     2,
+		Jitter:         0.5,
+	}
+
+	for _, tc := range []struct {
+		name         string
+		policy       *RetryPolicy
+		failures     int
+		err          error
+		wantRuns     int
+		wantErr      bool
+		wantAttempts int
+	}{
+		{
+			name:         "no retry policy",
+			failures:     1,
+			err:          retryableErr,
+			wantRuns:     1,
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+		{
+			name:         "success on first attempt",
+			policy:       policy,
+			wantRuns:     1,
+			wantAttempts: 1,
+		},
+		{
+			name:         "success after retries",
+			policy:       policy,
+			failures:     2,
+			err:          retryableErr,
+			wantRuns:     3,
+			wantAttempts: 3,
+		},
+		{
+			name:         "exceeds MaxAttempts",
+			policy:       policy,
+			failures:     5,
+			err:          retryableErr,
+			wantRuns:     3,
+			wantErr:      true,
+			wantAttempts: 3,
+		},
+		{
+			name:         "not retryable",
+			policy:       policy,
+			failures:     1,
+			err:          errors.New("injected"),
+			wantRuns:     1,
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+		{
+			name: "custom classifier",
+			policy: &RetryPolicy{
+				MaxAttempts:    3,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     time.Millisecond,
+				Multiplier:     1,
+				IsRetryable:    func(error) bool { return true },
+			},
+			failures:     1,
+			err:          errors.New("injected"),
+			wantRuns:     2,
+			wantAttempts: 2,
+		},
+	} {
+		for _, executor := range []string{"serial", "parallel"} {
+			t.Run(tc.name+"/"+executor, func(t *testing.T) {
+				a := &flakyAction{
+					testAction: testAction{name: "A", events: []Event{StringEvent("A")}, err: tc.err},
+					failures:   tc.failures,
+				}
+				tr := &recordingTracer{}
+				// ContinueOnError, as the serial executor does not record
+				// the Action that stops the execution.
+				opts := []Option{TracerOption(tr), RetryPolicyOption(tc.policy), ErrorStrategyOption(ContinueOnError)}
+
+				var ex Executor
+				var err error
+				if executor == "serial" {
+					ex, err = NewSerialExecutor([]Action{a}, opts...)
+				} else {
+					ex, err = NewParallelExecutor([]Action{a}, opts...)
+				}
+				if err != nil {
+					t.Fatalf("New executor = %v, want nil", err)
+				}
+				_, err = ex.Run(context.Background(), nil)
+				if gotErr := err != nil; gotErr != tc.wantErr {
+					t.Errorf("Run() = %v; gotErr = %t, want %t", err, gotErr, tc.wantErr)
+				}
+				if a.runs != tc.wantRuns {
+					t.Errorf("a.runs = %d, want %d", a.runs, tc.wantRuns)
+				}
+				if len(tr.entries) != 1 {
+					t.Fatalf("len(tr.entries) = %d, want 1", len(tr.entries))
+				}
+				if got := len(tr.entries[0].Attempts); got != tc.wantAttempts {
+					t.Errorf("len(Attempts) = %d, want %d", got, tc.wantAttempts)
+				}
+			})
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := &RetryPolicy{
+		MaxAttempts:    10,
+		InitialBackoff: 1 * time.Second,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+	}
+	for _, tc := range []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: 1 * time.Second},
+		{attempt: 2, want: 2 * time.Second},
+		{attempt: 3, want: 4 * time.Second},
+		{attempt: 4, want: 5 * time.Second},
+		{attempt: 9, want: 5 * time.Second},
+	} {
+		if got := p.backoff(tc.attempt); got != tc.want {
+			t.Errorf("backoff(%d) = %v, want %v", tc.attempt, got, tc.want)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		got := p.backoff(2)
+		if got < 1*time.Second || got > 2*time.Second {
+			t.Fatalf("backoff(2) = %v, want in [1s, 2s]", got)
+		}
+	}
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	valid := DefaultRetryPolicy()
+	if err := valid.validate(); err != nil {
+		t.Errorf("DefaultRetryPolicy().validate() = %v, want nil", err)
+	}
+	for _, tc := range []struct {
+		name string
+		f    func(*RetryPolicy)
+	}{
+		{name: "MaxAttempts", f: func(p *RetryPolicy) { p.MaxAttempts = 0 }},
+		{name: "InitialBackoff", f: func(p *RetryPolicy) { p.InitialBackoff = -1 }},
+		{name: "MaxBackoff", f: func(p *RetryPolicy) { p.MaxBackoff = p.InitialBackoff - 1 }},
+		{name: "Multiplier", f: func(p *RetryPolicy) { p.Multiplier = 0.5 }},
+		{name: "Jitter", f: func(p *RetryPolicy) { p.Jitter = 2 }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := DefaultRetryPolicy()
+			tc.f(p)
+			if _, err := NewSerialExecutor(nil, RetryPolicyOption(p)); err == nil {
+				t.Errorf("NewSerialExecutor() = nil, want error")
+			}
+		})
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "non-API error", err: errors.New("x"), want: false},
+		{name: "404", err: &googleapi.Error{Code: http.StatusNotFound}, want: false},
+		{name: "429", err: &googleapi.Error{Code: http.StatusTooManyRequests}, want: true},
+		{name: "503", err: &googleapi.Error{Code: http.StatusServiceUnavailable}, want: true},
+		{
+			name: "resourceNotReady",
+			err: &googleapi.Error{
+				Code:   http.StatusBadRequest,
+				Errors: []googleapi.ErrorItem{{Reason: "resourceNotReady"}},
+			},
+			want: true,
+		},
+		{
+			name: "wrapped",
+			err:  fmt.Errorf("wrapped: %w", &googleapi.Error{Code: http.StatusTooManyRequests}),
+			want: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := IsRetryableError(tc.err); got != tc.want {
+				t.Errorf("IsRetryableError(%v) = %t, want %t", tc.err, got, tc.want)
+			}
+		})
+	}
+}
@@ -32,6 +32,17 @@ type TraceEntry struct {
 
 	Start time.Time
 	End   time.Time
+
+	// Attempts contains each run of the Action. There will be more than one
+	// attempt if the Action was retried (see RetryPolicy).
+	Attempts []TraceAttempt
+}
+
+// TraceAttempt is a single run of an Action.
+type TraceAttempt struct {
+	Start time.Time
+	End   time.Time
+	Err   error
 }
 
 // TraceSignal represents the signal of an Event.
@@ -74,6 +74,9 @@ func (tr *GraphvizTracer) Record(entry *TraceEntry, err error) {
 	tr.outf("      <tr><td colspan=\"2\">%s</td></tr>", metadata.Summary)
 	tr.outf("      <tr><td>Start (delta)</td><td>%v</td></tr>", entry.Start.Sub(tr.start))
 	tr.outf("      <tr><td>Duration</td><td>%v</td></tr>", entry.End.Sub(entry.Start))
+	if len(entry.Attempts) > 1 {
+		tr.outf("      <tr><td>Attempts</td><td>%d</td></tr>", len(entry.Attempts))
+	}
 	if err != nil {
 		tr.outf("      <tr><td><b>Error</b></td><td><b>%v</b></td></tr>", err)
 	}
@@ -0,0 +1,222 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PlanError is returned by ValidatePlan when some of the Actions in the plan
+// can never be run.
+type PlanError struct {
+	// Blocked are the Actions that will remain pending after execution.
+	Blocked []BlockedAction
+	// Cycles are groups of Actions that (transitively) wait on each other.
+	Cycles [][]Action
+}
+
+// BlockedAction is an Action that will never run.
+type BlockedAction struct {
+	Action Action
+	// Missing are Events that no Action in the plan will signal.
+	Missing []Event
+	// WaitingOn are Events that would be signaled by other blocked Actions.
+	WaitingOn []Event
+}
+
+func (e *PlanError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "plan has %d blocked Action(s):", len(e.Blocked))
+	for _, b := range e.Blocked {
+		fmt.Fprintf(&sb, " %v", b.Action)
+		if len(b.Missing) > 0 {
+			fmt.Fprintf(&sb, " (missing %v)", b.Missing)
+		}
+		if len(b.WaitingOn) > 0 {
+			fmt.Fprintf(&sb, " (waiting on %v)", b.WaitingOn)
+		}
+		sb.WriteString(";")
+	}
+	for _, c := range e.Cycles {
+		fmt.Fprintf(&sb, " cycle %v;", c)
+	}
+	return strings.TrimSuffix(sb.String(), ";")
+}
+
+// ValidatePlan checks that all of the actions can be run, without executing
+// them. The flow of Events is simulated using Action.DryRun() so DryRun() must
+// not have side effects. The Actions themselves are not modified.
+//
+// Returns a *PlanError describing the Actions that would be left pending by
+// an Executor, or nil if every Action will eventually become runnable
+// (assuming no errors during execution).
+func ValidatePlan(actions []Action) error {
+	type node struct {
+		action  Action
+		want    []Event
+		signals []Event
+		done    bool
+	}
+	var nodes []*node
+	for _, a := range actions {
+		n := &node{
+			action:  a,
+			want:    append([]Event{}, a.PendingEvents()...),
+			signals: a.DryRun(),
+		}
+		nodes = append(nodes, n)
+	}
+
+	// Simulate the execution, following the same semantics as the Executors:
+	// an Event removes the first matching entry in each waiting Action.
+	for progress := true; progress; {
+		progress = false
+		for _, n := range nodes {
+			if n.done || len(n.want) > 0 {
+				continue
+			}
+			n.done = true
+			progress = true
+			for _, ev := range n.signals {
+				for _, other := range nodes {
+					if other.done {
+						continue
+					}
+					for i, w := range other.want {
+						if w.Equal(ev) {
+							other.want = append(other.want[0:i], other.want[i+1:]...)
+							break
+						}
+					}
+				}
+			}
+		}
+	}
+
+	var blocked []*node
+	for _, n := range nodes {
+		if !n.done {
+			blocked = append(blocked, n)
+		}
+	}
+	if len(blocked) == 0 {
+		return nil
+	}
+
+	ret := &PlanError{}
+	// deps[i] are the indices of blocked Actions that blocked[i] waits on.
+	deps := make([][]int, len(blocked))
+	for i, n := range blocked {
+		ba := BlockedAction{Action: n.action}
+		for _, w := range n.want {
+			var found bool
+			for j, other := range blocked {
+				for _, ev := range other.signals {
+					if w.Equal(ev) {
+						found = true
+						deps[i] = append(deps[i], j)
+						break
+					}
+				}
+			}
+			if found {
+				ba.WaitingOn = append(ba.WaitingOn, w)
+			} else {
+				ba.Missing = append(ba.Missing, w)
+			}
+		}
+		ret.Blocked = append(ret.Blocked, ba)
+	}
+
+	for _, scc := range stronglyConnected(deps) {
+		if len(scc) == 1 && !contains(deps[scc[0]], scc[0]) {
+			continue
+		}
+		var cycle []Action
+		for _, i := range scc {
+			cycle = append(cycle, blocked[i].action)
+		}
+		ret.Cycles = append(ret.Cycles, cycle)
+	}
+
+	return ret
+}
+
+func contains(l []int, x int) bool {
+	for _, y := range l {
+		if x == y {
+			return true
+		}
+	}
+	return false
+}
+
+// stronglyConnected returns the strongly connected components of the graph
+// given by the adjacency list (Tarjan's algorithm).
+func stronglyConnected(adj [][]int) [][]int {
+	var (
+		index   = 0
+		indices = make([]int, len(adj))
+		lowLink = make([]int, len(adj))
+		onStack = make([]bool, len(adj))
+		stack   []int
+		ret     [][]int
+		visit   func(v int)
+	)
+	for i := range indices {
+		indices[i] = -1
+	}
+	visit = func(v int) {
+		indices[v] = index
+		lowLink[v] = index
+		index++
+		stack = append(stack, v)
+		onStack[v] = true
+
+		for _, w := range adj[v] {
+			if indices[w] == -1 {
+				visit(w)
+				if lowLink[w] < lowLink[v] {
+					lowLink[v] = lowLink[w]
+				}
+			} else if onStack[w] && indices[w] < lowLink[v] {
+				lowLink[v] = indices[w]
+			}
+		}
+
+		if lowLink[v] == indices[v] {
+			var scc []int
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				scc = append(scc, w)
+				if w == v {
+					break
+				}
+			}
+			ret = append(ret, scc)
+		}
+	}
+	for v := range adj {
+		if indices[v] == -1 {
+			visit(v)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidatePlan(t *testing.T) {
+	type blocked struct {
+		Name      string
+		Missing   []string
+		WaitingOn []string
+	}
+	for _, tc := range []struct {
+		name  string
+		graph string
+		// extra are events that are needed by an Action: "action:event".
+		extra []string
+
+		wantBlocked []blocked
+		// wantCycles are sorted names joined with ",".
+		wantCycles []string
+	}{
+		{
+			name:  "empty graph",
+			graph: "",
+		},
+		{
+			name:  "chain",
+			graph: "A -> B -> C; A -> C",
+		},
+		{
+			name:  "two node cycle",
+			graph: "A -> B -> A",
+			wantBlocked: []blocked{
+				{Name: "A", WaitingOn: []string{"B"}},
+				{Name: "B", WaitingOn: []string{"A"}},
+			},
+			wantCycles: []string{"A,B"},
+		},
+		{
+			name:  "self cycle",
+			graph: "A -> A",
+			wantBlocked: []blocked{
+				{Name: "A", WaitingOn: []string{"A"}},
+			},
+			wantCycles: []string{"A"},
+		},
+		{
+			name:  "cycle in larger graph",
+			graph: "A -> B -> C -> D -> C -> E; X -> Y",
+			wantBlocked: []blocked{
+				{Name: "C", WaitingOn: []string{"D"}},
+				{Name: "D", WaitingOn: []string{"C"}},
+				{Name: "E", WaitingOn: []string{"C"}},
+			},
+			wantCycles: []string{"C,D"},
+		},
+		{
+			name:  "missing event",
+			graph: "A -> B -> C",
+			extra: []string{"B:X"},
+			wantBlocked: []blocked{
+				{Name: "B", Missing: []string{"X"}},
+				{Name: "C", WaitingOn: []string{"B"}},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actions := actionsFromGraphStr(tc.graph)
+			for _, e := range tc.extra {
+				parts := strings.Split(e, ":")
+				for _, a := range actions {
+					if ta := a.(*testAction); ta.name == parts[0] {
+						ta.Want = append(ta.Want, StringEvent(parts[1]))
+					}
+				}
+			}
+			pendingBefore := map[string]int{}
+			for _, a := range actions {
+				pendingBefore[a.(*testAction).name] = len(a.PendingEvents())
+			}
+
+			err := ValidatePlan(actions)
+
+			for _, a := range actions {
+				if got, want := len(a.PendingEvents()), pendingBefore[a.(*testAction).name]; got != want {
+					t.Errorf("ValidatePlan() modified %v: len(PendingEvents()) = %d, want %d", a, got, want)
+				}
+			}
+			if tc.wantBlocked == nil {
+				if err != nil {
+					t.Fatalf("ValidatePlan() = %v, want nil", err)
+				}
+				return
+			}
+			var planErr *PlanError
+			if !errors.As(err, &planErr) {
+				t.Fatalf("ValidatePlan() = %v, want *PlanError", err)
+			}
+			t.Log(err)
+
+			evNames := func(evs []Event) []string {
+				return sortedStrings(evs, func(e Event) string { return e.String() })
+			}
+			var gotBlocked []blocked
+			for _, b := range planErr.Blocked {
+				gotBlocked = append(gotBlocked, blocked{
+					Name:      b.Action.(*testAction).name,
+					Missing:   evNames(b.Missing),
+					WaitingOn: evNames(b.WaitingOn),
+				})
+			}
+			sort.Slice(gotBlocked, func(i, j int) bool { return gotBlocked[i].Name < gotBlocked[j].Name })
+			if diff := cmp.Diff(gotBlocked, tc.wantBlocked); diff != "" {
+				t.Errorf("Blocked: diff -got,+want: %s", diff)
+			}
+
+			var gotCycles []string
+			for _, c := range planErr.Cycles {
+				names := sortedStrings(c, func(a Action) string { return a.(*testAction).name })
+				gotCycles = append(gotCycles, strings.Join(names, ","))
+			}
+			sort.Strings(gotCycles)
+			if diff := cmp.Diff(gotCycles, tc.wantCycles); diff != "" {
+				t.Errorf("Cycles: diff -got,+want: %s", diff)
+			}
+		})
+	}
+}
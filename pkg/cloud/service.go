@@ -19,11 +19,15 @@ package cloud
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"sync"
 	"time"
 
+	"go.opencensus.io/trace"
 	alpha "google.golang.org/api/compute/v0.alpha"
 	beta "google.golang.org/api/compute/v0.beta"
 	ga "google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
 	"k8s.io/klog/v2"
 )
 
@@ -35,24 +39,84 @@ type Service struct {
 	Beta          *beta.Service
 	ProjectRouter ProjectRouter
 	RateLimiter   RateLimiter
+
+	// CallObservers are called for all of the calls made with the
+	// Service, before the observers added to the context of the calls
+	// with WithCallObserver().
+	CallObservers []CallObserver
+
+	// Interceptors are called around each call made with the Service, in
+	// order, i.e. the first Interceptor is the outermost. See Interceptor.
+	Interceptors []Interceptor
+
+	// OperationMode selects how the Service waits for operations to
+	// complete. See OperationMode.
+	OperationMode OperationMode
+	// OperationPoller configures the shared poller used with
+	// OperationModeBatch.
+	OperationPoller OperationPollerConfig
+
+	pollerOnce sync.Once
+	poller     *operationPoller
+}
+
+// NewServiceForEndpoint returns a Service with GA, Alpha and Beta clients
+// that make the requests with client to the compute API at endpoint, e.g.
+// "https://compute.googleapis.com" or the URL of a local fake server. The
+// RateLimiter of the Service is a NopRateLimiter.
+func NewServiceForEndpoint(ctx context.Context, endpoint string, client *http.Client, pr ProjectRouter) (*Service, error) {
+	opts := func(ver string) []option.ClientOption {
+		return []option.ClientOption{
+			option.WithEndpoint(endpoint + "/compute/" + ver + "/"),
+			option.WithHTTPClient(client),
+		}
+	}
+	gaSvc, err := ga.NewService(ctx, opts("v1")...)
+	if err != nil {
+		return nil, err
+	}
+	alphaSvc, err := alpha.NewService(ctx, opts("alpha")...)
+	if err != nil {
+		return nil, err
+	}
+	betaSvc, err := beta.NewService(ctx, opts("beta")...)
+	if err != nil {
+		return nil, err
+	}
+	return &Service{
+		GA:            gaSvc,
+		Alpha:         alphaSvc,
+		Beta:          betaSvc,
+		ProjectRouter: pr,
+		RateLimiter:   &NopRateLimiter{},
+	}, nil
 }
 
 // wrapOperation wraps a GCE anyOP in a version generic operation type.
 func (s *Service) wrapOperation(anyOp interface{}) (operation, error) {
 	switch o := anyOp.(type) {
 	case *ga.Operation:
+		if o == nil {
+			return nil, fmt.Errorf("invalid operation: nil %T", anyOp)
+		}
 		r, err := ParseResourceURL(o.SelfLink)
 		if err != nil {
 			return nil, err
 		}
 		return &gaOperation{s: s, projectID: r.ProjectID, key: r.Key}, nil
 	case *alpha.Operation:
+		if o == nil {
+			return nil, fmt.Errorf("invalid operation: nil %T", anyOp)
+		}
 		r, err := ParseResourceURL(o.SelfLink)
 		if err != nil {
 			return nil, err
 		}
 		return &alphaOperation{s: s, projectID: r.ProjectID, key: r.Key}, nil
 	case *beta.Operation:
+		if o == nil {
+			return nil, fmt.Errorf("invalid operation: nil %T", anyOp)
+		}
 		r, err := ParseResourceURL(o.SelfLink)
 		if err != nil {
 			return nil, err
@@ -76,10 +140,24 @@ func (s *Service) WaitForCompletion(ctx context.Context, genericOp interface{})
 	return s.pollOperation(ctx, op)
 }
 
-// pollOperation calls operations.isDone until the function comes back true or context is Done.
+// pollOperation waits for op to complete as configured by s.OperationMode.
+func (s *Service) pollOperation(ctx context.Context, op operation) error {
+	switch s.OperationMode {
+	case OperationModeBatch:
+		s.pollerOnce.Do(func() { s.poller = newOperationPoller(s, s.OperationPoller) })
+		return s.poller.wait(ctx, op)
+	case OperationModeWait:
+		return s.pollSingleOperation(ctx, op, true)
+	case OperationModeGet:
+		return s.pollSingleOperation(ctx, op, false)
+	}
+	return s.pollSingleOperation(ctx, op, OperationsUseWait)
+}
+
+// pollSingleOperation calls operations.isDone until the function comes back true or context is Done.
 // If an error occurs retrieving the operation, the loop will continue until the context is done.
 // This is to prevent a transient error from bubbling up to controller-level logic.
-func (s *Service) pollOperation(ctx context.Context, op operation) error {
+func (s *Service) pollSingleOperation(ctx context.Context, op operation, wait bool) error {
 	start := time.Now()
 	var pollCount int
 	for {
@@ -95,8 +173,17 @@ func (s *Service) pollOperation(ctx context.Context, op operation) error {
 
 		pollCount++
 		klog.V(5).Infof("op.isDone(%v) waiting; op = %v, poll count = %d (%v elapsed)", ctx, op, pollCount, time.Now().Sub(start))
-		s.RateLimiter.Accept(ctx, op.rateLimitKey())
-		switch done, err := op.isDone(ctx); {
+		pollCtx, span := startSpan(ctx, SpanOperationPoll)
+		span.AddAttributes(trace.Int64Attribute("pollCount", int64(pollCount)))
+		s.acceptRateLimit(pollCtx, op.rateLimitKey())
+		done, err := op.isDone(pollCtx, wait)
+		endSpan(span, err)
+		if done {
+			s.callObserverOperationPoll(ctx, op, pollCount, true, op.error())
+		} else {
+			s.callObserverOperationPoll(ctx, op, pollCount, false, err)
+		}
+		switch {
 		case err != nil:
 			klog.V(5).Infof("op.isDone(%v) error; op = %v, poll count = %d, err = %v, retrying (%v elapsed)", ctx, op, pollCount, err, time.Now().Sub(start))
 			s.RateLimiter.Observe(ctx, err, op.rateLimitKey())
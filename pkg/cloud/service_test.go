@@ -21,6 +21,8 @@ import (
 	"errors"
 	"testing"
 	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 )
 
 func TestPollOperation(t *testing.T) {
@@ -84,7 +86,7 @@ type fakeOperation struct {
 	err               error
 }
 
-func (f *fakeOperation) isDone(ctx context.Context) (bool, error) {
+func (f *fakeOperation) isDone(ctx context.Context, wait bool) (bool, error) {
 	f.attemptsRemaining--
 	if f.attemptsRemaining <= 0 {
 		return f.doneErr == nil, f.doneErr
@@ -99,3 +101,11 @@ func (f *fakeOperation) error() error {
 func (f *fakeOperation) rateLimitKey() *RateLimitKey {
 	return nil
 }
+
+func (f *fakeOperation) id() (string, meta.Version, *meta.Key) {
+	return "", "", nil
+}
+
+func (f *fakeOperation) setDone(err error) {
+	f.err = err
+}
@@ -0,0 +1,317 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// TokenBucketRule sets the rate limit for the calls with a key that matches
+// Key.
+type TokenBucketRule struct {
+	// Key is the pattern for the keys of the calls. Each field is matched
+	// with path.Match(), e.g. "*" matches any value and "List*" matches
+	// "List" and "ListUsable". An empty field matches any value. The Zone,
+	// Region and Name of Key.Key are matched in the same way, e.g.
+	// Key.Key = meta.Key{Region: "us-central1"} matches the calls for the
+	// resources in us-central1. If Key.Mutation is set, only the calls that
+	// modify resources match.
+	Key CallContextKey
+	// QPS is the rate at which tokens are added to the bucket. If QPS is
+	// zero, the calls matching the rule are not rate limited.
+	QPS float64
+	// Burst is the maximum number of tokens in the bucket, i.e. the number
+	// of calls that can be made at once after a period of inactivity.
+	Burst int
+	// Shared makes all of the keys matching the rule share a single bucket,
+	// e.g. to limit all of the calls to a project together. By default,
+	// each distinct key has its own bucket. The name of the resource is not
+	// part of the key, i.e. the calls for the resources in the same location
+	// share a bucket.
+	Shared bool
+}
+
+func (r *TokenBucketRule) validate() error {
+	patterns := []string{
+		r.Key.ProjectID, r.Key.Operation, string(r.Key.Version), r.Key.Service,
+		r.Key.Key.Zone, r.Key.Key.Region, r.Key.Key.Name,
+	}
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid TokenBucketRule.Key pattern %q: %w", p, err)
+		}
+	}
+	switch {
+	case r.QPS < 0 || math.IsNaN(r.QPS) || math.IsInf(r.QPS, 0):
+		return fmt.Errorf("invalid TokenBucketRule.QPS: %v", r.QPS)
+	case r.QPS > 0 && r.Burst < 1:
+		return fmt.Errorf("invalid TokenBucketRule.Burst: %d (must be >= 1)", r.Burst)
+	}
+	return nil
+}
+
+func (r *TokenBucketRule) matches(key *CallContextKey) bool {
+	match := func(pattern, s string) bool {
+		if pattern == "" {
+			return true
+		}
+		ok, _ := path.Match(pattern, s)
+		return ok
+	}
+	if r.Key.Mutation && !key.Mutation {
+		return false
+	}
+	return match(r.Key.ProjectID, key.ProjectID) &&
+		match(r.Key.Operation, key.Operation) &&
+		match(string(r.Key.Version), string(key.Version)) &&
+		match(r.Key.Service, key.Service) &&
+		match(r.Key.Key.Zone, key.Key.Zone) &&
+		match(r.Key.Key.Region, key.Key.Region) &&
+		match(r.Key.Key.Name, key.Key.Name)
+}
+
+// NewTokenBucketRateLimiter returns a TokenBucketRateLimiter with the given
+// rules. The first rule that matches the key of a call applies; calls that
+// do not match any rule are not rate limited. Use a rule with an empty Key
+// as the last rule to set the default.
+//
+//	rl, err := NewTokenBucketRateLimiter(
+//		TokenBucketRule{Key: CallContextKey{Operation: "Get*"}, QPS: 20, Burst: 20},
+//		TokenBucketRule{Key: CallContextKey{Operation: "List*"}, QPS: 5, Burst: 5},
+//		TokenBucketRule{QPS: 10, Burst: 10},
+//	)
+func NewTokenBucketRateLimiter(rules ...TokenBucketRule) (*TokenBucketRateLimiter, error) {
+	for i := range rules {
+		if err := rules[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &TokenBucketRateLimiter{
+		rules:   append([]TokenBucketRule{}, rules...),
+		clock:   realClock{},
+		buckets: map[tokenBucketKey]*tokenBucket{},
+	}, nil
+}
+
+// TokenBucketRateLimiter is a RateLimiter that allows calls at a steady rate
+// (QPS) with bursts, using a token bucket for each key as configured by the
+// TokenBucketRules.
+//
+// Accept() waits until a token is available or the context is done. No
+// goroutines are started to wait; the token reserved by a call is returned
+// to the bucket if its context is done before the call is allowed.
+//
+// This object is thread-safe.
+type TokenBucketRateLimiter struct {
+	rules []TokenBucketRule
+	clock clock
+
+	lock    sync.Mutex
+	buckets map[tokenBucketKey]*tokenBucket
+}
+
+// tokenBucketKey identifies a bucket. For shared rules, key is empty. The
+// Name of key.Key is always empty, i.e. the calls for the resources in the
+// same location share a bucket.
+type tokenBucketKey struct {
+	rule int
+	key  CallContextKey
+}
+
+// tokenBucket is the state of a single bucket. tokens is negative when calls
+// are waiting for (have reserved) future tokens.
+type tokenBucket struct {
+	// pattern is the key reported by QueueDepths().
+	pattern CallContextKey
+	qps     float64
+	burst   float64
+	tokens  float64
+	last    time.Time
+	// waiting is the number of calls waiting in Accept().
+	waiting int
+}
+
+// refill adds the tokens for the time since the last refill.
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.qps)
+	}
+	b.last = now
+}
+
+// reserve takes a token from the bucket. It returns how long the caller must
+// wait before the token is available.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(-b.tokens / b.qps * float64(time.Second)))
+}
+
+// cancel returns a reserved token to the bucket.
+func (b *tokenBucket) cancel(now time.Time) {
+	b.refill(now)
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
+
+// setQPS changes the rate at which tokens are added. The tokens for the time
+// since the last refill are added at the previous rate.
+func (b *tokenBucket) setQPS(now time.Time, qps float64) {
+	b.refill(now)
+	b.qps = qps
+}
+
+// bucketKey returns the key of the bucket for key and the rule that applies
+// to it. The rule is nil if the key is not rate limited.
+func (rl *TokenBucketRateLimiter) bucketKey(key *CallContextKey) (tokenBucketKey, *TokenBucketRule) {
+	if key == nil {
+		key = &CallContextKey{}
+	}
+	for i := range rl.rules {
+		r := &rl.rules[i]
+		if !r.matches(key) {
+			continue
+		}
+		if r.QPS == 0 {
+			return tokenBucketKey{}, nil
+		}
+		bk := tokenBucketKey{rule: i}
+		if !r.Shared {
+			bk.key = *key
+			bk.key.Key.Name = ""
+		}
+		return bk, r
+	}
+	return tokenBucketKey{}, nil
+}
+
+// bucket returns the bucket for key, creating it if needed. Returns nil if
+// the key is not rate limited. Caller must hold the lock.
+func (rl *TokenBucketRateLimiter) bucket(key *CallContextKey) *tokenBucket {
+	bk, r := rl.bucketKey(key)
+	if r == nil {
+		return nil
+	}
+	if b, ok := rl.buckets[bk]; ok {
+		return b
+	}
+	pattern := r.Key
+	if !r.Shared {
+		pattern = bk.key
+	}
+	b := &tokenBucket{
+		pattern: pattern,
+		qps:     r.QPS,
+		burst:   float64(r.Burst),
+		tokens:  float64(r.Burst),
+		last:    rl.clock.Now(),
+	}
+	rl.buckets[bk] = b
+	return b
+}
+
+// Accept implements RateLimiter.
+func (rl *TokenBucketRateLimiter) Accept(ctx context.Context, key *RateLimitKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	rl.lock.Lock()
+	b := rl.bucket(key)
+	if b == nil {
+		rl.lock.Unlock()
+		return nil
+	}
+	return waitForToken(ctx, rl.clock, &rl.lock, b, key)
+}
+
+// waitForToken takes a token from b, waiting until the token is available or
+// ctx is done. lock guards b; it must be held by the caller and is released
+// by waitForToken.
+func waitForToken(ctx context.Context, clk clock, lock *sync.Mutex, b *tokenBucket, key *RateLimitKey) error {
+	d := b.reserve(clk.Now())
+	if d == 0 {
+		lock.Unlock()
+		return nil
+	}
+	b.waiting++
+	lock.Unlock()
+
+	klog.V(5).Infof("waitForToken(%v, %+v): waiting %v", ctx, key, d)
+	t := clk.NewTimer(d)
+	select {
+	case <-t.C():
+		lock.Lock()
+		b.waiting--
+		lock.Unlock()
+		return nil
+	case <-ctx.Done():
+		t.Stop()
+		lock.Lock()
+		b.waiting--
+		b.cancel(clk.Now())
+		lock.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Observe does nothing.
+func (rl *TokenBucketRateLimiter) Observe(context.Context, error, *RateLimitKey) {}
+
+// QueueDepth returns the number of calls with the given key that are
+// waiting in Accept(). For shared rules, this includes the calls with the
+// other keys that share the bucket.
+func (rl *TokenBucketRateLimiter) QueueDepth(key *CallContextKey) int {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	// Do not create the bucket: calls for keys without a bucket cannot be
+	// waiting.
+	if bk, r := rl.bucketKey(key); r != nil {
+		if b, ok := rl.buckets[bk]; ok {
+			return b.waiting
+		}
+	}
+	return 0
+}
+
+// QueueDepths returns the number of calls waiting in Accept() for each
+// bucket that has waiting calls. Buckets are identified by the key of the
+// calls, or by the rule pattern for shared rules. The Key of the key of the
+// calls only has the location (Zone or Region) of the resource; it is nil if
+// the calls are not for a location.
+func (rl *TokenBucketRateLimiter) QueueDepths() map[CallContextKey]int {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	ret := map[CallContextKey]int{}
+	for _, b := range rl.buckets {
+		if b.waiting > 0 {
+			ret[b.pattern] += b.waiting
+		}
+	}
+	return ret
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opencensus.io/plugin/ochttp"
+	"go.opencensus.io/trace"
+	"google.golang.org/api/googleapi"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+)
+
+// Names of the OpenCensus spans. The span for a call is named
+// "cloud/<Service>.<Operation>", e.g. "cloud/Addresses.Get", and has these
+// children:
+//
+//   - SpanRateLimit for the wait in RateLimiter.Accept().
+//   - SpanRequest for the API request. The spans for the HTTP requests are
+//     children of this span if the HTTP client is instrumented, e.g. with
+//     ochttp.Transport. Pages() calls (e.g. List) do not have this span; the
+//     HTTP requests are direct children of the call span.
+//
+// Operation.Wait() has a SpanOperationWait span, with a SpanOperationPoll
+// child span for each time the operation is polled. For the synchronous
+// methods that start an operation (e.g. Insert()), the call span includes
+// the wait, i.e. SpanOperationWait is a child of the call span.
+const (
+	SpanRateLimit     = "cloud/RateLimiter.Accept"
+	SpanRequest       = "cloud/request"
+	SpanOperationWait = "cloud/Operation.Wait"
+	SpanOperationPoll = "cloud/Operation.poll"
+)
+
+// startCallSpan starts the span for the call key. The span is ended by
+// endCallSpan().
+func startCallSpan(ctx context.Context, key *CallContextKey) context.Context {
+	ctx, span := trace.StartSpan(ctx, "cloud/"+key.Service+"."+key.Operation, trace.WithSpanKind(trace.SpanKindClient))
+	span.AddAttributes(keyAttributes(key)...)
+	return ctx
+}
+
+// endCallSpan ends the span started by startCallSpan().
+func endCallSpan(ctx context.Context, err error) {
+	endSpan(trace.FromContext(ctx), err)
+}
+
+// startSpan starts a child span of the span in ctx, e.g. SpanRequest.
+func startSpan(ctx context.Context, name string) (context.Context, *trace.Span) {
+	return trace.StartSpan(ctx, name)
+}
+
+// endSpan sets the status of span from err and ends it. span may be nil.
+func endSpan(span *trace.Span, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil {
+		span.SetStatus(spanStatus(err))
+	}
+	span.End()
+}
+
+// setSpanFilter adds the filter of a List call to the span in ctx.
+func setSpanFilter(ctx context.Context, fl *filter.F) {
+	if fl == filter.None {
+		return
+	}
+	if span := trace.FromContext(ctx); span != nil {
+		span.AddAttributes(trace.StringAttribute("filter", fl.String()))
+	}
+}
+
+func keyAttributes(key *CallContextKey) []trace.Attribute {
+	attrs := []trace.Attribute{
+		trace.StringAttribute("project", key.ProjectID),
+		trace.StringAttribute("service", key.Service),
+		trace.StringAttribute("operation", key.Operation),
+		trace.StringAttribute("version", string(key.Version)),
+		trace.BoolAttribute("mutation", key.Mutation),
+	}
+	if key.Key != (meta.Key{}) {
+		attrs = append(attrs, trace.StringAttribute("key", key.Key.String()))
+	}
+	return attrs
+}
+
+// spanStatus returns the status of a span that ended with err.
+func spanStatus(err error) trace.Status {
+	var gerr *googleapi.Error
+	switch {
+	case errors.As(err, &gerr):
+		return ochttp.TraceStatus(gerr.Code, gerr.Message)
+	case errors.Is(err, context.Canceled):
+		return trace.Status{Code: trace.StatusCodeCancelled, Message: err.Error()}
+	case errors.Is(err, context.DeadlineExceeded):
+		return trace.Status{Code: trace.StatusCodeDeadlineExceeded, Message: err.Error()}
+	}
+	return trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()}
+}
+
+// acceptRateLimit calls RateLimiter.Accept() in a SpanRateLimit span and
+// reports the wait to the RateLimitObservers.
+func (s *Service) acceptRateLimit(ctx context.Context, key *RateLimitKey) error {
+	start := time.Now()
+	spanCtx, span := startSpan(ctx, SpanRateLimit)
+	err := s.RateLimiter.Accept(spanCtx, key)
+	endSpan(span, err)
+	s.callObserverRateLimitEnd(ctx, key, time.Since(start), err)
+	return err
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2023 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"go.opencensus.io/trace"
+	"google.golang.org/api/googleapi"
+)
+
+func TestSpanStatus(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		want int32
+	}{
+		{name: "404", err: &googleapi.Error{Code: http.StatusNotFound}, want: trace.StatusCodeNotFound},
+		{name: "429", err: &googleapi.Error{Code: http.StatusTooManyRequests}, want: trace.StatusCodeResourceExhausted},
+		{name: "wrapped 409", err: fmt.Errorf("x: %w", &googleapi.Error{Code: http.StatusConflict}), want: trace.StatusCodeAlreadyExists},
+		{name: "operation error", err: &OperationError{HTTPStatusCode: http.StatusBadRequest}, want: trace.StatusCodeInvalidArgument},
+		{name: "canceled", err: context.Canceled, want: trace.StatusCodeCancelled},
+		{name: "deadline", err: context.DeadlineExceeded, want: trace.StatusCodeDeadlineExceeded},
+		{name: "other", err: errors.New("x"), want: trace.StatusCodeUnknown},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if got := spanStatus(tc.err); got.Code != tc.want {
+				t.Errorf("spanStatus(%v).Code = %d, want %d", tc.err, got.Code, tc.want)
+			}
+		})
+	}
+}